@@ -0,0 +1,135 @@
+// Copyright 2017 The goimagehash Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package goimagehash
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"strconv"
+	"strings"
+)
+
+// Algorithm describes a hash algorithm along with its size parameters.
+// Its zero Width and Height mean 8x8.
+type Algorithm struct {
+	Kind   Kind
+	Width  int
+	Height int
+}
+
+// algorithmAliases maps the short names of the algorithms to their kind,
+// in addition to the kind codes and names.
+var algorithmAliases = map[string]Kind{
+	"ahash": AHash,
+	"dhash": DHash,
+	"phash": PHash,
+	"whash": WHash,
+	"dgrad": DGHash,
+}
+
+// Algorithms function returns the 8x8 variant of every implemented algorithm.
+func Algorithms() []Algorithm {
+	return []Algorithm{
+		{Kind: AHash, Width: 8, Height: 8},
+		{Kind: DHash, Width: 8, Height: 8},
+		{Kind: PHash, Width: 8, Height: 8},
+		{Kind: DGHash, Width: 8, Height: 8},
+	}
+}
+
+// ParseAlgorithm function parses an algorithm name, optionally followed by
+// its size, e.g. "phash", "perception:16x16" or "dgrad:16". The name is a
+// kind code, a kind name or one of ahash, dhash, phash, whash and dgrad.
+func ParseAlgorithm(s string) (Algorithm, error) {
+	name, size := s, ""
+	if idx := strings.IndexByte(s, ':'); idx >= 0 {
+		name, size = s[:idx], s[idx+1:]
+	}
+	name = strings.ToLower(name)
+	kind, ok := algorithmAliases[name]
+	if !ok {
+		var err error
+		if kind, err = ParseKind(name); err != nil {
+			return Algorithm{}, fmt.Errorf("unknown hash algorithm %q", s)
+		}
+	}
+	a := Algorithm{Kind: kind, Width: 8, Height: 8}
+	if size != "" {
+		w, h := size, size
+		if idx := strings.IndexByte(size, 'x'); idx >= 0 {
+			w, h = size[:idx], size[idx+1:]
+		}
+		var err1, err2 error
+		a.Width, err1 = strconv.Atoi(w)
+		a.Height, err2 = strconv.Atoi(h)
+		if err1 != nil || err2 != nil || a.Width <= 0 || a.Height <= 0 {
+			return Algorithm{}, fmt.Errorf("invalid size %q of hash algorithm", size)
+		}
+	}
+	return a, a.Validate()
+}
+
+func (a Algorithm) size() (int, int) {
+	if a.Width == 0 && a.Height == 0 {
+		return 8, 8
+	}
+	return a.Width, a.Height
+}
+
+// String method returns the algorithm as parsed by ParseAlgorithm,
+// e.g. "perception:16x16".
+func (a Algorithm) String() string {
+	w, h := a.size()
+	return fmt.Sprintf("%s:%dx%d", a.Kind, w, h)
+}
+
+// Validate method checks that the algorithm is implemented and that its size
+// is supported.
+func (a Algorithm) Validate() error {
+	w, h := a.size()
+	if w <= 0 || h <= 0 {
+		return fmt.Errorf("invalid hash size %dx%d", w, h)
+	}
+	switch a.Kind {
+	case AHash, DHash, DGHash:
+		return nil
+	case PHash:
+		if size := w * h; size&(size-1) != 0 {
+			return errors.New("width * height should be power of 2")
+		}
+		return nil
+	}
+	return fmt.Errorf("%v hash is not implemented", a.Kind)
+}
+
+// Bits method returns the bit size of the hashes computed by the algorithm.
+func (a Algorithm) Bits() int {
+	w, h := a.size()
+	if a.Kind == DGHash {
+		rw := int(nextMultipleOf2(uint(w)))/2 + 1
+		rh := int(nextMultipleOf2(uint(h)))/2 + 1
+		return rh*(rw-1) + rw*(rh-1)
+	}
+	return w * h
+}
+
+// Hash method computes the hash of img with the algorithm.
+func (a Algorithm) Hash(img image.Image) (*ExtImageHash, error) {
+	if err := a.Validate(); err != nil {
+		return nil, err
+	}
+	w, h := a.size()
+	switch a.Kind {
+	case AHash:
+		return ExtAverageHash(img, w, h)
+	case DHash:
+		return ExtDifferenceHash(img, w, h)
+	case PHash:
+		return ExtPerceptionHash(img, w, h)
+	default:
+		return DoubleGradientHash(img, w, h)
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright 2017 The goimagehash Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package goimagehash
+
+import (
+	"image"
+	"os"
+	"testing"
+)
+
+func TestParseAlgorithm(t *testing.T) {
+	for _, tt := range []struct {
+		s        string
+		expected Algorithm
+		str      string
+	}{
+		{"phash", Algorithm{PHash, 8, 8}, "perception:8x8"},
+		{"Perception:16x16", Algorithm{PHash, 16, 16}, "perception:16x16"},
+		{"a:16", Algorithm{AHash, 16, 16}, "average:16x16"},
+		{"dhash:9x8", Algorithm{DHash, 9, 8}, "difference:9x8"},
+		{"dgrad", Algorithm{DGHash, 8, 8}, "double-gradient:8x8"},
+		{"double-gradient:16", Algorithm{DGHash, 16, 16}, "double-gradient:16x16"},
+	} {
+		a, err := ParseAlgorithm(tt.s)
+		if err != nil {
+			t.Errorf("ParseAlgorithm(%q): %v", tt.s, err)
+			continue
+		}
+		if a != tt.expected || a.String() != tt.str {
+			t.Errorf("ParseAlgorithm(%q) is expected %v but got %v", tt.s, tt.str, a)
+		}
+		if reparsed, err := ParseAlgorithm(a.String()); err != nil || reparsed != a {
+			t.Errorf("ParseAlgorithm(%q) should round trip, got %v, %v", a.String(), reparsed, err)
+		}
+	}
+
+	for _, s := range []string{"", "sha256", "wavelet", "phash:3x3", "phash:x", "ahash:0", "ahash:8x"} {
+		if _, err := ParseAlgorithm(s); err == nil {
+			t.Errorf("Should got error for %q", s)
+		}
+	}
+}
+
+func TestAlgorithmHash(t *testing.T) {
+	file, err := os.Open("_examples/sample1.jpg")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer file.Close()
+	img, _, err := image.Decode(file)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	algorithms := append(Algorithms(),
+		Algorithm{AHash, 16, 16}, Algorithm{DHash, 17, 17}, Algorithm{PHash, 16, 16},
+		Algorithm{DGHash, 9, 9}, Algorithm{DGHash, 16, 16})
+	for _, a := range algorithms {
+		hash, err := a.Hash(img)
+		if err != nil {
+			t.Errorf("%v: %v", a, err)
+			continue
+		}
+		if hash.GetKind() != a.Kind || hash.Bits() != a.Bits() {
+			t.Errorf("%v: expected %v hash of %d bits but got %v of %d bits", a, a.Kind, a.Bits(), hash.GetKind(), hash.Bits())
+		}
+		if _, err := a.Hash(nil); err == nil {
+			t.Errorf("%v: should got error for nil image", a)
+		}
+	}
+
+	phash, _ := PerceptionHash(img)
+	extPhash, _ := Algorithm{Kind: PHash}.Hash(img)
+	if extPhash.String() != phash.String() {
+		t.Errorf("8x8 perception algorithm should match PerceptionHash, got %v vs %v", extPhash, phash)
+	}
+}
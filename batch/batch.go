@@ -0,0 +1,192 @@
+// Copyright 2017 The goimagehash Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package batch
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"os"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/lollipopkit/goimagehash"
+)
+
+// Progress is the state of a run after an item finished.
+type Progress struct {
+	// Done is the number of finished items, failed ones included.
+	Done int
+	// Failed is the number of finished items that returned an error.
+	Failed int
+	// Total is the number of items of the run.
+	Total int
+	// ID and Err are the item that just finished and its error.
+	ID  string
+	Err error
+	// Elapsed is the time since the run started.
+	Elapsed time.Duration
+}
+
+// Rate method returns the number of items finished per second.
+func (p Progress) Rate() float64 {
+	if p.Elapsed <= 0 {
+		return 0
+	}
+	return float64(p.Done) / p.Elapsed.Seconds()
+}
+
+// Remaining method returns the estimated time until every item is finished,
+// assuming the remaining items take as long as the finished ones on average.
+// It returns 0 before the first item finished.
+func (p Progress) Remaining() time.Duration {
+	if p.Done == 0 || p.Done >= p.Total {
+		return 0
+	}
+	return time.Duration(float64(p.Elapsed) / float64(p.Done) * float64(p.Total-p.Done))
+}
+
+// ProgressFunc receives the progress of a run after every finished item.
+// Calls are never concurrent, so the function needs no locking, but it
+// should return quickly as workers wait for it.
+type ProgressFunc func(Progress)
+
+// Tracker counts the finished items of a run and reports its progress. It
+// lets items processed outside Run, e.g. read sequentially from an archive,
+// be counted in the same progress. A Tracker is safe for concurrent use.
+type Tracker struct {
+	mu    sync.Mutex
+	start time.Time
+	now   func() time.Time
+	p     Progress
+	fn    ProgressFunc
+}
+
+// NewTracker function returns a tracker of a run of total items, started
+// now, that calls fn, unless nil, after every finished item.
+func NewTracker(total int, fn ProgressFunc) *Tracker {
+	return &Tracker{start: time.Now(), now: time.Now, p: Progress{Total: total}, fn: fn}
+}
+
+// Done method records that the item id finished with err.
+func (t *Tracker) Done(id string, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.p.Done++
+	if err != nil {
+		t.p.Failed++
+	}
+	t.p.ID, t.p.Err = id, err
+	t.p.Elapsed = t.now().Sub(t.start)
+	if t.fn != nil {
+		t.fn(t.p)
+	}
+}
+
+// Progress method returns the progress after the last finished item.
+func (t *Tracker) Progress() Progress {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	p := t.p
+	p.Elapsed = t.now().Sub(t.start)
+	return p
+}
+
+// Task is an item of a run: the hash of an image, computed by Hash.
+type Task struct {
+	ID   string
+	Hash func() (*goimagehash.ExtImageHash, error)
+}
+
+// Result is the hash of a task, or the error that prevented it.
+type Result struct {
+	ID   string
+	Hash *goimagehash.ExtImageHash
+	Err  error
+}
+
+// Options configures a run.
+type Options struct {
+	// Workers is the number of tasks run concurrently. Zero means
+	// runtime.NumCPU().
+	Workers int
+	// Progress, unless nil, is called after every finished task.
+	Progress ProgressFunc
+	// Tracker, unless nil, counts the finished tasks instead of a tracker
+	// of the run calling Progress, e.g. to share it with other items.
+	Tracker *Tracker
+}
+
+// Run function runs tasks concurrently and returns their results in the
+// order of tasks. Once ctx is done, the tasks not started yet fail with the
+// error of ctx.
+func Run(ctx context.Context, tasks []Task, opts Options) []Result {
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	if workers > len(tasks) {
+		workers = len(tasks)
+	}
+	tracker := opts.Tracker
+	if tracker == nil {
+		tracker = NewTracker(len(tasks), opts.Progress)
+	}
+
+	results := make([]Result, len(tasks))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				r := Result{ID: tasks[i].ID}
+				if err := ctx.Err(); err != nil {
+					r.Err = err
+				} else {
+					r.Hash, r.Err = tasks[i].Hash()
+				}
+				results[i] = r
+				tracker.Done(r.ID, r.Err)
+			}
+		}()
+	}
+	for i := range tasks {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	return results
+}
+
+// HashFiles function hashes the image files at paths with the algorithm a,
+// concurrently, and returns the results in the order of paths.
+func HashFiles(ctx context.Context, paths []string, a goimagehash.Algorithm, opts Options) []Result {
+	tasks := make([]Task, len(paths))
+	for i, path := range paths {
+		path := path
+		tasks[i] = Task{ID: path, Hash: func() (*goimagehash.ExtImageHash, error) {
+			return hashFile(path, a)
+		}}
+	}
+	return Run(ctx, tasks, opts)
+}
+
+// hashFile decodes the image at path with the registered decoders and
+// hashes it.
+func hashFile(path string, a goimagehash.Algorithm) (*goimagehash.ExtImageHash, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+	return a.Hash(img)
+}
@@ -0,0 +1,109 @@
+// Copyright 2017 The goimagehash Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package batch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	_ "image/jpeg"
+	"testing"
+	"time"
+
+	"github.com/lollipopkit/goimagehash"
+)
+
+func TestRun(t *testing.T) {
+	var tasks []Task
+	for i := 0; i < 50; i++ {
+		i := i
+		tasks = append(tasks, Task{ID: fmt.Sprint(i), Hash: func() (*goimagehash.ExtImageHash, error) {
+			if i%10 == 3 {
+				return nil, errors.New("broken")
+			}
+			return goimagehash.NewExtImageHash([]uint64{uint64(i)}, goimagehash.AHash, 64), nil
+		}})
+	}
+
+	var calls []Progress
+	results := Run(context.Background(), tasks, Options{Workers: 4, Progress: func(p Progress) {
+		calls = append(calls, p)
+	}})
+	for i, r := range results {
+		if r.ID != fmt.Sprint(i) {
+			t.Fatalf("Expected result %d to be in order but got %s", i, r.ID)
+		}
+		if (r.Err != nil) != (i%10 == 3) || (r.Err == nil && r.Hash.GetHash()[0] != uint64(i)) {
+			t.Errorf("Unexpected result %d: %v, %v", i, r.Hash, r.Err)
+		}
+	}
+	if len(calls) != len(tasks) {
+		t.Fatalf("Expected %d progress calls but got %d", len(tasks), len(calls))
+	}
+	for i, p := range calls {
+		if p.Done != i+1 || p.Total != len(tasks) {
+			t.Errorf("Unexpected progress %+v", p)
+		}
+	}
+	if last := calls[len(calls)-1]; last.Failed != 5 {
+		t.Errorf("Expected 5 failures but got %d", last.Failed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for _, r := range Run(ctx, tasks, Options{}) {
+		if !errors.Is(r.Err, context.Canceled) {
+			t.Errorf("Expected %s to be canceled but got %v", r.ID, r.Err)
+		}
+	}
+	if results := Run(context.Background(), nil, Options{}); len(results) != 0 {
+		t.Errorf("Expected no result but got %v", results)
+	}
+}
+
+func TestTracker(t *testing.T) {
+	now := time.Date(2021, 5, 1, 0, 0, 0, 0, time.UTC)
+	tracker := NewTracker(4, nil)
+	tracker.start, tracker.now = now, func() time.Time { return now }
+
+	if p := tracker.Progress(); p.Remaining() != 0 || p.Rate() != 0 {
+		t.Errorf("Expected no estimate before the first item but got %v, %v", p.Remaining(), p.Rate())
+	}
+	now = now.Add(2 * time.Second)
+	tracker.Done("a", nil)
+	now = now.Add(2 * time.Second)
+	tracker.Done("b", errors.New("broken"))
+	p := tracker.Progress()
+	if p.Done != 2 || p.Failed != 1 || p.ID != "b" || p.Err == nil {
+		t.Errorf("Unexpected progress %+v", p)
+	}
+	if p.Rate() != 0.5 || p.Remaining() != 4*time.Second {
+		t.Errorf("Expected 0.5 items/s and 4s left but got %v, %v", p.Rate(), p.Remaining())
+	}
+
+	// A shared tracker counts the tasks of several runs.
+	tasks := []Task{{ID: "c", Hash: func() (*goimagehash.ExtImageHash, error) { return nil, nil }}}
+	Run(context.Background(), tasks, Options{Tracker: tracker})
+	if p := tracker.Progress(); p.Done != 3 || p.Remaining() == 0 {
+		t.Errorf("Unexpected progress %+v", p)
+	}
+}
+
+func TestHashFiles(t *testing.T) {
+	paths := []string{"../_examples/sample1.jpg", "../_examples/missing.jpg", "../_examples/sample2.jpg"}
+	a := goimagehash.Algorithm{Kind: goimagehash.PHash, Width: 8, Height: 8}
+	results := HashFiles(context.Background(), paths, a, Options{Workers: 2})
+	if results[1].Err == nil {
+		t.Errorf("Should got error for a missing file")
+	}
+	for _, i := range []int{0, 2} {
+		if results[i].Err != nil {
+			t.Fatalf("%s: %v", paths[i], results[i].Err)
+		}
+		if results[i].Hash.GetKind() != goimagehash.PHash || results[i].Hash.Bits() != 64 {
+			t.Errorf("Unexpected hash %s", results[i].Hash)
+		}
+	}
+}
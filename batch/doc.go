@@ -0,0 +1,9 @@
+// Copyright 2017 The goimagehash Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package batch hashes many images concurrently and reports the progress of
+// the run, with the number of images done and failed, the rate and the
+// estimated remaining time, to a callback suitable for progress bars and
+// logs.
+package batch
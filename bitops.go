@@ -0,0 +1,281 @@
+// Copyright 2017 The goimagehash Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package goimagehash
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Bit order
+//
+// Hash bits are addressed by a logical index i in [0, Bits()), which is the
+// order in which an algorithm emits them: pixel i for AverageHash,
+// comparison i for DifferenceHash and DoubleGradientHash, and DCT
+// coefficient i for PerceptionHash.
+//
+// Every kind is packed MSB first: ImageHash stores bit i at position 63-i of
+// its uint64 and ExtImageHash stores bit i at position 63-i%64 of word i/64.
+// Unused trailing bits of the last word are always zero.
+//
+// Byte encodings carry an explicit BitOrder. Bytes, String and the
+// FromBytes functions use MSBFirst, while ToBase64 uses LSBFirst to stay
+// compatible with the Rust img_hash library.
+
+var (
+	errBitsMismatch = errors.New("image hashes should have an identical bit size")
+	errKindMismatch = errors.New("image hashes's kind should be identical")
+)
+
+func checkBitIndex(i, bits int) {
+	if i < 0 || i >= bits {
+		panic(fmt.Sprintf("goimagehash: bit index %d out of range [0, %d)", i, bits))
+	}
+}
+
+func wordsFor(bits int) int {
+	return (bits + 63) / 64
+}
+
+// Bit method returns the i-th bit of the hash.
+// It panics if i is not in [0, 64).
+func (h *ImageHash) Bit(i int) bool {
+	checkBitIndex(i, 64)
+	return h.hash>>uint(63-i)&1 == 1
+}
+
+// SetBit method sets the i-th bit of the hash to v.
+// It panics if i is not in [0, 64).
+func (h *ImageHash) SetBit(i int, v bool) {
+	checkBitIndex(i, 64)
+	if v {
+		h.hash |= 1 << uint(63-i)
+	} else {
+		h.hash &^= 1 << uint(63-i)
+	}
+}
+
+// Bytes method returns the hash as 8 bytes, bit 0 first (big-endian).
+func (h *ImageHash) Bytes() []byte {
+	b := make([]byte, 8)
+	for i := 0; i < 8; i++ {
+		b[i] = byte(h.hash >> uint(56-8*i))
+	}
+	return b
+}
+
+// ImageHashFromBytes function creates an image hash from the 8 bytes
+// returned by ImageHash.Bytes.
+func ImageHashFromBytes(b []byte, kind Kind) (*ImageHash, error) {
+	if len(b) != 8 {
+		return nil, fmt.Errorf("image hash should be 8 bytes but got %d", len(b))
+	}
+	var hash uint64
+	for _, v := range b {
+		hash = hash<<8 | uint64(v)
+	}
+	return NewImageHash(hash, kind), nil
+}
+
+func (h *ImageHash) combine(other *ImageHash, op func(l, r uint64) uint64) (*ImageHash, error) {
+	if other == nil {
+		return nil, errNoOther
+	}
+	if h.GetKind() != other.GetKind() {
+		return nil, errKindMismatch
+	}
+	return NewImageHash(op(h.hash, other.hash), h.kind), nil
+}
+
+// Xor method returns the bitwise XOR of two hashes of the same kind.
+func (h *ImageHash) Xor(other *ImageHash) (*ImageHash, error) {
+	return h.combine(other, func(l, r uint64) uint64 { return l ^ r })
+}
+
+// And method returns the bitwise AND of two hashes of the same kind.
+func (h *ImageHash) And(other *ImageHash) (*ImageHash, error) {
+	return h.combine(other, func(l, r uint64) uint64 { return l & r })
+}
+
+// Or method returns the bitwise OR of two hashes of the same kind.
+func (h *ImageHash) Or(other *ImageHash) (*ImageHash, error) {
+	return h.combine(other, func(l, r uint64) uint64 { return l | r })
+}
+
+// Not method returns the bitwise complement of the hash.
+func (h *ImageHash) Not() *ImageHash {
+	return NewImageHash(^h.hash, h.kind)
+}
+
+// Slice method returns bits [start, end) of the hash as an extended hash.
+func (h *ImageHash) Slice(start, end int) (*ExtImageHash, error) {
+	return h.ToExtImageHash().Slice(start, end)
+}
+
+// ToExtImageHash method returns the hash as a 64 bits extended hash.
+func (h *ImageHash) ToExtImageHash() *ExtImageHash {
+	return NewExtImageHashWithSize([]uint64{h.hash}, h.kind, 64, 8, 8)
+}
+
+func (h *ExtImageHash) bitPos(i int) (int, uint) {
+	checkBitIndex(i, h.bits)
+	return i / 64, uint(63 - i%64)
+}
+
+// Bit method returns the i-th bit of the hash.
+// It panics if i is not in [0, Bits()).
+func (h *ExtImageHash) Bit(i int) bool {
+	word, pos := h.bitPos(i)
+	return h.hash[word]>>pos&1 == 1
+}
+
+// SetBit method sets the i-th bit of the hash to v.
+// It panics if i is not in [0, Bits()).
+func (h *ExtImageHash) SetBit(i int, v bool) {
+	word, pos := h.bitPos(i)
+	if v {
+		h.hash[word] |= 1 << pos
+	} else {
+		h.hash[word] &^= 1 << pos
+	}
+}
+
+// Bytes method returns the hash as (Bits()+7)/8 bytes in MSBFirst order.
+// Unused trailing bits are zero.
+func (h *ExtImageHash) Bytes() []byte {
+	return h.EncodeBytes(MSBFirst)
+}
+
+// EncodeBytes method returns the hash as (Bits()+7)/8 bytes packed in the
+// given bit order. Unused trailing bits are zero.
+func (h *ExtImageHash) EncodeBytes(order BitOrder) []byte {
+	b := make([]byte, (h.bits+7)/8)
+	for i := 0; i < h.bits; i++ {
+		if h.Bit(i) {
+			b[i/8] |= 1 << bytePos(i, order)
+		}
+	}
+	return b
+}
+
+// ExtImageHashFromBytes function creates an extended hash of the given bit
+// size from the bytes returned by ExtImageHash.Bytes.
+func ExtImageHashFromBytes(b []byte, kind Kind, bits int) (*ExtImageHash, error) {
+	return DecodeExtImageHash(b, MSBFirst, kind, bits)
+}
+
+// DecodeExtImageHash function creates an extended hash of the given bit size
+// from bytes packed in the given bit order. Unused trailing bits must be zero.
+func DecodeExtImageHash(b []byte, order BitOrder, kind Kind, bits int) (*ExtImageHash, error) {
+	if bits <= 0 {
+		return nil, fmt.Errorf("invalid hash bit size %d", bits)
+	}
+	if len(b) != (bits+7)/8 {
+		return nil, fmt.Errorf("%d bits hash should be %d bytes but got %d", bits, (bits+7)/8, len(b))
+	}
+	h := NewExtImageHash(make([]uint64, wordsFor(bits)), kind, bits)
+	for i := 0; i < len(b)*8; i++ {
+		if b[i/8]>>bytePos(i, order)&1 == 0 {
+			continue
+		}
+		if i >= bits {
+			return nil, errors.New("unused trailing bits of hash should be zero")
+		}
+		h.SetBit(i, true)
+	}
+	return h, nil
+}
+
+func bytePos(i int, order BitOrder) uint {
+	if order == LSBFirst {
+		return uint(i % 8)
+	}
+	return uint(7 - i%8)
+}
+
+func (h *ExtImageHash) combine(other *ExtImageHash, op func(l, r uint64) uint64) (*ExtImageHash, error) {
+	if other == nil {
+		return nil, errNoOther
+	}
+	if h.GetKind() != other.GetKind() {
+		return nil, errKindMismatch
+	}
+	if h.Bits() != other.Bits() || len(h.hash) != len(other.hash) {
+		return nil, errBitsMismatch
+	}
+	hash := make([]uint64, len(h.hash))
+	for idx, lh := range h.hash {
+		hash[idx] = op(lh, other.hash[idx])
+	}
+	return NewExtImageHashWithSize(hash, h.kind, h.bits, h.width, h.height), nil
+}
+
+// Xor method returns the bitwise XOR of two hashes of the same kind and size.
+func (h *ExtImageHash) Xor(other *ExtImageHash) (*ExtImageHash, error) {
+	return h.combine(other, func(l, r uint64) uint64 { return l ^ r })
+}
+
+// And method returns the bitwise AND of two hashes of the same kind and size.
+func (h *ExtImageHash) And(other *ExtImageHash) (*ExtImageHash, error) {
+	return h.combine(other, func(l, r uint64) uint64 { return l & r })
+}
+
+// Or method returns the bitwise OR of two hashes of the same kind and size.
+func (h *ExtImageHash) Or(other *ExtImageHash) (*ExtImageHash, error) {
+	return h.combine(other, func(l, r uint64) uint64 { return l | r })
+}
+
+// Not method returns the bitwise complement of the hash.
+// Unused trailing bits of the last word stay zero.
+func (h *ExtImageHash) Not() *ExtImageHash {
+	n := NewExtImageHashWithSize(make([]uint64, wordsFor(h.bits)), h.kind, h.bits, h.width, h.height)
+	for i := 0; i < h.bits; i++ {
+		if !h.Bit(i) {
+			n.SetBit(i, true)
+		}
+	}
+	return n
+}
+
+// Slice method returns bits [start, end) of the hash as a new hash of the
+// same kind.
+func (h *ExtImageHash) Slice(start, end int) (*ExtImageHash, error) {
+	if start < 0 || end > h.bits || start >= end {
+		return nil, fmt.Errorf("invalid slice [%d:%d] of %d bits hash", start, end, h.bits)
+	}
+	s := NewExtImageHash(make([]uint64, wordsFor(end-start)), h.kind, end-start)
+	for i := start; i < end; i++ {
+		if h.Bit(i) {
+			s.SetBit(i-start, true)
+		}
+	}
+	return s, nil
+}
+
+// Concat method returns a hash holding the bits of h followed by the bits of
+// other. The result keeps the kind when both kinds are identical and is
+// Unknown otherwise.
+func (h *ExtImageHash) Concat(other *ExtImageHash) (*ExtImageHash, error) {
+	if other == nil {
+		return nil, errNoOther
+	}
+	kind := h.kind
+	if kind != other.kind {
+		kind = Unknown
+	}
+	bits := h.bits + other.bits
+	c := NewExtImageHash(make([]uint64, wordsFor(bits)), kind, bits)
+	for i := 0; i < h.bits; i++ {
+		if h.Bit(i) {
+			c.SetBit(i, true)
+		}
+	}
+	for i := 0; i < other.bits; i++ {
+		if other.Bit(i) {
+			c.SetBit(h.bits+i, true)
+		}
+	}
+	return c, nil
+}
@@ -0,0 +1,210 @@
+// Copyright 2017 The goimagehash Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package goimagehash
+
+import (
+	"bytes"
+	"image"
+	"os"
+	"testing"
+)
+
+func TestImageHashBits(t *testing.T) {
+	hash := NewImageHash(0, AHash)
+	hash.SetBit(0, true)
+	hash.SetBit(63, true)
+	if hash.GetHash() != 0x8000000000000001 {
+		t.Errorf("SetBit should set MSB first, got %016x", hash.GetHash())
+	}
+	if !hash.Bit(0) || !hash.Bit(63) || hash.Bit(1) {
+		t.Errorf("Bit returned wrong values for %016x", hash.GetHash())
+	}
+	hash.SetBit(0, false)
+	if hash.Bit(0) {
+		t.Errorf("SetBit(0, false) should clear bit 0")
+	}
+
+	b := hash.Bytes()
+	if !bytes.Equal(b, []byte{0, 0, 0, 0, 0, 0, 0, 1}) {
+		t.Errorf("Unexpected bytes %v", b)
+	}
+	reHash, err := ImageHashFromBytes(b, AHash)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if reHash.GetHash() != hash.GetHash() || reHash.GetKind() != AHash {
+		t.Errorf("Expected %v but got %v", hash, reHash)
+	}
+	if _, err := ImageHashFromBytes(b[:7], AHash); err == nil {
+		t.Errorf("Should got error for short bytes")
+	}
+}
+
+func TestImageHashAlgebra(t *testing.T) {
+	h1 := NewImageHash(0xf0f0, PHash)
+	h2 := NewImageHash(0xff00, PHash)
+
+	for _, tt := range []struct {
+		name     string
+		op       func(*ImageHash) (*ImageHash, error)
+		expected uint64
+	}{
+		{"Xor", h1.Xor, 0x0ff0},
+		{"And", h1.And, 0xf000},
+		{"Or", h1.Or, 0xfff0},
+	} {
+		res, err := tt.op(h2)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if res.GetHash() != tt.expected || res.GetKind() != PHash {
+			t.Errorf("%s: expected %x but got %x", tt.name, tt.expected, res.GetHash())
+		}
+		if _, err := tt.op(NewImageHash(0, AHash)); err == nil {
+			t.Errorf("%s: should got error with different kinds of hashes", tt.name)
+		}
+		if _, err := tt.op(nil); err != errNoOther {
+			t.Errorf("%s: expected err %v, actual %v", tt.name, errNoOther, err)
+		}
+	}
+
+	if h1.Not().GetHash() != ^uint64(0xf0f0) {
+		t.Errorf("Not returned %x", h1.Not().GetHash())
+	}
+
+	xor, _ := h1.Xor(h2)
+	distance, _ := h1.Distance(h2)
+	if popcnt(xor.GetHash()) != distance {
+		t.Errorf("Popcount of xor should equal distance %d", distance)
+	}
+
+	s, err := h1.Slice(48, 64)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if s.Bits() != 16 || s.GetHash()[0] != 0xf0f0<<48 {
+		t.Errorf("Unexpected slice %v", s)
+	}
+}
+
+func TestExtImageHashBitOrder(t *testing.T) {
+	file, err := os.Open("_examples/sample1.jpg")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer file.Close()
+	img, _, err := image.Decode(file)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	// Logical bits of the 64 bits extended hashes match the standard ones.
+	hash, _ := AverageHash(img)
+	extHash, _ := ExtAverageHash(img, 8, 8)
+	for i := 0; i < 64; i++ {
+		if hash.Bit(i) != extHash.Bit(i) {
+			t.Errorf("Bit %d differs between AverageHash and ExtAverageHash", i)
+		}
+	}
+	if !bytes.Equal(hash.Bytes(), extHash.Bytes()) {
+		t.Errorf("Bytes differ between AverageHash and ExtAverageHash")
+	}
+
+	// DoubleGradientHash packs MSB first like the other kinds.
+	dg, _ := DoubleGradientHash(img, 8, 8)
+	for i := 0; i < dg.Bits(); i++ {
+		if dg.Bit(i) != (dg.GetHash()[i/64]>>uint(63-i%64)&1 == 1) {
+			t.Errorf("DGHash bit %d should be stored MSB first", i)
+		}
+	}
+
+	for _, h := range []*ExtImageHash{extHash, dg} {
+		reHash, err := ExtImageHashFromBytes(h.Bytes(), h.GetKind(), h.Bits())
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		distance, err := h.Distance(reHash)
+		if err != nil || distance != 0 {
+			t.Errorf("Bytes round trip failed: distance=%d, err=%v", distance, err)
+		}
+	}
+}
+
+func TestExtImageHashAlgebra(t *testing.T) {
+	for _, kind := range []Kind{AHash, DGHash} {
+		h := NewExtImageHash(make([]uint64, 2), kind, 100)
+		h.SetBit(0, true)
+		h.SetBit(70, true)
+		h.SetBit(99, true)
+
+		not := h.Not()
+		distance, err := h.Distance(not)
+		if err != nil || distance != 100 {
+			t.Errorf("Distance to complement should be 100 but got %d, %v", distance, err)
+		}
+		if not.Bit(0) || !not.Bit(1) {
+			t.Errorf("Not returned wrong bits")
+		}
+
+		xor, err := h.Xor(not)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		ones := 0
+		for i := 0; i < xor.Bits(); i++ {
+			if xor.Bit(i) {
+				ones++
+			}
+		}
+		if ones != 100 {
+			t.Errorf("Xor with complement should set every bit, got %d", ones)
+		}
+		and, _ := h.And(not)
+		or, _ := h.Or(not)
+		if d, _ := and.Distance(NewExtImageHash(make([]uint64, 2), kind, 100)); d != 0 {
+			t.Errorf("And with complement should be zero")
+		}
+		if d, _ := or.Distance(xor); d != 0 {
+			t.Errorf("Or with complement should equal xor")
+		}
+
+		if _, err := h.Xor(NewExtImageHash(make([]uint64, 2), kind, 128)); err == nil {
+			t.Errorf("Should got error with different bits of hashes")
+		}
+
+		s, err := h.Slice(60, 100)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		if s.Bits() != 40 || s.GetKind() != kind || !s.Bit(10) || !s.Bit(39) || s.Bit(0) {
+			t.Errorf("Unexpected slice of %v", kind)
+		}
+		if _, err := h.Slice(10, 101); err == nil {
+			t.Errorf("Should got error for out of range slice")
+		}
+
+		c, err := s.Concat(h)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		if c.Bits() != 140 || c.GetKind() != kind || !c.Bit(10) || !c.Bit(40) || !c.Bit(139) {
+			t.Errorf("Unexpected concat of %v", kind)
+		}
+		mixed, _ := c.Concat(NewExtImageHash([]uint64{1}, PHash, 64))
+		if mixed.GetKind() != Unknown || !mixed.Bit(203) {
+			t.Errorf("Concat of different kinds should be Unknown")
+		}
+	}
+}
+
+func TestBitIndexPanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Bit should panic for out of range index")
+		}
+	}()
+	NewExtImageHash(make([]uint64, 1), AHash, 10).Bit(10)
+}
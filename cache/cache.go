@@ -0,0 +1,356 @@
+// Copyright 2017 The goimagehash Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cache
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/lollipopkit/goimagehash"
+)
+
+// Key identifies the content of a file.
+type Key struct {
+	// Path is the absolute path of the file, or another identifier of a
+	// file that is not on disk such as an archive entry.
+	Path    string
+	Size    int64
+	ModTime time.Time
+	// SHA256 is the hex encoded SHA-256 of the content. It is only set,
+	// and only compared, when the cache is keyed by content.
+	SHA256 string
+}
+
+// Version is the version of the hashes and of the entries of the cache. It
+// is bumped whenever an algorithm computes different hashes or the entry
+// format changes; entries of another version are dropped on load, so that
+// their files miss.
+const Version = 1
+
+// entry is the cached hashes of a file, stored as one JSON line.
+type entry struct {
+	Version int                                  `json:"version"`
+	Path    string                               `json:"path"`
+	Size    int64                                `json:"size"`
+	ModTime time.Time                            `json:"mtime"`
+	SHA256  string                               `json:"sha256,omitempty"`
+	Hashes  map[string]*goimagehash.ExtImageHash `json:"hashes"`
+}
+
+// totals is the first line of the cache file: the hits and misses of every
+// run that saved the cache.
+type totals struct {
+	Hits   int `json:"total_hits"`
+	Misses int `json:"total_misses"`
+}
+
+// Stats holds the size of a cache, its hits and misses since it was opened
+// and their totals over every run that saved it.
+type Stats struct {
+	Files       int `json:"files"`
+	Hashes      int `json:"hashes"`
+	Hits        int `json:"hits"`
+	Misses      int `json:"misses"`
+	TotalHits   int `json:"total_hits"`
+	TotalMisses int `json:"total_misses"`
+}
+
+// Cache maps files to their hashes. A Cache is safe for concurrent use.
+type Cache struct {
+	path      string
+	byContent bool
+
+	mu       sync.Mutex
+	entries  map[string]*entry
+	contents map[string]*entry
+	dirty    bool
+	hits     int
+	misses   int
+	// totals are the hits and misses saved in the file when it was opened.
+	totals totals
+}
+
+// Open function loads the cache stored at path, or returns an empty cache
+// when the file does not exist. With byContent, files are identified by
+// the SHA-256 of their content, so that renamed or copied files still hit
+// the cache at the cost of reading every file. Entries of another Version
+// are dropped.
+func Open(path string, byContent bool) (*Cache, error) {
+	c := &Cache{
+		path:      path,
+		byContent: byContent,
+		entries:   make(map[string]*entry),
+		contents:  make(map[string]*entry),
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; sc.Scan(); line++ {
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+		if line == 1 && bytes.HasPrefix(sc.Bytes(), []byte(`{"total_hits"`)) {
+			if err := json.Unmarshal(sc.Bytes(), &c.totals); err != nil {
+				return nil, fmt.Errorf("%s: line %d: %w", path, line, err)
+			}
+			continue
+		}
+		e := new(entry)
+		if err := json.Unmarshal(sc.Bytes(), e); err != nil {
+			return nil, fmt.Errorf("%s: line %d: %w", path, line, err)
+		}
+		if e.Version != Version {
+			c.dirty = true
+			continue
+		}
+		if e.Hashes == nil {
+			e.Hashes = make(map[string]*goimagehash.ExtImageHash)
+		}
+		c.add(e)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return c, nil
+}
+
+// Path method returns the file the cache is stored in.
+func (c *Cache) Path() string {
+	return c.path
+}
+
+// add stores e, replacing the entry of the same path. The caller must hold
+// mu unless c is not shared yet.
+func (c *Cache) add(e *entry) {
+	if old, ok := c.entries[e.Path]; ok && old.SHA256 != "" && c.contents[old.SHA256] == old {
+		delete(c.contents, old.SHA256)
+	}
+	c.entries[e.Path] = e
+	if e.SHA256 != "" {
+		c.contents[e.SHA256] = e
+	}
+}
+
+// FileKey method returns the key of the file at path, reading its content
+// when the cache is keyed by content. The path of the key is absolute, so
+// that the cache does not depend on the working directory.
+func (c *Cache) FileKey(path string) (Key, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return Key{}, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return Key{}, err
+	}
+	k := Key{Path: path, Size: info.Size(), ModTime: info.ModTime()}
+	if !c.byContent {
+		return k, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return Key{}, err
+	}
+	defer f.Close()
+	if k.SHA256, err = ContentSHA256(f); err != nil {
+		return Key{}, err
+	}
+	return k, nil
+}
+
+// ByContent method reports whether files are identified by their content.
+func (c *Cache) ByContent() bool {
+	return c.byContent
+}
+
+// ContentSHA256 function returns the hex encoded SHA-256 of the content of r.
+func ContentSHA256(r io.Reader) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// lookup returns the entry matching k. The caller must hold mu.
+func (c *Cache) lookup(k Key) *entry {
+	if c.byContent {
+		if k.SHA256 == "" {
+			return nil
+		}
+		return c.contents[k.SHA256]
+	}
+	e, ok := c.entries[k.Path]
+	if !ok || e.Size != k.Size || !e.ModTime.Equal(k.ModTime) {
+		return nil
+	}
+	return e
+}
+
+// Get method returns the hash cached for the file k with the algorithm a,
+// and counts a hit or a miss.
+func (c *Cache) Get(k Key, a goimagehash.Algorithm) (*goimagehash.ExtImageHash, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e := c.lookup(k); e != nil {
+		if h, ok := e.Hashes[a.String()]; ok {
+			c.hits++
+			return h, true
+		}
+	}
+	c.misses++
+	return nil, false
+}
+
+// Put method caches the hash of the file k computed with the algorithm a.
+// Hashes cached for an older version of the file are dropped.
+func (c *Cache) Put(k Key, a goimagehash.Algorithm, h *goimagehash.ExtImageHash) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[k.Path]
+	if !ok || e.Size != k.Size || !e.ModTime.Equal(k.ModTime) || (c.byContent && e.SHA256 != k.SHA256) {
+		e = &entry{
+			Version: Version,
+			Path:    k.Path,
+			Size:    k.Size,
+			ModTime: k.ModTime,
+			SHA256:  k.SHA256,
+			Hashes:  make(map[string]*goimagehash.ExtImageHash),
+		}
+		c.add(e)
+	}
+	e.Hashes[a.String()] = h
+	c.dirty = true
+}
+
+// Prune method removes the files for which keep returns false and returns
+// how many were removed.
+func (c *Cache) Prune(keep func(k Key) bool) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	removed := 0
+	for path, e := range c.entries {
+		if keep(Key{Path: e.Path, Size: e.Size, ModTime: e.ModTime, SHA256: e.SHA256}) {
+			continue
+		}
+		delete(c.entries, path)
+		if e.SHA256 != "" && c.contents[e.SHA256] == e {
+			delete(c.contents, e.SHA256)
+		}
+		removed++
+	}
+	if removed > 0 {
+		c.dirty = true
+	}
+	return removed
+}
+
+// Unchanged function reports whether the file of k still has the size and
+// the modification time of k. It can be passed to Prune to drop deleted and
+// modified files.
+func Unchanged(k Key) bool {
+	info, err := os.Stat(k.Path)
+	return err == nil && info.Size() == k.Size && info.ModTime().Equal(k.ModTime)
+}
+
+// Clear method removes every file from the cache and resets its hits and
+// misses.
+func (c *Cache) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = make(map[string]*entry)
+	c.contents = make(map[string]*entry)
+	c.totals, c.hits, c.misses = totals{}, 0, 0
+	c.dirty = true
+}
+
+// Stats method returns the number of cached files and hashes, the hits and
+// misses of Get since the cache was opened, and their totals including the
+// runs that saved the cache before.
+func (c *Cache) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := Stats{
+		Files:       len(c.entries),
+		Hits:        c.hits,
+		Misses:      c.misses,
+		TotalHits:   c.totals.Hits + c.hits,
+		TotalMisses: c.totals.Misses + c.misses,
+	}
+	for _, e := range c.entries {
+		s.Hashes += len(e.Hashes)
+	}
+	return s
+}
+
+// Save method writes the cache to its file if it changed or was used since
+// it was opened, along with the totals of its hits and misses. The file is
+// replaced atomically and its directory is created when missing.
+func (c *Cache) Save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.dirty && c.hits == 0 && c.misses == 0 {
+		return nil
+	}
+	dir := filepath.Dir(c.path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(c.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	paths := make([]string, 0, len(c.entries))
+	for path := range c.entries {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	w := bufio.NewWriter(tmp)
+	enc := json.NewEncoder(w)
+	t := totals{Hits: c.totals.Hits + c.hits, Misses: c.totals.Misses + c.misses}
+	if err := enc.Encode(t); err != nil {
+		tmp.Close()
+		return err
+	}
+	for _, path := range paths {
+		if err := enc.Encode(c.entries[path]); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), c.path); err != nil {
+		return err
+	}
+	c.dirty = false
+	return nil
+}
@@ -0,0 +1,187 @@
+// Copyright 2017 The goimagehash Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cache
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lollipopkit/goimagehash"
+)
+
+var (
+	phash   = goimagehash.Algorithm{Kind: goimagehash.PHash, Width: 8, Height: 8}
+	phash16 = goimagehash.Algorithm{Kind: goimagehash.PHash, Width: 16, Height: 16}
+)
+
+func writeFile(t *testing.T, path, content string, modTime time.Time) {
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("%v", err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatalf("%v", err)
+	}
+}
+
+func TestCache(t *testing.T) {
+	dir := t.TempDir()
+	img := filepath.Join(dir, "a.jpg")
+	modTime := time.Date(2020, 1, 2, 3, 4, 5, 6000, time.UTC)
+	writeFile(t, img, "first", modTime)
+	store := filepath.Join(dir, "cache", "hashes.jsonl")
+	hash := goimagehash.NewExtImageHash([]uint64{0x1234}, goimagehash.PHash, 64)
+
+	c, err := Open(store, false)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	k, err := c.FileKey(img)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if _, ok := c.Get(k, phash); ok {
+		t.Errorf("Should miss an empty cache")
+	}
+	c.Put(k, phash, hash)
+	if err := c.Save(); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	c, err = Open(store, false)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	k, _ = c.FileKey(img)
+	if h, ok := c.Get(k, phash); !ok || h.String() != hash.String() {
+		t.Errorf("Expected a hit with %s but got %v, %v", hash, h, ok)
+	}
+	if _, ok := c.Get(k, phash16); ok {
+		t.Errorf("Should miss another algorithm size")
+	}
+	// The totals include the miss of the first run.
+	if s := c.Stats(); s != (Stats{Files: 1, Hashes: 1, Hits: 1, Misses: 1, TotalHits: 1, TotalMisses: 2}) {
+		t.Errorf("Unexpected stats %+v", s)
+	}
+
+	// A modified file misses and its old hashes are dropped.
+	writeFile(t, img, "second", modTime.Add(time.Second))
+	k, _ = c.FileKey(img)
+	if _, ok := c.Get(k, phash); ok {
+		t.Errorf("Should miss a modified file")
+	}
+	c.Put(k, phash16, hash)
+	if s := c.Stats(); s.Files != 1 || s.Hashes != 1 {
+		t.Errorf("Expected the old hashes to be dropped but got %+v", s)
+	}
+
+	os.Remove(img)
+	if n := c.Prune(Unchanged); n != 1 || c.Stats().Files != 0 {
+		t.Errorf("Expected 1 pruned file but got %d", n)
+	}
+}
+
+func TestCacheVersion(t *testing.T) {
+	dir := t.TempDir()
+	img := filepath.Join(dir, "a.jpg")
+	modTime := time.Unix(1000, 0).UTC()
+	writeFile(t, img, "content", modTime)
+	store := filepath.Join(dir, "hashes.jsonl")
+	entry := fmt.Sprintf(`{"version":%%d,"path":%q,"size":7,"mtime":%q,"hashes":{"perception:8x8":{"kind":"p","bits":64,"hash":"0000000000001234"}}}`, img, modTime.Format(time.RFC3339))
+
+	for _, tt := range []struct {
+		version int
+		hit     bool
+	}{
+		{Version, true},
+		{Version + 1, false},
+		{0, false},
+	} {
+		data := `{"total_hits":3,"total_misses":4}` + "\n" + fmt.Sprintf(entry, tt.version) + "\n"
+		if tt.version == 0 {
+			// Entries written before versions were added have none.
+			data = strings.Replace(data, `"version":0,`, "", 1)
+		}
+		if err := os.WriteFile(store, []byte(data), 0644); err != nil {
+			t.Fatalf("%v", err)
+		}
+		c, err := Open(store, false)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		k, _ := c.FileKey(img)
+		if _, ok := c.Get(k, phash); ok != tt.hit {
+			t.Errorf("Version %d: expected hit %v but got %v", tt.version, tt.hit, ok)
+		}
+		s := c.Stats()
+		if tt.hit && (s.TotalHits != 4 || s.TotalMisses != 4) || !tt.hit && (s.Files != 0 || s.TotalMisses != 5) {
+			t.Errorf("Version %d: unexpected stats %+v", tt.version, s)
+		}
+	}
+
+	// The totals are saved with the cache.
+	c, _ := Open(store, false)
+	c.Get(Key{Path: img}, phash)
+	if err := c.Save(); err != nil {
+		t.Fatalf("%v", err)
+	}
+	if c, err := Open(store, false); err != nil || c.Stats().TotalMisses != 5 || c.Stats().Files != 0 {
+		t.Errorf("Expected saved totals and no stale entry but got %+v, %v", c.Stats(), err)
+	}
+}
+
+func TestCacheByContent(t *testing.T) {
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a.jpg"), filepath.Join(dir, "b.jpg")
+	writeFile(t, a, "same", time.Unix(1000, 0))
+	writeFile(t, b, "same", time.Unix(2000, 0))
+	hash := goimagehash.NewExtImageHash([]uint64{42}, goimagehash.PHash, 64)
+
+	c, err := Open(filepath.Join(dir, "cache.jsonl"), true)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	ka, err := c.FileKey(a)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if ka.SHA256 == "" {
+		t.Fatalf("Expected the content hash in the key")
+	}
+	c.Put(ka, phash, hash)
+	kb, _ := c.FileKey(b)
+	if h, ok := c.Get(kb, phash); !ok || h.String() != hash.String() {
+		t.Errorf("Expected a copy to hit the cache")
+	}
+
+	// Touching a file keyed by content does not invalidate it, changing
+	// its content does.
+	writeFile(t, a, "same", time.Unix(3000, 0))
+	ka, _ = c.FileKey(a)
+	if _, ok := c.Get(ka, phash); !ok {
+		t.Errorf("Should hit a touched file")
+	}
+	writeFile(t, a, "other", time.Unix(3000, 0))
+	ka, _ = c.FileKey(a)
+	if _, ok := c.Get(ka, phash); ok {
+		t.Errorf("Should miss a changed content")
+	}
+
+	c.Clear()
+	if err := c.Save(); err != nil {
+		t.Fatalf("%v", err)
+	}
+	if c, err = Open(filepath.Join(dir, "cache.jsonl"), true); err != nil || c.Stats().Files != 0 {
+		t.Errorf("Expected an empty cache but got %v", err)
+	}
+
+	os.WriteFile(filepath.Join(dir, "bad.jsonl"), []byte("{\n"), 0644)
+	if _, err := Open(filepath.Join(dir, "bad.jsonl"), false); err == nil {
+		t.Errorf("Should got error for a corrupted cache")
+	}
+}
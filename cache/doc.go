@@ -0,0 +1,11 @@
+// Copyright 2017 The goimagehash Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package cache remembers the hashes of image files between runs, so that
+// only new or changed files have to be decoded again. Entries are keyed by
+// path, size and modification time, or by the SHA-256 of the content, and
+// hold one hash per algorithm and size along with the Version of the
+// hashes, so that entries of an older version miss. The cache is stored in
+// a single local file.
+package cache
@@ -0,0 +1,9 @@
+// Copyright 2017 The goimagehash Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package calibrate picks similarity thresholds from labeled image pairs.
+// It computes the distances of every pair with the selected algorithms and
+// reports the ROC curve, its AUC, the equal error rate and the threshold
+// reaching a target false positive rate.
+package calibrate
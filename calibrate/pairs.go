@@ -0,0 +1,139 @@
+// Copyright 2017 The goimagehash Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package calibrate
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Pair is a pair of image paths labeled as the same image or not.
+type Pair struct {
+	A    string
+	B    string
+	Same bool
+}
+
+func parseLabel(s string) (bool, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "same", "similar", "duplicate", "true", "yes", "1":
+		return true, nil
+	case "different", "distinct", "false", "no", "0":
+		return false, nil
+	}
+	return false, fmt.Errorf("invalid pair label %q", s)
+}
+
+// ReadPairs function reads pairs from CSV records of the form
+// "imageA,imageB,label" where label is same or different (also accepted:
+// similar, duplicate, true, yes, 1 and distinct, false, no, 0). A first
+// record whose label is not valid is skipped as a header. Relative paths are
+// resolved against dir.
+func ReadPairs(r io.Reader, dir string) ([]Pair, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	cr.Comment = '#'
+
+	var pairs []Pair
+	for line := 1; ; line++ {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return pairs, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(record) < 3 {
+			return nil, fmt.Errorf("line %d: expected imageA,imageB,label", line)
+		}
+		same, err := parseLabel(record[2])
+		if err != nil {
+			if line == 1 {
+				continue
+			}
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		pairs = append(pairs, Pair{A: resolve(dir, record[0]), B: resolve(dir, record[1]), Same: same})
+	}
+}
+
+func resolve(dir, path string) string {
+	if filepath.IsAbs(path) || dir == "" {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
+
+// ReadPairsFile function reads pairs from a CSV file, resolving relative
+// paths against the directory of the file.
+func ReadPairsFile(path string) ([]Pair, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ReadPairs(file, filepath.Dir(path))
+}
+
+// GroupPairs function builds pairs from a directory of groups: every
+// subdirectory of dir holds the images of one group, and every file directly
+// in dir is a group of its own. Images of the same group are paired as the
+// same image and images of different groups as different images. Only files
+// accepted by match are used, every file when match is nil.
+func GroupPairs(dir string, match func(path string) bool) ([]Pair, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var groups [][]string
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		if !entry.IsDir() {
+			if match == nil || match(path) {
+				groups = append(groups, []string{path})
+			}
+			continue
+		}
+		var group []string
+		err := filepath.WalkDir(path, func(p string, d os.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() && (match == nil || match(p)) {
+				group = append(group, p)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		if len(group) > 0 {
+			sort.Strings(group)
+			groups = append(groups, group)
+		}
+	}
+
+	var pairs []Pair
+	for gi, group := range groups {
+		for i, a := range group {
+			for _, b := range group[i+1:] {
+				pairs = append(pairs, Pair{A: a, B: b, Same: true})
+			}
+			for _, other := range groups[gi+1:] {
+				for _, b := range other {
+					pairs = append(pairs, Pair{A: a, B: b, Same: false})
+				}
+			}
+		}
+	}
+	return pairs, nil
+}
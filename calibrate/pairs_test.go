@@ -0,0 +1,121 @@
+// Copyright 2017 The goimagehash Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package calibrate
+
+import (
+	"image"
+	_ "image/jpeg"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lollipopkit/goimagehash"
+)
+
+func TestReadPairs(t *testing.T) {
+	data := `image_a,image_b,label
+a.jpg, b.jpg, same
+# comment
+/abs/c.jpg,d.jpg,0
+e.jpg,f.jpg,Different
+`
+	pairs, err := ReadPairs(strings.NewReader(data), "dir")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	expected := []Pair{
+		{filepath.Join("dir", "a.jpg"), filepath.Join("dir", "b.jpg"), true},
+		{"/abs/c.jpg", filepath.Join("dir", "d.jpg"), false},
+		{filepath.Join("dir", "e.jpg"), filepath.Join("dir", "f.jpg"), false},
+	}
+	if len(pairs) != len(expected) {
+		t.Fatalf("Expected %d pairs but got %d", len(expected), len(pairs))
+	}
+	for i := range expected {
+		if pairs[i] != expected[i] {
+			t.Errorf("Expected %v but got %v", expected[i], pairs[i])
+		}
+	}
+
+	for _, bad := range []string{"a.jpg,b.jpg,same\nc.jpg,d.jpg,maybe\n", "a.jpg,b.jpg\n"} {
+		if _, err := ReadPairs(strings.NewReader(bad), ""); err == nil {
+			t.Errorf("Should got error for %q", bad)
+		}
+	}
+}
+
+func TestGroupPairs(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"g1/a.jpg", "g1/b.jpg", "g2/c.jpg", "g2/sub/d.jpg", "e.jpg", "notes.txt"} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("%v", err)
+		}
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}
+
+	pairs, err := GroupPairs(dir, func(path string) bool { return filepath.Ext(path) == ".jpg" })
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	same, different := 0, 0
+	for _, p := range pairs {
+		if p.Same {
+			same++
+			if filepath.Dir(p.A) == dir {
+				t.Errorf("Top level files should not be paired as same: %v", p)
+			}
+		} else {
+			different++
+		}
+	}
+	// Groups {e}, {a, b} and {c, d}: 2 same pairs and 8 different pairs.
+	if same != 2 || different != 8 {
+		t.Errorf("Expected 2 same and 8 different pairs but got %d and %d", same, different)
+	}
+}
+
+func TestRun(t *testing.T) {
+	load := func(path string) (image.Image, error) {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		img, _, err := image.Decode(file)
+		return img, err
+	}
+
+	pairs, err := ReadPairs(strings.NewReader(`sample1.jpg,sample3.jpg,same
+sample2.jpg,sample4.jpg,same
+sample1.jpg,sample2.jpg,different
+sample1.jpg,sample4.jpg,different
+sample3.jpg,sample2.jpg,different
+`), "../_examples")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	algorithms := []goimagehash.Algorithm{{Kind: goimagehash.AHash}, {Kind: goimagehash.PHash, Width: 16, Height: 16}}
+	results, err := Run(pairs, algorithms, load, 0)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	for i, res := range results {
+		if res.Algorithm != algorithms[i].String() || res.Bits != algorithms[i].Bits() {
+			t.Errorf("Unexpected result header %s of %d bits", res.Algorithm, res.Bits)
+		}
+		if res.AUC != 1 || res.TPR != 1 {
+			t.Errorf("%s: sample pairs should be separable, got AUC %v and TPR %v", res.Algorithm, res.AUC, res.TPR)
+		}
+	}
+
+	if _, err := Run([]Pair{{"missing.jpg", "missing.jpg", true}}, algorithms, load, 0); err == nil {
+		t.Errorf("Should got error for missing images")
+	}
+}
@@ -0,0 +1,125 @@
+// Copyright 2017 The goimagehash Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package calibrate
+
+import (
+	"math"
+	"sort"
+)
+
+// Sample is the distance between the hashes of two images labeled as the
+// same image or as different images.
+type Sample struct {
+	Distance int
+	Same     bool
+}
+
+// Point is a point of the ROC curve. Pairs at a distance lower than or equal
+// to Threshold are predicted as the same image.
+type Point struct {
+	Threshold int     `json:"threshold"`
+	TPR       float64 `json:"tpr"`
+	FPR       float64 `json:"fpr"`
+}
+
+// Result is the evaluation of an algorithm on a set of samples.
+type Result struct {
+	Algorithm string  `json:"algorithm"`
+	Bits      int     `json:"bits"`
+	Positives int     `json:"positives"`
+	Negatives int     `json:"negatives"`
+	Points    []Point `json:"roc"`
+	AUC       float64 `json:"auc"`
+	// EER is the equal error rate, where the false positive rate equals the
+	// false negative rate, reached at EERThreshold.
+	EER          float64 `json:"eer"`
+	EERThreshold int     `json:"eer_threshold"`
+	// Threshold is the largest threshold whose false positive rate does not
+	// exceed TargetFPR, or -1 when even identical hashes exceed it.
+	TargetFPR float64 `json:"target_fpr"`
+	Threshold int     `json:"threshold"`
+	TPR       float64 `json:"tpr"`
+	FPR       float64 `json:"fpr"`
+}
+
+// Evaluate function computes the ROC curve of samples for every threshold
+// from -1 to bits, and derives the AUC, the EER and the threshold reaching
+// targetFPR from it.
+func Evaluate(samples []Sample, bits int, targetFPR float64) Result {
+	res := Result{Bits: bits, TargetFPR: targetFPR, Threshold: -1}
+
+	maxDistance := bits
+	for _, s := range samples {
+		if s.Distance > maxDistance {
+			maxDistance = s.Distance
+		}
+	}
+	// Count samples per distance so that every threshold is evaluated in
+	// a single pass.
+	same := make([]int, maxDistance+1)
+	diff := make([]int, maxDistance+1)
+	for _, s := range samples {
+		if s.Same {
+			same[s.Distance]++
+			res.Positives++
+		} else {
+			diff[s.Distance]++
+			res.Negatives++
+		}
+	}
+
+	rate := func(n, total int) float64 {
+		if total == 0 {
+			return 0
+		}
+		return float64(n) / float64(total)
+	}
+
+	tp, fp := 0, 0
+	bestGap := math.Inf(1)
+	res.Points = append(res.Points, Point{Threshold: -1})
+	for t := 0; t <= maxDistance; t++ {
+		tp += same[t]
+		fp += diff[t]
+		p := Point{Threshold: t, TPR: rate(tp, res.Positives), FPR: rate(fp, res.Negatives)}
+		res.Points = append(res.Points, p)
+	}
+
+	for _, p := range res.Points {
+		fnr := 1 - p.TPR
+		if gap := math.Abs(p.FPR - fnr); gap < bestGap {
+			bestGap = gap
+			res.EER = (p.FPR + fnr) / 2
+			res.EERThreshold = p.Threshold
+		}
+		if p.FPR <= targetFPR {
+			res.Threshold, res.TPR, res.FPR = p.Threshold, p.TPR, p.FPR
+		}
+	}
+
+	res.AUC = auc(res.Points)
+	return res
+}
+
+// auc returns the area under the ROC curve with the trapezoidal rule.
+func auc(points []Point) float64 {
+	sorted := make([]Point, len(points))
+	copy(sorted, points)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].FPR != sorted[j].FPR {
+			return sorted[i].FPR < sorted[j].FPR
+		}
+		return sorted[i].TPR < sorted[j].TPR
+	})
+	area := 0.0
+	prev := Point{}
+	for _, p := range sorted {
+		area += (p.FPR - prev.FPR) * (p.TPR + prev.TPR) / 2
+		prev = p
+	}
+	// Close the curve at (1, 1).
+	area += (1 - prev.FPR) * (1 + prev.TPR) / 2
+	return area
+}
@@ -0,0 +1,65 @@
+// Copyright 2017 The goimagehash Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package calibrate
+
+import (
+	"math"
+	"testing"
+)
+
+const epsilon = 1e-9
+
+func TestEvaluateSeparable(t *testing.T) {
+	samples := []Sample{
+		{0, true}, {2, true}, {4, true},
+		{10, false}, {20, false}, {30, false}, {40, false},
+	}
+	res := Evaluate(samples, 64, 0)
+	if res.Positives != 3 || res.Negatives != 4 {
+		t.Errorf("Expected 3 positives and 4 negatives but got %d and %d", res.Positives, res.Negatives)
+	}
+	if math.Abs(res.AUC-1) > epsilon {
+		t.Errorf("AUC should be 1 but got %v", res.AUC)
+	}
+	if res.EER != 0 || res.EERThreshold < 4 || res.EERThreshold >= 10 {
+		t.Errorf("EER should be 0 between 4 and 10 but got %v at %d", res.EER, res.EERThreshold)
+	}
+	if res.Threshold != 9 || res.TPR != 1 || res.FPR != 0 {
+		t.Errorf("Expected threshold 9 with TPR 1 and FPR 0 but got %d, %v, %v", res.Threshold, res.TPR, res.FPR)
+	}
+	if len(res.Points) != 66 {
+		t.Errorf("Expected 66 ROC points but got %d", len(res.Points))
+	}
+}
+
+func TestEvaluateOverlapping(t *testing.T) {
+	samples := []Sample{
+		{1, true}, {5, true}, {12, true}, {20, true},
+		{3, false}, {15, false}, {25, false}, {30, false},
+	}
+	res := Evaluate(samples, 32, 0.25)
+	// Thresholds 3 to 14 accept one negative out of four.
+	if res.Threshold != 14 || res.FPR != 0.25 || res.TPR != 0.75 {
+		t.Errorf("Expected threshold 14 with TPR 0.75 and FPR 0.25 but got %d, %v, %v", res.Threshold, res.TPR, res.FPR)
+	}
+	if math.Abs(res.EER-0.25) > epsilon {
+		t.Errorf("EER should be 0.25 but got %v", res.EER)
+	}
+	// 12 of the 16 positive/negative pairs are ordered correctly.
+	if math.Abs(res.AUC-12.0/16) > epsilon {
+		t.Errorf("AUC should be %v but got %v", 12.0/16, res.AUC)
+	}
+
+	if res := Evaluate(samples, 32, -1); res.Threshold != -1 {
+		t.Errorf("Threshold should be -1 when no threshold reaches the target but got %d", res.Threshold)
+	}
+}
+
+func TestEvaluateEmpty(t *testing.T) {
+	res := Evaluate(nil, 64, 0.01)
+	if res.Positives != 0 || res.Negatives != 0 || len(res.Points) != 66 {
+		t.Errorf("Unexpected result for no samples: %+v", res)
+	}
+}
@@ -0,0 +1,64 @@
+// Copyright 2017 The goimagehash Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package calibrate
+
+import (
+	"fmt"
+	"image"
+
+	"github.com/lollipopkit/goimagehash"
+)
+
+// Loader returns the decoded image stored at path.
+type Loader func(path string) (image.Image, error)
+
+// Run function hashes the images of pairs with every algorithm and evaluates
+// the distances of the pairs per algorithm. Every image is decoded once.
+func Run(pairs []Pair, algorithms []goimagehash.Algorithm, load Loader, targetFPR float64) ([]Result, error) {
+	hashes := make(map[string][]*goimagehash.ExtImageHash)
+	hashImage := func(path string) ([]*goimagehash.ExtImageHash, error) {
+		if h, ok := hashes[path]; ok {
+			return h, nil
+		}
+		img, err := load(path)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		h := make([]*goimagehash.ExtImageHash, len(algorithms))
+		for i, a := range algorithms {
+			if h[i], err = a.Hash(img); err != nil {
+				return nil, fmt.Errorf("%s: %v", path, err)
+			}
+		}
+		hashes[path] = h
+		return h, nil
+	}
+
+	samples := make([][]Sample, len(algorithms))
+	for _, pair := range pairs {
+		ha, err := hashImage(pair.A)
+		if err != nil {
+			return nil, err
+		}
+		hb, err := hashImage(pair.B)
+		if err != nil {
+			return nil, err
+		}
+		for i := range algorithms {
+			distance, err := ha[i].Distance(hb[i])
+			if err != nil {
+				return nil, err
+			}
+			samples[i] = append(samples[i], Sample{Distance: distance, Same: pair.Same})
+		}
+	}
+
+	results := make([]Result, len(algorithms))
+	for i, a := range algorithms {
+		results[i] = Evaluate(samples[i], a.Bits(), targetFPR)
+		results[i].Algorithm = a.String()
+	}
+	return results, nil
+}
@@ -0,0 +1,383 @@
+// Copyright 2017 The goimagehash Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cluster
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/lollipopkit/goimagehash"
+	"github.com/lollipopkit/goimagehash/index"
+)
+
+// Method is a clustering method.
+type Method int
+
+const (
+	// Connected puts two hashes in the same cluster when a chain of hashes,
+	// each within the threshold of the next, links them.
+	Connected Method = iota
+	// CompleteLinkage merges the closest clusters first and only while every
+	// pair of hashes of the merged cluster is within the threshold.
+	CompleteLinkage
+	// DBSCAN grows clusters from core hashes having at least MinPoints
+	// hashes within the threshold, themselves included. Other hashes are
+	// noise and form clusters of their own.
+	DBSCAN
+)
+
+var methodNames = []string{"connected", "complete", "dbscan"}
+
+// String method returns the name of the method.
+func (m Method) String() string {
+	if m < 0 || int(m) >= len(methodNames) {
+		return fmt.Sprintf("Method(%d)", int(m))
+	}
+	return methodNames[m]
+}
+
+// ParseMethod function returns the method with the given name.
+func ParseMethod(s string) (Method, error) {
+	for i, name := range methodNames {
+		if strings.EqualFold(s, name) {
+			return Method(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown clustering method %q", s)
+}
+
+// Options configures a clustering.
+type Options struct {
+	Method Method
+	// Threshold is the largest distance between two similar hashes.
+	Threshold int
+	// MinPoints is the neighbourhood size of DBSCAN core hashes.
+	// Values below 2 mean 2.
+	MinPoints int
+}
+
+// Member is a hash of a cluster with its distance to the representative.
+type Member struct {
+	index.Entry
+	Distance int
+}
+
+// Cluster is a group of similar hashes.
+type Cluster struct {
+	// Representative is the member with the smallest sum of distances to the
+	// other members, the smallest identifier winning ties.
+	Representative string
+	// Members are sorted by distance to the representative, then by
+	// identifier; the representative comes first.
+	Members []Member
+	// MaxDistance is the largest distance between two members.
+	MaxDistance int
+	// MeanDistance is the mean distance between two members.
+	MeanDistance float64
+}
+
+// Group function groups entries with the given options. Identifiers must
+// be unique, and hashes of different kinds or bit sizes never share a
+// cluster. Every entry belongs to exactly one cluster; clusters are sorted by
+// size, then by representative.
+func Group(entries []index.Entry, opts Options) ([]Cluster, error) {
+	if opts.Threshold < 0 {
+		return nil, fmt.Errorf("invalid threshold %d", opts.Threshold)
+	}
+	sorted := append([]index.Entry(nil), entries...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].ID < sorted[j].ID })
+
+	idx := index.New()
+	pos := make(map[string]int, len(sorted))
+	for i, e := range sorted {
+		if _, ok := pos[e.ID]; ok {
+			return nil, fmt.Errorf("duplicate identifier %q", e.ID)
+		}
+		if err := idx.Add(e.ID, e.Hash); err != nil {
+			return nil, fmt.Errorf("%s: %v", e.ID, err)
+		}
+		pos[e.ID] = i
+	}
+	neighbours := func(i int) []int {
+		var ns []int
+		for _, m := range idx.Within(sorted[i].Hash, opts.Threshold) {
+			ns = append(ns, pos[m.ID])
+		}
+		return ns
+	}
+
+	var groups [][]int
+	switch opts.Method {
+	case Connected:
+		groups = connected(len(sorted), neighbours)
+	case CompleteLinkage:
+		groups = completeLinkage(sorted, neighbours)
+	case DBSCAN:
+		minPoints := opts.MinPoints
+		if minPoints < 2 {
+			minPoints = 2
+		}
+		groups = dbscan(len(sorted), neighbours, minPoints)
+	default:
+		return nil, fmt.Errorf("unknown clustering method %v", opts.Method)
+	}
+
+	clusters := make([]Cluster, len(groups))
+	for i, g := range groups {
+		members := make([]index.Entry, len(g))
+		for j, p := range g {
+			members[j] = sorted[p]
+		}
+		clusters[i] = describe(members)
+	}
+	sort.Slice(clusters, func(i, j int) bool {
+		if len(clusters[i].Members) != len(clusters[j].Members) {
+			return len(clusters[i].Members) > len(clusters[j].Members)
+		}
+		return clusters[i].Representative < clusters[j].Representative
+	})
+	return clusters, nil
+}
+
+// GroupHashes function groups 64 bits hashes keyed by identifier.
+func GroupHashes(hashes map[string]*goimagehash.ImageHash, opts Options) ([]Cluster, error) {
+	entries := make([]index.Entry, 0, len(hashes))
+	for id, h := range hashes {
+		if h == nil {
+			return nil, fmt.Errorf("%s: hash can not be nil", id)
+		}
+		entries = append(entries, index.Entry{ID: id, Hash: h.ToExtImageHash()})
+	}
+	return Group(entries, opts)
+}
+
+// describe computes the representative and the distances of a cluster.
+func describe(members []index.Entry) Cluster {
+	n := len(members)
+	distances := make([][]int, n)
+	for i := range distances {
+		distances[i] = make([]int, n)
+	}
+	c := Cluster{}
+	total, pairs := 0, 0
+	for i := 0; i < n; i++ {
+		for j := i + 1; j < n; j++ {
+			d, err := members[i].Hash.Distance(members[j].Hash)
+			if err != nil {
+				// Members always share a kind and a bit size.
+				panic(err)
+			}
+			distances[i][j], distances[j][i] = d, d
+			total += d
+			pairs++
+			if d > c.MaxDistance {
+				c.MaxDistance = d
+			}
+		}
+	}
+	if pairs > 0 {
+		c.MeanDistance = float64(total) / float64(pairs)
+	}
+
+	// members are sorted by identifier, so the first minimum wins ties.
+	rep, best := 0, -1
+	for i := 0; i < n; i++ {
+		sum := 0
+		for _, d := range distances[i] {
+			sum += d
+		}
+		if best < 0 || sum < best {
+			rep, best = i, sum
+		}
+	}
+	c.Representative = members[rep].ID
+	for i, e := range members {
+		c.Members = append(c.Members, Member{Entry: e, Distance: distances[rep][i]})
+	}
+	sort.SliceStable(c.Members, func(i, j int) bool {
+		if c.Members[i].ID == c.Representative {
+			return true
+		}
+		if c.Members[j].ID == c.Representative {
+			return false
+		}
+		return c.Members[i].Distance < c.Members[j].Distance
+	})
+	return c
+}
+
+// connected returns the connected components of the neighbour graph with a
+// union-find.
+func connected(n int, neighbours func(int) []int) [][]int {
+	parent := make([]int, n)
+	for i := range parent {
+		parent[i] = i
+	}
+	find := func(i int) int {
+		for parent[i] != i {
+			parent[i] = parent[parent[i]]
+			i = parent[i]
+		}
+		return i
+	}
+	for i := 0; i < n; i++ {
+		for _, j := range neighbours(i) {
+			ri, rj := find(i), find(j)
+			// The smallest position is the root, keeping groups ordered.
+			if ri < rj {
+				parent[rj] = ri
+			} else if rj < ri {
+				parent[ri] = rj
+			}
+		}
+	}
+	groups := make(map[int][]int)
+	var roots []int
+	for i := 0; i < n; i++ {
+		r := find(i)
+		if _, ok := groups[r]; !ok {
+			roots = append(roots, r)
+		}
+		groups[r] = append(groups[r], i)
+	}
+	result := make([][]int, len(roots))
+	for i, r := range roots {
+		result[i] = groups[r]
+	}
+	return result
+}
+
+// completeLinkage merges clusters in increasing order of their largest
+// pairwise distance. Two clusters can only merge when every pair of their
+// members are neighbours, so only neighbour pairs are tracked: link counts
+// them and records their largest distance.
+func completeLinkage(entries []index.Entry, neighbours func(int) []int) [][]int {
+	type link struct{ count, max int }
+	type pair struct{ a, b int }
+	n := len(entries)
+	members := make([][]int, n)
+	for i := range members {
+		members[i] = []int{i}
+	}
+	links := make(map[pair]*link)
+	for i := 0; i < n; i++ {
+		for _, j := range neighbours(i) {
+			if i < j {
+				d, _ := entries[i].Hash.Distance(entries[j].Hash)
+				links[pair{i, j}] = &link{1, d}
+			}
+		}
+	}
+
+	for {
+		// Clusters are named by their smallest position, so ties between
+		// candidate merges resolve the same way for any input order.
+		var best pair
+		var bestLink *link
+		for p, l := range links {
+			if l.count != len(members[p.a])*len(members[p.b]) {
+				continue
+			}
+			if bestLink == nil || l.max < bestLink.max ||
+				(l.max == bestLink.max && (p.a < best.a || (p.a == best.a && p.b < best.b))) {
+				best, bestLink = p, l
+			}
+		}
+		if bestLink == nil {
+			break
+		}
+
+		a, b := best.a, best.b
+		members[a] = append(members[a], members[b]...)
+		sort.Ints(members[a])
+		members[b] = nil
+		delete(links, best)
+		for p, l := range links {
+			if p.a != b && p.b != b {
+				continue
+			}
+			delete(links, p)
+			other := p.a
+			if other == b {
+				other = p.b
+			}
+			key := pair{a, other}
+			if other < a {
+				key = pair{other, a}
+			}
+			if existing, ok := links[key]; ok {
+				existing.count += l.count
+				if l.max > existing.max {
+					existing.max = l.max
+				}
+			} else {
+				links[key] = l
+			}
+		}
+	}
+
+	var groups [][]int
+	for _, m := range members {
+		if m != nil {
+			groups = append(groups, m)
+		}
+	}
+	return groups
+}
+
+// dbscan expands clusters from core points in position order; border points
+// join the first cluster reaching them and noise points stay alone.
+func dbscan(n int, neighbours func(int) []int, minPoints int) [][]int {
+	const unassigned = -1
+	label := make([]int, n)
+	for i := range label {
+		label[i] = unassigned
+	}
+	cache := make(map[int][]int)
+	neighbourhood := func(i int) []int {
+		if ns, ok := cache[i]; ok {
+			return ns
+		}
+		ns := neighbours(i)
+		sort.Ints(ns)
+		cache[i] = ns
+		return ns
+	}
+
+	var groups [][]int
+	for i := 0; i < n; i++ {
+		if label[i] != unassigned || len(neighbourhood(i)) < minPoints {
+			continue
+		}
+		c := len(groups)
+		group := []int{i}
+		label[i] = c
+		queue := []int{i}
+		for len(queue) > 0 {
+			p := queue[0]
+			queue = queue[1:]
+			ns := neighbourhood(p)
+			if len(ns) < minPoints {
+				continue
+			}
+			for _, q := range ns {
+				if label[q] == unassigned {
+					label[q] = c
+					group = append(group, q)
+					queue = append(queue, q)
+				}
+			}
+		}
+		sort.Ints(group)
+		groups = append(groups, group)
+	}
+	for i := 0; i < n; i++ {
+		if label[i] == unassigned {
+			groups = append(groups, []int{i})
+		}
+	}
+	return groups
+}
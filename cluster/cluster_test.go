@@ -0,0 +1,119 @@
+// Copyright 2017 The goimagehash Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cluster
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/lollipopkit/goimagehash"
+	"github.com/lollipopkit/goimagehash/index"
+)
+
+func entry(id string, hash uint64, kind goimagehash.Kind) index.Entry {
+	return index.Entry{ID: id, Hash: goimagehash.NewExtImageHash([]uint64{hash}, kind, 64)}
+}
+
+// chain returns a, b and c where a-b and b-c are at distance 4 and a-c at
+// distance 8, plus a far away hash and a hash of another kind equal to a.
+func chain() []index.Entry {
+	return []index.Entry{
+		entry("a", 0, goimagehash.PHash),
+		entry("b", 0xf, goimagehash.PHash),
+		entry("c", 0xff, goimagehash.PHash),
+		entry("far", ^uint64(0), goimagehash.PHash),
+		entry("other-kind", 0, goimagehash.AHash),
+	}
+}
+
+func summary(clusters []Cluster) string {
+	var s string
+	for _, c := range clusters {
+		s += "["
+		for i, m := range c.Members {
+			if i > 0 {
+				s += " "
+			}
+			s += m.ID
+		}
+		s += "]"
+	}
+	return s
+}
+
+func TestGroup(t *testing.T) {
+	for _, tt := range []struct {
+		opts     Options
+		expected string
+	}{
+		{Options{Method: Connected, Threshold: 5}, "[b a c][far][other-kind]"},
+		{Options{Method: Connected, Threshold: 3}, "[a][b][c][far][other-kind]"},
+		{Options{Method: CompleteLinkage, Threshold: 5}, "[a b][c][far][other-kind]"},
+		{Options{Method: CompleteLinkage, Threshold: 8}, "[b a c][far][other-kind]"},
+		{Options{Method: DBSCAN, Threshold: 5, MinPoints: 3}, "[b a c][far][other-kind]"},
+		{Options{Method: DBSCAN, Threshold: 5, MinPoints: 4}, "[a][b][c][far][other-kind]"},
+	} {
+		entries := chain()
+		for i := 0; i < 5; i++ {
+			clusters, err := Group(entries, tt.opts)
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			if s := summary(clusters); s != tt.expected {
+				t.Errorf("%v(%d): expected %s but got %s", tt.opts.Method, tt.opts.Threshold, tt.expected, s)
+			}
+			// The result must not depend on the input order.
+			rand.New(rand.NewSource(int64(i))).Shuffle(len(entries), func(i, j int) {
+				entries[i], entries[j] = entries[j], entries[i]
+			})
+		}
+	}
+}
+
+func TestClusterStats(t *testing.T) {
+	clusters, err := Group(chain(), Options{Method: Connected, Threshold: 5})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	c := clusters[0]
+	if c.Representative != "b" || c.MaxDistance != 8 || fmt.Sprintf("%.2f", c.MeanDistance) != "5.33" {
+		t.Errorf("Unexpected cluster %+v", c)
+	}
+	for _, m := range c.Members {
+		if expected := map[string]int{"a": 4, "b": 0, "c": 4}[m.ID]; m.Distance != expected {
+			t.Errorf("%s: expected distance %d but got %d", m.ID, expected, m.Distance)
+		}
+	}
+	if clusters[1].MaxDistance != 0 || clusters[1].Members[0].Distance != 0 {
+		t.Errorf("Singleton should have no distances, got %+v", clusters[1])
+	}
+}
+
+func TestGroupErrors(t *testing.T) {
+	entries := append(chain(), entry("a", 1, goimagehash.PHash))
+	if _, err := Group(entries, Options{Threshold: 5}); err == nil {
+		t.Errorf("Should got error for duplicate identifiers")
+	}
+	if _, err := Group(chain(), Options{Threshold: -1}); err == nil {
+		t.Errorf("Should got error for negative threshold")
+	}
+	if _, err := Group(chain(), Options{Method: Method(9)}); err == nil {
+		t.Errorf("Should got error for unknown method")
+	}
+	for _, m := range []Method{Connected, CompleteLinkage, DBSCAN} {
+		parsed, err := ParseMethod(m.String())
+		if err != nil || parsed != m {
+			t.Errorf("ParseMethod(%q) returned %v, %v", m.String(), parsed, err)
+		}
+	}
+	clusters, err := GroupHashes(map[string]*goimagehash.ImageHash{
+		"x": goimagehash.NewImageHash(0, goimagehash.AHash),
+		"y": goimagehash.NewImageHash(1, goimagehash.AHash),
+	}, Options{Threshold: 1})
+	if err != nil || summary(clusters) != "[x y]" {
+		t.Errorf("Unexpected clusters %s, %v", summary(clusters), err)
+	}
+}
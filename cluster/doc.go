@@ -0,0 +1,9 @@
+// Copyright 2017 The goimagehash Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package cluster groups similar image hashes. It offers connected
+// components, complete-linkage and DBSCAN clustering, finds neighbours with
+// the index package and returns clusters that only depend on the input set,
+// not on its order.
+package cluster
@@ -0,0 +1,232 @@
+package commands
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// archiveSeparator separates the path of an archive from the path of an
+// entry inside it in image identifiers, e.g. "photos.zip!/2019/a.jpg".
+const archiveSeparator = "!/"
+
+// isArchive reports whether path names a zip, tar, tar.gz or tgz archive.
+func isArchive(p string) bool {
+	return archiveType(p) != ""
+}
+
+func archiveType(p string) string {
+	lower := strings.ToLower(p)
+	switch {
+	case strings.HasSuffix(lower, ".zip"):
+		return "zip"
+	case strings.HasSuffix(lower, ".tar"):
+		return "tar"
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return "tar.gz"
+	}
+	return ""
+}
+
+// splitArchiveID splits an image identifier into the archive path and the
+// entry path. It reports false for identifiers of plain files.
+func splitArchiveID(id string) (archive, entry string, ok bool) {
+	idx := strings.Index(id, archiveSeparator)
+	if idx < 0 || !isArchive(id[:idx]) {
+		return "", "", false
+	}
+	return id[:idx], id[idx+len(archiveSeparator):], true
+}
+
+// maxEntrySize is the largest archive entry read, in bytes. A small
+// compressed entry may expand to far more, so reading an entry fails with
+// errEntryTooLarge past this size, before it is decoded or kept in memory.
+const maxEntrySize = 256 << 20
+
+// errEntryTooLarge is the error of an archive entry larger than maxEntrySize.
+var errEntryTooLarge = fmt.Errorf("archive entry larger than %d MiB", maxEntrySize>>20)
+
+// entryReader reads an archive entry, failing past maxEntrySize.
+type entryReader struct {
+	r    io.Reader
+	read int64
+}
+
+// newEntryReader returns the reader of the entry e with content r. It fails
+// at once when the size recorded in the archive is too large.
+func newEntryReader(e archiveEntry, r io.Reader) *entryReader {
+	er := &entryReader{r: io.LimitReader(r, maxEntrySize+1)}
+	if e.Size > maxEntrySize {
+		er.read = e.Size
+	}
+	return er
+}
+
+func (er *entryReader) Read(p []byte) (int, error) {
+	if er.read > maxEntrySize {
+		return 0, errEntryTooLarge
+	}
+	n, err := er.r.Read(p)
+	if er.read += int64(n); er.read > maxEntrySize {
+		return 0, errEntryTooLarge
+	}
+	return n, err
+}
+
+// archiveEntry is a regular file of an archive.
+type archiveEntry struct {
+	Name    string
+	Size    int64
+	ModTime time.Time
+}
+
+// walkArchive calls fn with every regular file of the archive, in archive
+// order. fn must not keep r after returning; a non nil error stops the walk.
+// Reading r fails with errEntryTooLarge past maxEntrySize.
+func walkArchive(archive string, fn func(e archiveEntry, r io.Reader) error) error {
+	if archiveType(archive) == "zip" {
+		zr, err := zip.OpenReader(archive)
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+		for _, f := range zr.File {
+			if f.FileInfo().IsDir() {
+				continue
+			}
+			rc, err := f.Open()
+			if err != nil {
+				return fmt.Errorf("%s%s%s: %w", archive, archiveSeparator, f.Name, err)
+			}
+			e := archiveEntry{f.Name, int64(f.UncompressedSize64), f.Modified}
+			err = fn(e, newEntryReader(e, rc))
+			rc.Close()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	file, err := os.Open(archive)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	var r io.Reader = file
+	if archiveType(archive) == "tar.gz" {
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return fmt.Errorf("%s: %w", archive, err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", archive, err)
+		}
+		if hdr.Typeflag != tar.TypeReg && hdr.Typeflag != tar.TypeRegA {
+			continue
+		}
+		e := archiveEntry{hdr.Name, hdr.Size, hdr.ModTime}
+		if err := fn(e, newEntryReader(e, tr)); err != nil {
+			return err
+		}
+	}
+}
+
+// listArchive returns the identifiers of the entries of the archive having
+// one of extensions.
+func listArchive(archive string, extensions []string) ([]string, error) {
+	var ids []string
+	err := walkArchive(archive, func(e archiveEntry, r io.Reader) error {
+		if hasExtension(e.Name, extensions) {
+			ids = append(ids, archive+archiveSeparator+path.Clean(e.Name))
+		}
+		return nil
+	})
+	return ids, err
+}
+
+// errStopWalk stops walkArchive once the wanted entries are read.
+var errStopWalk = fmt.Errorf("stop walking archive")
+
+// readArchiveEntries calls fn with the content of every entry of the archive
+// listed in entries, reading the archive once.
+func readArchiveEntries(archive string, entries []string, fn func(e archiveEntry, r io.Reader)) error {
+	wanted := make(map[string]bool, len(entries))
+	for _, e := range entries {
+		wanted[e] = true
+	}
+	err := walkArchive(archive, func(e archiveEntry, r io.Reader) error {
+		name := path.Clean(e.Name)
+		if !wanted[name] {
+			return nil
+		}
+		delete(wanted, name)
+		fn(e, r)
+		if len(wanted) == 0 {
+			return errStopWalk
+		}
+		return nil
+	})
+	if err == errStopWalk {
+		err = nil
+	}
+	if err == nil && len(wanted) > 0 {
+		for name := range wanted {
+			return fmt.Errorf("%s%s%s: no such entry", archive, archiveSeparator, name)
+		}
+	}
+	return err
+}
+
+// openImageSource returns the content of a file, of an archive entry, or of
+// the standard input for "-", along with its size and modification time
+// when known.
+func openImageSource(id string) (io.ReadCloser, archiveEntry, error) {
+	if id == "-" {
+		return io.NopCloser(os.Stdin), archiveEntry{Name: id}, nil
+	}
+	archive, name, ok := splitArchiveID(id)
+	if !ok {
+		file, err := os.Open(id)
+		if err != nil {
+			return nil, archiveEntry{}, err
+		}
+		info, err := file.Stat()
+		if err != nil {
+			file.Close()
+			return nil, archiveEntry{}, err
+		}
+		return file, archiveEntry{id, info.Size(), info.ModTime()}, nil
+	}
+
+	var content []byte
+	var entry archiveEntry
+	var readErr error
+	err := readArchiveEntries(archive, []string{path.Clean(name)}, func(e archiveEntry, r io.Reader) {
+		entry = e
+		content, readErr = io.ReadAll(r)
+	})
+	if err == nil {
+		err = readErr
+	}
+	if err != nil {
+		return nil, archiveEntry{}, err
+	}
+	return io.NopCloser(bytes.NewReader(content)), entry, nil
+}
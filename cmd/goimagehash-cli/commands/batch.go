@@ -1,37 +1,73 @@
 package commands
 
 import (
-	"encoding/csv"
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
-	_ "image/gif"
-	_ "image/jpeg"
-	_ "image/png"
+	"image"
+	"io"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
 
 	"github.com/lollipopkit/goimagehash"
+	"github.com/lollipopkit/goimagehash/batch"
+	"github.com/lollipopkit/goimagehash/cache"
+	"github.com/lollipopkit/goimagehash/cluster"
+	"github.com/lollipopkit/goimagehash/decoder"
+	"github.com/lollipopkit/goimagehash/dedupe"
+	"github.com/lollipopkit/goimagehash/index"
 	"github.com/spf13/cobra"
 )
 
 var (
-	outputFile    string
-	recursive     bool
-	extensions    []string
+	outputFile     string
+	recursive      bool
+	extensions     []string
 	findDuplicates bool
+	walkArchives   bool
+	clusterMethod  string
+	minPoints      int
 )
 
 // batchCmd represents the batch command
 var batchCmd = &cobra.Command{
-	Use:   "batch [directory]",
+	Use:   "batch [directory|archive|database]",
 	Short: "Process multiple images in batch",
 	Long: `Process multiple images in a directory, computing hashes for all images
 or finding duplicate/similar images.
 
+With --archives, or when the argument is an archive, images inside zip and
+tar(.gz) archives are processed without extracting them and are named like
+"dataset.tar.gz!/train/0001.jpg".
+
+The argument can also be a hash database written by a previous run with -o
+or --output-format (CSV, JSON or JSON Lines), to find duplicates or convert
+it without hashing the images again.
+
+With --cache, hashes are cached per algorithm and size, so that a new run
+only decodes new and changed files; see the cache command.
+
+Duplicates are grouped with --cluster: "connected" links every chain of
+similar images, "complete" only groups images that are all similar to each
+other, and "dbscan" grows groups from images having at least --min-points
+similar images.
+
+In each group, the copy to keep is chosen with --keep and --prefer, and the
+other copies are moved, replaced by links or deleted with --action. Actions
+are only printed unless --apply is set.
+
 Examples:
   goimagehash-cli batch ./images
   goimagehash-cli batch -r -o hashes.csv ./photos
-  goimagehash-cli batch -d -x 5 ./images`,
+  goimagehash-cli batch -d -x 5 ./images
+  goimagehash-cli batch -d -x 5 hashes.csv
+  goimagehash-cli batch -d --archives ./datasets
+  goimagehash-cli batch -o hashes.csv dataset.tar.gz
+  goimagehash-cli batch -d --cluster complete -x 8 ./images
+  goimagehash-cli batch -d --prefer 'archive/' --action hardlink --apply ./images`,
 	Args: cobra.ExactArgs(1),
 	RunE: runBatch,
 }
@@ -39,46 +75,112 @@ Examples:
 func init() {
 	batchCmd.Flags().StringVarP(&outputFile, "output", "o", "", "Output file for results (CSV format)")
 	batchCmd.Flags().BoolVarP(&recursive, "recursive", "r", false, "Process directories recursively")
-	batchCmd.Flags().StringSliceVarP(&extensions, "extensions", "e", []string{"jpg", "jpeg", "png", "gif"}, "File extensions to process")
+	batchCmd.Flags().StringSliceVarP(&extensions, "extensions", "e", defaultExtensions, "File extensions to process")
 	batchCmd.Flags().BoolVarP(&findDuplicates, "duplicates", "d", false, "Find duplicate/similar images instead of computing hashes")
+	batchCmd.Flags().BoolVar(&walkArchives, "archives", false, "Also process images inside zip, tar, tar.gz and tgz archives")
+	addCacheFlags(batchCmd.Flags(), true)
+	batchCmd.Flags().StringVar(&clusterMethod, "cluster", "connected", "Clustering method for duplicates (connected, complete, dbscan)")
+	batchCmd.Flags().IntVar(&minPoints, "min-points", 2, "Neighbours (itself included) making an image a DBSCAN core point")
+	batchCmd.Flags().StringVar(&keepPolicy, "keep", dedupe.DefaultPolicy, "Criteria choosing the copy to keep (resolution, quality, size, oldest, path)")
+	batchCmd.Flags().StringSliceVar(&preferPaths, "prefer", nil, "Directories or globs to keep first, in order; prefix with ! to avoid")
+	batchCmd.Flags().StringVar(&dupAction, "action", "none", "Action on the other copies (none, move, hardlink, symlink, delete)")
+	batchCmd.Flags().StringVar(&moveTo, "move-to", "", "Destination directory of --action move")
+	batchCmd.Flags().BoolVar(&applyAction, "apply", false, "Perform --action instead of printing what it would do")
+	addErrorFlags(batchCmd.Flags())
 }
 
 func runBatch(cmd *cobra.Command, args []string) error {
+	if err := checkOutputFormat(); err != nil {
+		return err
+	}
 	directory := args[0]
-
-	if verbose {
-		fmt.Printf("Processing directory: %s\n", directory)
-		fmt.Printf("Recursive: %v\n", recursive)
-		fmt.Printf("Extensions: %v\n", extensions)
+	if isHashDatabase(directory) {
+		results, err := loadHashDatabase(directory)
+		if err != nil {
+			return err
+		}
+		if err := adoptAlgorithm(results); err != nil {
+			return err
+		}
 		if findDuplicates {
-			fmt.Printf("Finding duplicates with threshold: %d\n", threshold)
+			return findSimilarImages(results)
+		}
+		return computeBatchHashes(results)
+	}
+
+	logger.Debug("Processing", "directory", directory, "recursive", recursive, "extensions", strings.Join(extensions, ","))
+	if findDuplicates {
+		if a, err := selectedAlgorithm(); err == nil {
+			verbosef("Finding duplicates with %s\n", describeThreshold(a.Bits()))
 		}
 	}
 
 	// Find all image files
-	imageFiles, err := findImageFiles(directory, recursive, extensions)
+	imageFiles, failures, err := findImageFiles(directory, recursive, extensions)
 	if err != nil {
 		return fmt.Errorf("failed to find image files: %w", err)
 	}
 
-	if len(imageFiles) == 0 {
-		fmt.Println("No image files found")
+	if len(imageFiles) == 0 && len(failures) == 0 {
+		infof("No image files found\n")
+		if structuredOutput() {
+			return writeRecords(outputFile, outputFormat, nil)
+		}
 		return nil
 	}
 
-	if verbose {
-		fmt.Printf("Found %d image files\n", len(imageFiles))
+	logger.Debug("Found image files", "count", len(imageFiles))
+
+	hashCache, err := openCache()
+	if err != nil {
+		return err
+	}
+	results := append(hashFiles(imageFiles, hashCache), failures...)
+	saveCache(hashCache)
+	if failOnError {
+		if err := firstFailure(results); err != nil {
+			return err
+		}
+	}
+	for _, r := range results {
+		if r.Err == nil {
+			logger.Debug("Processed", "path", r.ID, "hash", r.Hash)
+		}
 	}
 
 	if findDuplicates {
-		return findSimilarImages(imageFiles)
+		err = findSimilarImages(results)
+	} else {
+		err = computeBatchHashes(results)
 	}
-
-	return computeBatchHashes(imageFiles)
+	if err != nil {
+		return err
+	}
+	if hashCache != nil {
+		stats := hashCache.Stats()
+		infof("Cache: %d hits, %d misses\n", stats.Hits, stats.Misses)
+	}
+	return reportFailures(results)
 }
 
-func findImageFiles(dir string, recursive bool, extensions []string) ([]string, error) {
+// findImageFiles returns the images of dir, or of the archive dir, and the
+// archives that could not be listed.
+func findImageFiles(dir string, recursive bool, extensions []string) ([]string, []hashResult, error) {
 	var files []string
+	var failures []hashResult
+
+	addArchive := func(path string) {
+		ids, err := listArchive(path, extensions)
+		if err != nil {
+			failures = append(failures, hashResult{ID: path, Err: fmt.Errorf("failed to read archive: %w", err)})
+		}
+		files = append(files, ids...)
+	}
+
+	if info, err := os.Stat(dir); err == nil && !info.IsDir() && isArchive(dir) {
+		addArchive(dir)
+		return files, failures, nil
+	}
 
 	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
 		if err != nil {
@@ -93,258 +195,321 @@ func findImageFiles(dir string, recursive bool, extensions []string) ([]string,
 			return nil
 		}
 
-		ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(path), "."))
-		for _, allowedExt := range extensions {
-			if ext == allowedExt {
-				files = append(files, path)
-				break
-			}
+		if hasExtension(path, extensions) {
+			files = append(files, path)
+		} else if walkArchives && isArchive(path) {
+			addArchive(path)
 		}
 
 		return nil
 	})
 
-	return files, err
+	return files, failures, err
 }
 
-func computeBatchHashes(imageFiles []string) error {
-	var records [][]string
-	records = append(records, []string{"File", "Hash", "HashType", "Bits"})
+// defaultExtensions lists the extensions of the image formats decoded by the
+// CLI: JPEG, PNG, GIF, BMP and Netpbm.
+var defaultExtensions = decoder.Extensions()
 
-	for _, imagePath := range imageFiles {
-		img, err := loadImage(imagePath)
-		if err != nil {
-			if verbose {
-				fmt.Printf("Error loading %s: %v\n", imagePath, err)
-			}
-			continue
+// hasExtension reports whether path has one of extensions, ignoring case.
+func hasExtension(path string, extensions []string) bool {
+	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(path), "."))
+	for _, allowedExt := range extensions {
+		if ext == allowedExt {
+			return true
 		}
+	}
+	return false
+}
 
-		var hashStr, kindStr string
-		var bits int
+// hashFile decodes the image at path and computes its hash.
+func hashFile(path string) (*goimagehash.ExtImageHash, error) {
+	img, err := loadImage(path)
+	if err != nil {
+		return nil, err
+	}
+	return hashDecoded(img)
+}
 
-		switch hashType {
-		case "double-gradient", "dgrad":
-			// Handle DoubleGradient with ExtImageHash
-			extHash, err := goimagehash.DoubleGradientHash(img, 8, 8)
+// hashDecoded computes the hash of a decoded image.
+func hashDecoded(img image.Image) (*goimagehash.ExtImageHash, error) {
+	hash, err := hashImage(img)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute hash: %w", err)
+	}
+	return hash, nil
+}
+
+// hashResult is the hash of an image, or the error that prevented it.
+type hashResult struct {
+	ID   string
+	Hash *goimagehash.ExtImageHash
+	Err  error
+}
+
+// hashFiles hashes the images of ids and returns the results in the same
+// order, reporting the progress per --progress. Files are hashed
+// concurrently, the entries of an archive are read in a single pass over it,
+// and images found in c, unless nil, are not decoded again.
+func hashFiles(ids []string, c *cache.Cache) []hashResult {
+	algorithm, err := selectedAlgorithm()
+	if err != nil {
+		results := make([]hashResult, len(ids))
+		for i, id := range ids {
+			results[i] = hashResult{ID: id, Err: err}
+		}
+		return results
+	}
+
+	results := make([]hashResult, len(ids))
+	tracker, finish := startProgress("Hashing", len(ids))
+	defer finish()
+	// With --fail-on-error, the first failure cancels the other files.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fail := func(err error) error {
+		if err != nil && failOnError {
+			cancel()
+		}
+		return err
+	}
+	byArchive := make(map[string][]int)
+	var archives []string
+	var tasks []batch.Task
+	var positions []int
+	for i, id := range ids {
+		results[i].ID = id
+		if archive, _, ok := splitArchiveID(id); ok {
+			if _, seen := byArchive[archive]; !seen {
+				archives = append(archives, archive)
+			}
+			byArchive[archive] = append(byArchive[archive], i)
+			continue
+		}
+		id := id
+		tasks = append(tasks, batch.Task{ID: id, Hash: func() (*goimagehash.ExtImageHash, error) {
+			if c == nil {
+				hash, err := hashFile(id)
+				return hash, fail(err)
+			}
+			k, err := c.FileKey(id)
 			if err != nil {
-				if verbose {
-					fmt.Printf("Error computing hash for %s: %v\n", imagePath, err)
-				}
-				continue
+				return nil, fail(fmt.Errorf("failed to open file: %w", err))
 			}
-			hashStr = extHash.ToString()
-			kindStr = "double-gradient"
-			bits = extHash.Bits()
+			hash, err := cachedHash(c, k, algorithm, func() (*goimagehash.ExtImageHash, error) {
+				return hashFile(id)
+			})
+			return hash, fail(err)
+		}})
+		positions = append(positions, i)
+	}
+	for j, r := range batch.Run(ctx, tasks, batch.Options{Tracker: tracker}) {
+		results[positions[j]].Hash, results[positions[j]].Err = r.Hash, r.Err
+	}
 
-		default:
-			// Handle standard ImageHash types
-			hash, err := computeHash(img)
-			if err != nil {
-				if verbose {
-					fmt.Printf("Error computing hash for %s: %v\n", imagePath, err)
-				}
+	for _, archive := range archives {
+		entries := make(map[string]int)
+		var names []string
+		for _, i := range byArchive[archive] {
+			_, name, _ := splitArchiveID(ids[i])
+			name = path.Clean(name)
+			entries[name] = i
+			names = append(names, name)
+		}
+		done := make(map[int]bool)
+		err := readArchiveEntries(archive, names, func(e archiveEntry, r io.Reader) {
+			i := entries[path.Clean(e.Name)]
+			done[i] = true
+			if results[i].Err = ctx.Err(); results[i].Err == nil {
+				results[i].Hash, results[i].Err = hashArchiveEntry(c, ids[i], e, r, algorithm)
+				fail(results[i].Err)
+			}
+			tracker.Done(ids[i], results[i].Err)
+		})
+		for _, i := range byArchive[archive] {
+			if done[i] {
 				continue
 			}
-
-			hashStr = hash.ToString()
-			bits = hash.Bits()
-			
-			kindStr = "unknown"
-			switch hash.GetKind() {
-			case goimagehash.AHash:
-				kindStr = "average"
-			case goimagehash.PHash:
-				kindStr = "perception"
-			case goimagehash.DHash:
-				kindStr = "difference"
-			case goimagehash.WHash:
-				kindStr = "wavelet"
+			if err != nil {
+				results[i].Err = fmt.Errorf("failed to read archive: %w", err)
+			} else {
+				results[i].Err = errors.New("no such file in archive")
 			}
+			fail(results[i].Err)
+			tracker.Done(ids[i], results[i].Err)
 		}
-		
-		record := []string{
-			imagePath,
-			hashStr,
-			kindStr,
-			fmt.Sprintf("%d", bits),
-		}
-		records = append(records, record)
+	}
+	return results
+}
 
-		if verbose {
-			fmt.Printf("Processed: %s\n", imagePath)
+// hashArchiveEntry computes the hash of the archive entry e with content r,
+// or finds it in c unless nil.
+func hashArchiveEntry(c *cache.Cache, id string, e archiveEntry, r io.Reader, algorithm goimagehash.Algorithm) (*goimagehash.ExtImageHash, error) {
+	decode := func() (*goimagehash.ExtImageHash, error) {
+		img, err := decodeImage(r)
+		if err != nil {
+			return nil, err
 		}
+		return hashDecoded(img)
 	}
-
-	// Output results
-	if outputFile != "" {
-		err := writeCSV(outputFile, records)
+	if c == nil {
+		return decode()
+	}
+	archive, name, _ := splitArchiveID(id)
+	if abs, err := filepath.Abs(archive); err == nil {
+		archive = abs
+	}
+	k := cache.Key{Path: archive + archiveSeparator + name, Size: e.Size, ModTime: e.ModTime}
+	if c.ByContent() {
+		content, err := io.ReadAll(r)
 		if err != nil {
-			return fmt.Errorf("failed to write CSV file: %w", err)
+			return nil, fmt.Errorf("failed to read file: %w", err)
 		}
-		fmt.Printf("Results written to: %s\n", outputFile)
-	} else {
-		for _, record := range records {
-			fmt.Printf("%s: %s (%s)\n", record[0], record[1], record[2])
+		if k.SHA256, err = cache.ContentSHA256(bytes.NewReader(content)); err != nil {
+			return nil, err
 		}
+		r = bytes.NewReader(content)
 	}
+	return cachedHash(c, k, algorithm, decode)
+}
 
-	return nil
+// cachedHash returns the hash of the file k cached in c, or computes it
+// with compute and caches it.
+func cachedHash(c *cache.Cache, k cache.Key, algorithm goimagehash.Algorithm, compute func() (*goimagehash.ExtImageHash, error)) (*goimagehash.ExtImageHash, error) {
+	if hash, ok := c.Get(k, algorithm); ok {
+		return hash, nil
+	}
+	hash, err := compute()
+	if err != nil {
+		return nil, err
+	}
+	c.Put(k, algorithm, hash)
+	return hash, nil
 }
 
-func findSimilarImages(imageFiles []string) error {
-	type ImageInfo struct {
-		Path string
-		Hash *goimagehash.ImageHash
-		ExtHash *goimagehash.ExtImageHash
-		IsExt bool
+// recordsFormat returns the format of the records written by batch: -o
+// writes CSV in text mode, as it always did.
+func recordsFormat() string {
+	if outputFormat == "text" {
+		return "csv"
 	}
+	return outputFormat
+}
 
-	var images []ImageInfo
+func computeBatchHashes(results []hashResult) error {
+	var records []record
+	for _, r := range results {
+		records = append(records, newHashRecord(r.ID, algorithmName(), r.Hash, r.Err))
+	}
 
-	// Compute hashes for all images
-	for _, imagePath := range imageFiles {
-		img, err := loadImage(imagePath)
-		if err != nil {
-			if verbose {
-				fmt.Printf("Error loading %s: %v\n", imagePath, err)
-			}
-			continue
+	// Output results
+	if outputFile != "" || structuredOutput() {
+		if err := writeRecords(outputFile, recordsFormat(), records); err != nil {
+			return fmt.Errorf("failed to write results: %w", err)
 		}
-
-		switch hashType {
-		case "double-gradient", "dgrad":
-			// Handle DoubleGradient with ExtImageHash
-			extHash, err := goimagehash.DoubleGradientHash(img, 8, 8)
-			if err != nil {
-				if verbose {
-					fmt.Printf("Error computing hash for %s: %v\n", imagePath, err)
-				}
-				continue
-			}
-			images = append(images, ImageInfo{Path: imagePath, ExtHash: extHash, IsExt: true})
-
-		default:
-			// Handle standard ImageHash types
-			hash, err := computeHash(img)
-			if err != nil {
-				if verbose {
-					fmt.Printf("Error computing hash for %s: %v\n", imagePath, err)
-				}
-				continue
-			}
-			images = append(images, ImageInfo{Path: imagePath, Hash: hash, IsExt: false})
+		if outputFile != "" {
+			infof("Results written to: %s\n", outputFile)
 		}
+		return nil
+	}
 
-		if verbose {
-			fmt.Printf("Processed: %s\n", imagePath)
+	for _, r := range records {
+		if r := r.(hashRecord); r.Error == "" {
+			fmt.Printf("%s: %s (%s)\n", r.Path, r.Hash, r.Hash.GetKind())
 		}
 	}
+	return nil
+}
+
+func findSimilarImages(results []hashResult) error {
+	method, err := cluster.ParseMethod(clusterMethod)
+	if err != nil {
+		return err
+	}
+	policy, action, err := duplicatePolicy()
+	if err != nil {
+		return err
+	}
 
-	// Find similar images
-	var groups [][]ImageInfo
-	processed := make(map[int]bool)
+	var entries []index.Entry
+	var failed []record
 
-	for i, img1 := range images {
-		if processed[i] {
+	for _, r := range results {
+		if r.Err != nil {
+			failed = append(failed, groupRecord{Path: r.ID, Algorithm: algorithmName(), Error: r.Err.Error()})
 			continue
 		}
+		entries = append(entries, index.Entry{ID: r.ID, Hash: r.Hash})
+	}
 
-		var group []ImageInfo
-		group = append(group, img1)
-		processed[i] = true
-
-		for j, img2 := range images {
-			if i == j || processed[j] {
-				continue
-			}
-
-			// Only compare same hash types
-			if img1.IsExt != img2.IsExt {
-				continue
-			}
-
-			var distance int
-			var err error
-
-			if img1.IsExt {
-				// Compare ExtImageHash
-				distance, err = img1.ExtHash.Distance(img2.ExtHash)
-			} else {
-				// Compare ImageHash
-				distance, err = img1.Hash.Distance(img2.Hash)
-			}
-
-			if err != nil {
-				continue
-			}
-
-			if distance <= threshold {
-				group = append(group, img2)
-				processed[j] = true
-			}
+	var groups []cluster.Cluster
+	if len(entries) > 0 {
+		// Every image is hashed with the same algorithm, hence the same size.
+		clusters, err := cluster.Group(entries, cluster.Options{
+			Method:    method,
+			Threshold: maxDistance(entries[0].Hash.Bits()),
+			MinPoints: minPoints,
+		})
+		if err != nil {
+			return err
 		}
-
-		if len(group) > 1 {
-			groups = append(groups, group)
+		for _, c := range clusters {
+			if len(c.Members) > 1 {
+				groups = append(groups, c)
+			}
 		}
 	}
 
-	// Output results
-	if len(groups) == 0 {
-		fmt.Println("No similar images found")
-		return nil
+	plan, decisions, err := planDuplicates(groups, policy)
+	if err != nil {
+		return err
 	}
 
-	fmt.Printf("Found %d groups of similar images:\n\n", len(groups))
-
+	var records []record
 	for i, group := range groups {
-		fmt.Printf("Group %d (threshold: %d):\n", i+1, threshold)
-		for _, img := range group {
-			fmt.Printf("  %s\n", img.Path)
+		for _, m := range group.Members {
+			records = append(records, groupRecord{
+				Group:          i + 1,
+				Path:           m.ID,
+				Algorithm:      algorithmName(),
+				Hash:           m.Hash.String(),
+				Distance:       m.Distance,
+				Representative: m.ID == group.Representative,
+				Decision:       decisions[m.ID],
+			})
 		}
-		fmt.Println()
 	}
+	records = append(records, failed...)
 
-	if outputFile != "" {
-		var records [][]string
-		records = append(records, []string{"Group", "File", "Hash"})
+	// Output results
+	if !structuredOutput() {
+		if len(groups) == 0 {
+			fmt.Println("No similar images found")
+		} else {
+			fmt.Printf("Found %d groups of similar images:\n\n", len(groups))
+		}
 
 		for i, group := range groups {
-			for _, img := range group {
-				var hashStr string
-				if img.IsExt {
-					hashStr = img.ExtHash.ToString()
+			fmt.Printf("Group %d (%s, max distance: %d):\n", i+1, describeThreshold(group.Members[0].Hash.Bits()), group.MaxDistance)
+			for _, m := range group.Members {
+				if m.ID == group.Representative {
+					fmt.Printf("  %-6s  %s (representative)\n", decisions[m.ID], m.ID)
 				} else {
-					hashStr = img.Hash.ToString()
+					fmt.Printf("  %-6s  %s (distance: %d)\n", decisions[m.ID], m.ID, m.Distance)
 				}
-				records = append(records, []string{
-					fmt.Sprintf("Group %d", i+1),
-					img.Path,
-					hashStr,
-				})
 			}
+			fmt.Println()
 		}
+	}
 
-		err := writeCSV(outputFile, records)
-		if err != nil {
-			return fmt.Errorf("failed to write CSV file: %w", err)
+	if outputFile != "" || structuredOutput() {
+		if err := writeRecords(outputFile, recordsFormat(), records); err != nil {
+			return fmt.Errorf("failed to write results: %w", err)
+		}
+		if outputFile != "" {
+			infof("Results written to: %s\n", outputFile)
 		}
-		fmt.Printf("Results written to: %s\n", outputFile)
 	}
 
-	return nil
+	return applyPlan(plan, action)
 }
-
-func writeCSV(filename string, records [][]string) error {
-	file, err := os.Create(filename)
-	if err != nil {
-		return err
-	}
-	defer file.Close()
-
-	writer := csv.NewWriter(file)
-	defer writer.Flush()
-
-	return writer.WriteAll(records)
-}
\ No newline at end of file
@@ -0,0 +1,162 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/lollipopkit/goimagehash/cache"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+var (
+	useCache       bool
+	cacheFile      string
+	cacheByContent bool
+)
+
+// cacheCmd represents the cache command
+var cacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "Inspect and maintain the hash cache",
+	Long: `Inspect and maintain the cache of image hashes used by batch, match, index
+build and watch with --cache.
+
+The cache remembers the hash of every file per algorithm and size, keyed by
+path, size and modification time, or by the SHA-256 of the content with
+--cache-sha256, so that later runs only decode new and changed files.
+It is stored in a single file, by default in the user cache directory.
+
+Examples:
+  goimagehash-cli cache stats
+  goimagehash-cli cache prune
+  goimagehash-cli cache clear --cache-file ./hashes-cache.jsonl`,
+}
+
+var cacheStatsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Print the number of cached files and hashes, and the hits and misses of every run",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		c, err := openCacheFile()
+		if err != nil {
+			return err
+		}
+		stats := c.Stats()
+		if structuredOutput() {
+			return json.NewEncoder(os.Stdout).Encode(struct {
+				Path string `json:"path"`
+				cache.Stats
+			}{c.Path(), stats})
+		}
+		fmt.Printf("Cache: %s\n", c.Path())
+		fmt.Printf("Files: %d\n", stats.Files)
+		fmt.Printf("Hashes: %d\n", stats.Hashes)
+		fmt.Printf("Hits: %d\n", stats.TotalHits)
+		fmt.Printf("Misses: %d\n", stats.TotalMisses)
+		return nil
+	},
+}
+
+var cachePruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Remove the files that were deleted or modified since they were cached",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		c, err := openCacheFile()
+		if err != nil {
+			return err
+		}
+		removed := c.Prune(func(k cache.Key) bool {
+			if archive, _, ok := splitArchiveID(k.Path); ok {
+				// Entries are checked when the archive is read again.
+				_, err := os.Stat(archive)
+				return err == nil
+			}
+			return cache.Unchanged(k)
+		})
+		if err := c.Save(); err != nil {
+			return fmt.Errorf("failed to save cache: %w", err)
+		}
+		infof("Removed %d of %d files from %s\n", removed, removed+c.Stats().Files, c.Path())
+		return nil
+	},
+}
+
+var cacheClearCmd = &cobra.Command{
+	Use:   "clear",
+	Short: "Remove every file from the cache",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		c, err := openCacheFile()
+		if err != nil {
+			return err
+		}
+		c.Clear()
+		if err := c.Save(); err != nil {
+			return fmt.Errorf("failed to save cache: %w", err)
+		}
+		infof("Cleared %s\n", c.Path())
+		return nil
+	},
+}
+
+func init() {
+	addCacheFlags(cacheCmd.PersistentFlags(), false)
+	cacheCmd.AddCommand(cacheStatsCmd)
+	cacheCmd.AddCommand(cachePruneCmd)
+	cacheCmd.AddCommand(cacheClearCmd)
+}
+
+// addCacheFlags adds the flags selecting the cache to a command. --cache is
+// only added to commands that can run without a cache, which they do unless
+// one of the flags is given.
+func addCacheFlags(flags *pflag.FlagSet, optional bool) {
+	if optional {
+		flags.BoolVar(&useCache, "cache", false, "Read and update the hash cache, so that a new run only decodes new and changed files")
+	}
+	flags.StringVar(&cacheFile, "cache-file", "", "Hash cache file, implies --cache [default: goimagehash/hashes.jsonl in the user cache directory]")
+	flags.BoolVar(&cacheByContent, "cache-sha256", false, "Identify cached files by the SHA-256 of their content instead of path, size and time, implies --cache")
+}
+
+// openCache opens the cache selected by the flags, or returns nil when none
+// of --cache, --cache-file and --cache-sha256 is given.
+func openCache() (*cache.Cache, error) {
+	if !useCache && cacheFile == "" && !cacheByContent {
+		return nil, nil
+	}
+	return openCacheFile()
+}
+
+// openCacheFile opens the cache file selected by the flags.
+func openCacheFile() (*cache.Cache, error) {
+	path := cacheFile
+	if path == "" {
+		dir, err := os.UserCacheDir()
+		if err != nil {
+			return nil, fmt.Errorf("no cache directory, use --cache-file: %w", err)
+		}
+		path = filepath.Join(dir, "goimagehash", "hashes.jsonl")
+	}
+	c, err := cache.Open(path, cacheByContent)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open cache: %w", err)
+	}
+	logger.Debug("Opened cache", "path", path, "sha256", cacheByContent)
+	return c, nil
+}
+
+// saveCache writes the cache and reports its hits and misses. A cache that
+// can not be written does not fail the command that filled it.
+func saveCache(c *cache.Cache) {
+	if c == nil {
+		return
+	}
+	stats := c.Stats()
+	logger.Debug("Cache", "hits", stats.Hits, "misses", stats.Misses, "files", stats.Files)
+	if err := c.Save(); err != nil {
+		logger.Warn("Failed to save cache", "path", c.Path(), "error", err)
+	}
+}
@@ -0,0 +1,130 @@
+package commands
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/lollipopkit/goimagehash"
+	"github.com/lollipopkit/goimagehash/calibrate"
+	"github.com/spf13/cobra"
+)
+
+var (
+	calibrateAlgorithms []string
+	targetFPR           float64
+	calibrateFormat     string
+)
+
+// calibrateCmd represents the calibrate command
+var calibrateCmd = &cobra.Command{
+	Use:   "calibrate [pairs.csv|groups_directory]",
+	Short: "Pick similarity thresholds from labeled image pairs",
+	Long: `Compute the distances of labeled image pairs with each selected algorithm and
+report the ROC curve, its AUC, the equal error rate (EER) and the largest
+threshold whose false positive rate stays below --target-fpr.
+
+Pairs are read from a CSV file of "imageA,imageB,label" records, where label
+is same or different and relative paths are resolved against the CSV file.
+A directory is read as groups instead: each subdirectory holds images of the
+same picture, and every image is paired with every other one.
+
+Examples:
+  goimagehash-cli calibrate pairs.csv
+  goimagehash-cli calibrate -a phash,phash:16x16 --target-fpr 0.001 ./groups
+  goimagehash-cli calibrate -f csv pairs.csv > roc.csv`,
+	Args: cobra.ExactArgs(1),
+	RunE: runCalibrate,
+}
+
+func init() {
+	var names []string
+	for _, a := range goimagehash.Algorithms() {
+		names = append(names, a.String())
+	}
+	calibrateCmd.Flags().StringSliceVarP(&calibrateAlgorithms, "algorithms", "a", names, "Algorithms to evaluate, optionally with a size (e.g. phash:16x16)")
+	calibrateCmd.Flags().Float64Var(&targetFPR, "target-fpr", 0.01, "Target false positive rate")
+	calibrateCmd.Flags().StringVarP(&calibrateFormat, "format", "f", "", "Output format (table, csv, json, jsonl) [default: from --output-format]")
+}
+
+func runCalibrate(cmd *cobra.Command, args []string) error {
+	var algorithms []goimagehash.Algorithm
+	for _, name := range calibrateAlgorithms {
+		a, err := goimagehash.ParseAlgorithm(name)
+		if err != nil {
+			return err
+		}
+		algorithms = append(algorithms, a)
+	}
+	format, err := tableFormat(calibrateFormat)
+	if err != nil {
+		return err
+	}
+
+	info, err := os.Stat(args[0])
+	if err != nil {
+		return err
+	}
+	var pairs []calibrate.Pair
+	if info.IsDir() {
+		pairs, err = calibrate.GroupPairs(args[0], func(path string) bool {
+			return hasExtension(path, defaultExtensions)
+		})
+	} else {
+		pairs, err = calibrate.ReadPairsFile(args[0])
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read pairs: %w", err)
+	}
+	if len(pairs) == 0 {
+		return fmt.Errorf("no labeled pairs found in %s", args[0])
+	}
+
+	verbosef("Evaluating %d pairs with %d algorithms\n", len(pairs), len(algorithms))
+
+	results, err := calibrate.Run(pairs, algorithms, loadImage, targetFPR)
+	if err != nil {
+		return err
+	}
+
+	switch format {
+	case "jsonl":
+		enc := json.NewEncoder(os.Stdout)
+		for _, r := range results {
+			if err := enc.Encode(r); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(results)
+	case "csv":
+		w := csv.NewWriter(os.Stdout)
+		w.Write([]string{"Algorithm", "Threshold", "TPR", "FPR"})
+		for _, res := range results {
+			for _, p := range res.Points {
+				w.Write([]string{res.Algorithm, strconv.Itoa(p.Threshold), formatRate(p.TPR), formatRate(p.FPR)})
+			}
+		}
+		w.Flush()
+		return w.Error()
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "ALGORITHM\tBITS\tSAME\tDIFFERENT\tAUC\tEER\tEER THRESHOLD\tTHRESHOLD@FPR %g\tTPR\tFPR\n", targetFPR)
+	for _, res := range results {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%.4f\t%.4f\t%d\t%d\t%.4f\t%.4f\n",
+			res.Algorithm, res.Bits, res.Positives, res.Negatives, res.AUC, res.EER,
+			res.EERThreshold, res.Threshold, res.TPR, res.FPR)
+	}
+	return w.Flush()
+}
+
+func formatRate(r float64) string {
+	return strconv.FormatFloat(r, 'f', 6, 64)
+}
@@ -3,12 +3,12 @@ package commands
 import (
 	"fmt"
 	"image"
-	_ "image/gif"
-	_ "image/jpeg"
-	_ "image/png"
-	"os"
+	"io"
 
 	"github.com/lollipopkit/goimagehash"
+	"github.com/lollipopkit/goimagehash/decoder"
+	_ "github.com/lollipopkit/goimagehash/decoder/bmp"
+	_ "github.com/lollipopkit/goimagehash/decoder/netpbm"
 	"github.com/spf13/cobra"
 )
 
@@ -20,127 +20,130 @@ var compareCmd = &cobra.Command{
 the Hamming distance between them. Lower distance values indicate higher similarity.
 
 The command outputs the Hamming distance and whether the images are considered 
-similar based on the threshold.
+similar based on the threshold. It exits with code 0 for similar images, 1 for
+different images and 2 when an image can not be read.
+
+Either image can be "-" to read it from the standard input, or an entry of a
+zip or tar archive such as "photos.zip!/2019/a.jpg".
 
 Examples:
   goimagehash-cli compare image1.jpg image2.jpg
+  curl -s https://example.com/a.jpg | goimagehash-cli compare - image2.jpg
   goimagehash-cli compare -t perception -x 5 img1.png img2.png`,
 	Args: cobra.ExactArgs(2),
 	RunE: runCompare,
 }
 
 func runCompare(cmd *cobra.Command, args []string) error {
+	if err := checkOutputFormat(); err != nil {
+		return err
+	}
 	image1Path := args[0]
 	image2Path := args[1]
-
-	if verbose {
-		fmt.Printf("Comparing images:\n")
-		fmt.Printf("  Image 1: %s\n", image1Path)
-		fmt.Printf("  Image 2: %s\n", image2Path)
-		fmt.Printf("  Hash algorithm: %s\n", hashType)
-		fmt.Printf("  Similarity threshold: %d\n", threshold)
-	}
-
-	// Load and decode first image
-	img1, err := loadImage(image1Path)
-	if err != nil {
-		return fmt.Errorf("failed to load first image: %w", err)
+	if image1Path == "-" && image2Path == "-" {
+		return fmt.Errorf("only one image can be read from the standard input")
 	}
 
-	// Load and decode second image
-	img2, err := loadImage(image2Path)
-	if err != nil {
-		return fmt.Errorf("failed to load second image: %w", err)
-	}
+	verbosef("Comparing images:\n")
+	verbosef("  Image 1: %s\n", image1Path)
+	verbosef("  Image 2: %s\n", image2Path)
+	verbosef("  Hash algorithm: %s\n", algorithmName())
 
-	// Compute hashes
-	var distance int
-	var similar bool
-	var hashKind1, hashKind2 goimagehash.Kind
-	var hashStr1, hashStr2 string
-
-	switch hashType {
-	case "double-gradient", "dgrad":
-		// Handle DoubleGradient with ExtImageHash
-		extHash1, err := goimagehash.DoubleGradientHash(img1, 8, 8)
+	rec, err := compareImages(image1Path, image2Path)
+	if structuredOutput() {
 		if err != nil {
-			return fmt.Errorf("failed to compute hash for first image: %w", err)
+			rec.Error = err.Error()
 		}
-
-		extHash2, err := goimagehash.DoubleGradientHash(img2, 8, 8)
-		if err != nil {
-			return fmt.Errorf("failed to compute hash for second image: %w", err)
+		if werr := writeRecords("", outputFormat, []record{rec}); werr != nil {
+			return werr
 		}
+	}
+	if err != nil {
+		return err
+	}
 
-		// Calculate distance
-		distance, err = extHash1.Distance(extHash2)
-		if err != nil {
-			return fmt.Errorf("failed to calculate distance: %w", err)
+	if !structuredOutput() {
+		status := "different"
+		if rec.Similar {
+			status = "similar"
 		}
 
-		similar = distance <= threshold
-		hashKind1 = extHash1.GetKind()
-		hashKind2 = extHash2.GetKind()
-		hashStr1 = extHash1.ToString()
-		hashStr2 = extHash2.ToString()
+		fmt.Printf("Distance: %d\n", rec.Distance)
+		fmt.Printf("Similarity: %.4f\n", rec.Similarity)
+		fmt.Printf("Status: %s (%s)\n", status, describeThreshold(rec.Bits))
 
-	default:
-		// Handle standard ImageHash types
-		hash1, err := computeHash(img1)
-		if err != nil {
-			return fmt.Errorf("failed to compute hash for first image: %w", err)
-		}
+		verbosef("Hash 1: %s\n", rec.Hash1)
+		verbosef("Hash 2: %s\n", rec.Hash2)
+		verbosef("Hash type: %s\n", rec.Algorithm)
+	}
 
-		hash2, err := computeHash(img2)
-		if err != nil {
-			return fmt.Errorf("failed to compute hash for second image: %w", err)
-		}
+	// Set exit code for scripting
+	if !rec.Similar {
+		return &exitError{code: ExitDifferent}
+	}
 
-		// Calculate distance
-		distance, err = hash1.Distance(hash2)
-		if err != nil {
-			return fmt.Errorf("failed to calculate distance: %w", err)
-		}
+	return nil
+}
 
-		similar = distance <= threshold
-		hashKind1 = hash1.GetKind()
-		hashKind2 = hash2.GetKind()
-		hashStr1 = hash1.ToString()
-		hashStr2 = hash2.ToString()
-	}
+// compareImages hashes two images and compares the hashes. The record
+// names the images and the algorithm even when an error is returned.
+func compareImages(image1Path, image2Path string) (compareRecord, error) {
+	rec := compareRecord{Path1: image1Path, Path2: image2Path, Algorithm: algorithmName()}
 
-	// Output results
-	status := "different"
-	if similar {
-		status = "similar"
+	// Load and decode first image
+	img1, err := loadImage(image1Path)
+	if err != nil {
+		return rec, fmt.Errorf("failed to load first image: %w", err)
 	}
 
-	fmt.Printf("Distance: %d\n", distance)
-	fmt.Printf("Status: %s (threshold: %d)\n", status, threshold)
+	// Load and decode second image
+	img2, err := loadImage(image2Path)
+	if err != nil {
+		return rec, fmt.Errorf("failed to load second image: %w", err)
+	}
 
-	if verbose {
-		fmt.Printf("Hash 1: %s\n", hashStr1)
-		fmt.Printf("Hash 2: %s\n", hashStr2)
-		fmt.Printf("Hash 1 type: %v\n", hashKind1)
-		fmt.Printf("Hash 2 type: %v\n", hashKind2)
+	// Compute hashes
+	hash1, err := hashImage(img1)
+	if err != nil {
+		return rec, fmt.Errorf("failed to compute hash for first image: %w", err)
+	}
+	hash2, err := hashImage(img2)
+	if err != nil {
+		return rec, fmt.Errorf("failed to compute hash for second image: %w", err)
 	}
 
-	// Set exit code for scripting
-	if !similar {
-		os.Exit(1)
+	// Calculate distance
+	distance, err := hash1.Distance(hash2)
+	if err != nil {
+		return rec, fmt.Errorf("failed to calculate distance: %w", err)
 	}
 
-	return nil
+	rec.Bits = hash1.Bits()
+	rec.Hash1 = hash1.String()
+	rec.Hash2 = hash2.String()
+	rec.Distance = distance
+	rec.Similarity = 1 - float64(distance)/float64(rec.Bits)
+	rec.Threshold = maxDistance(rec.Bits)
+	rec.Similar = isSimilar(distance, rec.Bits)
+	return rec, nil
 }
 
+// loadImage decodes the image of a file, of an archive entry such as
+// "photos.zip!/a.jpg", or of the standard input for "-".
 func loadImage(path string) (image.Image, error) {
-	file, err := os.Open(path)
+	r, _, err := openImageSource(path)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open file: %w", err)
 	}
-	defer file.Close()
+	defer r.Close()
+
+	return decodeImage(r)
+}
 
-	img, _, err := image.Decode(file)
+// decodeImage decodes an image of any registered format, recognized by its
+// content.
+func decodeImage(r io.Reader) (image.Image, error) {
+	img, _, err := decoder.Decode(r)
 	if err != nil {
 		return nil, fmt.Errorf("failed to decode image: %w", err)
 	}
@@ -148,15 +151,21 @@ func loadImage(path string) (image.Image, error) {
 	return img, nil
 }
 
-func computeHash(img image.Image) (*goimagehash.ImageHash, error) {
-	switch hashType {
-	case "average", "ahash":
-		return goimagehash.AverageHash(img)
-	case "difference", "dhash":
-		return goimagehash.DifferenceHash(img)
-	case "perception", "phash":
-		return goimagehash.PerceptionHash(img)
-	default:
-		return nil, fmt.Errorf("unsupported hash type: %s", hashType)
+// hashImage computes the hash of img with the selected algorithm.
+func hashImage(img image.Image) (*goimagehash.ExtImageHash, error) {
+	a, err := selectedAlgorithm()
+	if err != nil {
+		return nil, err
+	}
+	return a.Hash(img)
+}
+
+// algorithmName returns the name of the selected algorithm, e.g.
+// "perception:16x16".
+func algorithmName() string {
+	a, err := selectedAlgorithm()
+	if err != nil {
+		return hashType
 	}
-}
\ No newline at end of file
+	return a.String()
+}
@@ -0,0 +1,470 @@
+package commands
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// configFile is --config, the configuration file to read instead of the
+// discovered one.
+var configFile string
+
+// envPrefix starts the names of the environment variables setting flags,
+// e.g. GOIMAGEHASH_HASH_TYPE for --hash-type.
+const envPrefix = "GOIMAGEHASH_"
+
+// configEnv names the configuration file, like --config.
+const configEnv = envPrefix + "CONFIG"
+
+// configNames are the names of the configuration file, looked up in the
+// working directory and then in the goimagehash directory of the user
+// configuration directory ($XDG_CONFIG_HOME or ~/.config on Linux).
+var (
+	localConfigNames = []string{".goimagehash.json", ".goimagehash.conf"}
+	userConfigNames  = []string{"config.json", "config"}
+)
+
+// commandLineOnly are the flags never read from the configuration file or
+// the environment: they delete or move files, or choose the files written,
+// and a configuration file in a directory of someone else's must not do so
+// on its own.
+var commandLineOnly = map[string]bool{
+	"apply":      true,
+	"action":     true,
+	"move-to":    true,
+	"output":     true,
+	"index":      true,
+	"cache-file": true,
+}
+
+// configCmd represents the config command
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Inspect the configuration file and environment variables",
+	Long: `Flags can be given default values in a configuration file and in
+environment variables. A flag given on the command line wins over its
+environment variable, which wins over the configuration file. A value from
+the file or the environment acts as if the flag was given.
+
+The configuration file is --config, or $GOIMAGEHASH_CONFIG, or the first of
+.goimagehash.json and .goimagehash.conf in the working directory, or of
+config.json and config in the goimagehash directory of the user
+configuration directory (~/.config/goimagehash on Linux).
+
+It is a JSON object, or lines of key = value with # comments, whose keys are
+flag names. A key applies to every command with that flag; it can be limited
+to a command with a prefix (search.k, index.build.output) or, in key = value
+files, a [search] section. JSON arrays are lists such as --extensions.
+
+  hash-type = perception
+  threshold = 8
+  extensions = jpg,png,webp
+
+  [search]
+  k = 5
+
+Environment variables are the flag names in upper case with underscores,
+prefixed by GOIMAGEHASH_: GOIMAGEHASH_HASH_TYPE=perception.
+
+The flags acting on files, --apply, --action and --move-to, and the flags
+choosing the files written, --output, --index and --cache-file, are only read
+from the command line; their settings are ignored with a warning.
+
+Examples:
+  goimagehash-cli config show
+  GOIMAGEHASH_THRESHOLD=5 goimagehash-cli config show --output-format json`,
+	// The configuration is not applied to its own inspection, which would
+	// fail on the invalid values it should show.
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		return checkOutputFormat()
+	},
+}
+
+var configShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Print the configuration file and the settings read from it and from the environment",
+	Args:  cobra.NoArgs,
+	RunE:  runConfigShow,
+}
+
+func init() {
+	configCmd.AddCommand(configShowCmd)
+}
+
+// configSetting is a flag value of the configuration file or of the
+// environment.
+type configSetting struct {
+	Key    string `json:"key"`
+	Value  string `json:"value"`
+	Source string `json:"source"`
+	Note   string `json:"note"`
+}
+
+func (s configSetting) csvHeader() []string {
+	return []string{"Key", "Value", "Source", "Note"}
+}
+
+func (s configSetting) csvRow() []string {
+	return []string{s.Key, s.Value, s.Source, s.Note}
+}
+
+// config is the configuration file, if any, and its settings by key.
+type config struct {
+	path     string
+	settings map[string]configSetting
+}
+
+// loadConfig reads the configuration file of --config, $GOIMAGEHASH_CONFIG,
+// or the first one found. Without a file, the configuration is empty.
+func loadConfig() (*config, error) {
+	cfg := &config{settings: make(map[string]configSetting)}
+	path, err := findConfigFile()
+	if err != nil || path == "" {
+		return cfg, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+	values, err := parseConfig(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+	cfg.path = path
+	for k, v := range values {
+		cfg.settings[k] = configSetting{Key: k, Value: v, Source: path}
+	}
+	return cfg, nil
+}
+
+// findConfigFile returns the path of the configuration file, or "" when
+// there is none.
+func findConfigFile() (string, error) {
+	if configFile != "" {
+		return configFile, nil
+	}
+	if path := os.Getenv(configEnv); path != "" {
+		return path, nil
+	}
+	for _, path := range configCandidates() {
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return "", fmt.Errorf("failed to read config: %w", err)
+		}
+	}
+	return "", nil
+}
+
+// configCandidates returns the paths where the configuration file is
+// looked up, in order.
+func configCandidates() []string {
+	paths := append([]string(nil), localConfigNames...)
+	if dir, err := os.UserConfigDir(); err == nil {
+		for _, name := range userConfigNames {
+			paths = append(paths, filepath.Join(dir, "goimagehash", name))
+		}
+	}
+	return paths
+}
+
+// parseConfig returns the settings of a configuration file: a JSON object,
+// or key = value lines.
+func parseConfig(data []byte) (map[string]string, error) {
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		return parseJSONConfig(trimmed)
+	}
+	return parseKeyValueConfig(data)
+}
+
+func parseJSONConfig(data []byte) (map[string]string, error) {
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	var object map[string]interface{}
+	if err := d.Decode(&object); err != nil {
+		return nil, err
+	}
+	values := make(map[string]string)
+	if err := flattenConfig(values, "", object); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// flattenConfig adds the values of a JSON object to values, with the keys
+// of nested objects, i.e. commands, prefixed by theirs.
+func flattenConfig(values map[string]string, prefix string, object map[string]interface{}) error {
+	for k, v := range object {
+		key := prefix + normalizeConfigKey(k)
+		switch v := v.(type) {
+		case nil:
+		case map[string]interface{}:
+			if err := flattenConfig(values, key+".", v); err != nil {
+				return err
+			}
+		case []interface{}:
+			items := make([]string, len(v))
+			for i, item := range v {
+				switch item.(type) {
+				case map[string]interface{}, []interface{}:
+					return fmt.Errorf("%s: lists can only hold strings, numbers and booleans", key)
+				}
+				items[i] = fmt.Sprint(item)
+			}
+			values[key] = strings.Join(items, ",")
+		default:
+			values[key] = fmt.Sprint(v)
+		}
+	}
+	return nil
+}
+
+func parseKeyValueConfig(data []byte) (map[string]string, error) {
+	values := make(map[string]string)
+	section := ""
+	scanner := bufio.NewScanner(bytes.NewReader(bytes.TrimPrefix(data, []byte("\ufeff"))))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || text[0] == '#' || text[0] == ';' {
+			continue
+		}
+		if text[0] == '[' && text[len(text)-1] == ']' {
+			section = strings.Join(strings.Fields(text[1:len(text)-1]), ".")
+			if section != "" {
+				section = normalizeConfigKey(section) + "."
+			}
+			continue
+		}
+		key, value, ok := strings.Cut(text, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("line %d: expected key = value", line)
+		}
+		values[section+normalizeConfigKey(key)] = unquote(strings.TrimSpace(value))
+	}
+	return values, scanner.Err()
+}
+
+// normalizeConfigKey returns key in lower case with dashes, as flag names.
+func normalizeConfigKey(key string) string {
+	return strings.ReplaceAll(strings.ToLower(strings.TrimSpace(key)), "_", "-")
+}
+
+// unquote strips the quotes around a value.
+func unquote(value string) string {
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+		return value[1 : len(value)-1]
+	}
+	return value
+}
+
+// envName returns the environment variable of the flag name.
+func envName(name string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// lookup returns the setting of the flag name of the command at scope,
+// e.g. "index.build": its environment variable, else the key of the
+// command, else the plain key.
+func (c *config) lookup(scope, name string) (configSetting, bool) {
+	if value := os.Getenv(envName(name)); value != "" {
+		return configSetting{Key: name, Value: value, Source: envName(name)}, true
+	}
+	if s, ok := c.settings[scope+"."+name]; ok && scope != "" {
+		return s, true
+	}
+	s, ok := c.settings[name]
+	return s, ok
+}
+
+// applyConfig sets the flags of cmd that are not given on the command line
+// from the environment and the configuration file, and returns the latter.
+func applyConfig(cmd *cobra.Command) (*config, error) {
+	cfg, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+	scope := commandScope(cmd)
+	var errs []error
+	cmd.Flags().VisitAll(func(f *pflag.Flag) {
+		if f.Changed || f.Name == "help" || f.Name == "config" || commandLineOnly[f.Name] {
+			return
+		}
+		s, ok := cfg.lookup(scope, f.Name)
+		if !ok {
+			return
+		}
+		if err := f.Value.Set(s.Value); err != nil {
+			errs = append(errs, fmt.Errorf("%s: invalid %s %q: %w", s.Source, s.Key, s.Value, err))
+			return
+		}
+		f.Changed = true
+	})
+	return cfg, errors.Join(errs...)
+}
+
+// warnUnknownSettings logs the settings that match no flag of the commands
+// of root, likely typos, and the ignored ones of command line only flags.
+func warnUnknownSettings(root *cobra.Command, cfg *config) {
+	for _, s := range cfg.all(root) {
+		switch s.Note {
+		case "unknown":
+			logger.Warn("Unknown setting", "key", s.Key, "source", s.Source)
+		case "ignored, command line only":
+			logger.Warn("Ignored setting of a command line only flag", "key", s.Key, "source", s.Source)
+		}
+	}
+}
+
+// all returns the settings of the environment and of the configuration
+// file, sorted by key, with a note for the overridden ones, the ignored ones
+// of command line only flags and the unknown ones, that match no flag of the
+// commands of root.
+func (c *config) all(root *cobra.Command) []configSetting {
+	var settings []configSetting
+	env := make(map[string]bool)
+	for _, kv := range os.Environ() {
+		name, value, _ := strings.Cut(kv, "=")
+		if !strings.HasPrefix(name, envPrefix) || name == configEnv || value == "" {
+			continue
+		}
+		key := normalizeConfigKey(strings.TrimPrefix(name, envPrefix))
+		env[key] = true
+		settings = append(settings, configSetting{Key: key, Value: value, Source: name})
+	}
+	for _, s := range c.settings {
+		if _, name := splitConfigKey(s.Key); env[name] {
+			s.Note = "overridden by " + envName(name)
+		}
+		settings = append(settings, s)
+	}
+	for i, s := range settings {
+		if !isKnownSetting(root, s.Key) {
+			settings[i].Note = "unknown"
+		} else if _, name := splitConfigKey(s.Key); commandLineOnly[name] {
+			settings[i].Note = "ignored, command line only"
+		}
+	}
+	sort.SliceStable(settings, func(i, j int) bool {
+		if settings[i].Key != settings[j].Key {
+			return settings[i].Key < settings[j].Key
+		}
+		// The environment first, as it wins.
+		return settings[i].Note == "" && settings[j].Note != ""
+	})
+	return settings
+}
+
+// commandScope returns the path of cmd without the root command, joined by
+// dots, e.g. "index.build".
+func commandScope(cmd *cobra.Command) string {
+	var names []string
+	for c := cmd; c.HasParent(); c = c.Parent() {
+		names = append([]string{c.Name()}, names...)
+	}
+	return strings.Join(names, ".")
+}
+
+// splitConfigKey splits a key into the scope of its command, if any, and
+// the flag name.
+func splitConfigKey(key string) (scope, name string) {
+	if i := strings.LastIndex(key, "."); i >= 0 {
+		return key[:i], key[i+1:]
+	}
+	return "", key
+}
+
+// findScope returns the command of root at scope, or nil.
+func findScope(root *cobra.Command, scope string) *cobra.Command {
+	cmd := root
+	for _, name := range strings.Split(scope, ".") {
+		var next *cobra.Command
+		for _, c := range cmd.Commands() {
+			if c.Name() == name {
+				next = c
+			}
+		}
+		if next == nil {
+			return nil
+		}
+		cmd = next
+	}
+	return cmd
+}
+
+// isFlagOf reports whether cmd, unless nil, has the flag name, inherited
+// ones included.
+func isFlagOf(cmd *cobra.Command, name string) bool {
+	return cmd != nil && (cmd.Flags().Lookup(name) != nil || cmd.InheritedFlags().Lookup(name) != nil)
+}
+
+// isKnownSetting reports whether a key names a flag of some command of
+// root, or of the command of its scope.
+func isKnownSetting(root *cobra.Command, key string) bool {
+	scope, name := splitConfigKey(key)
+	if name == "help" || name == "config" {
+		return false
+	}
+	if scope != "" {
+		return isFlagOf(findScope(root, scope), name)
+	}
+	known := false
+	var visit func(*cobra.Command)
+	visit = func(cmd *cobra.Command) {
+		if cmd.Flags().Lookup(name) != nil || cmd.PersistentFlags().Lookup(name) != nil {
+			known = true
+		}
+		for _, c := range cmd.Commands() {
+			visit(c)
+		}
+	}
+	visit(root)
+	return known
+}
+
+func runConfigShow(cmd *cobra.Command, args []string) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	settings := cfg.all(cmd.Root())
+	if structuredOutput() {
+		records := make([]record, len(settings))
+		for i, s := range settings {
+			records[i] = s
+		}
+		return writeRecords("", outputFormat, records)
+	}
+	printConfig(os.Stdout, cfg, settings)
+	return nil
+}
+
+func printConfig(w io.Writer, cfg *config, settings []configSetting) {
+	if cfg.path != "" {
+		fmt.Fprintf(w, "Config file: %s\n", cfg.path)
+	} else {
+		fmt.Fprintf(w, "Config file: none (looked for %s)\n", strings.Join(configCandidates(), ", "))
+	}
+	if len(settings) == 0 {
+		fmt.Fprintln(w, "No settings")
+		return
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "KEY\tVALUE\tSOURCE\tNOTE")
+	for _, s := range settings {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", s.Key, s.Value, s.Source, s.Note)
+	}
+	tw.Flush()
+}
@@ -0,0 +1,105 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/lollipopkit/goimagehash"
+	"github.com/lollipopkit/goimagehash/hashdb"
+	"github.com/lollipopkit/goimagehash/index"
+)
+
+// hashDatabaseExtensions lists the extensions of the hash databases that
+// batch, index build and search accept in place of images.
+var hashDatabaseExtensions = []string{"csv", "json", "jsonl", "ndjson"}
+
+// isHashDatabase reports whether path is a hash database file rather than
+// an image, a directory or an archive.
+func isHashDatabase(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.Mode().IsRegular() && hasExtension(path, hashDatabaseExtensions)
+}
+
+// loadHashDatabase reads the hashes of a hash database written by batch -o
+// or --output-format, or of an index file. Failures recorded in the
+// database are returned as failures.
+func loadHashDatabase(path string) ([]hashResult, error) {
+	records, err := hashdb.Load(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read hash database: %w", err)
+	}
+	results := make([]hashResult, len(records))
+	for i, r := range records {
+		results[i] = hashResult{ID: r.Path, Hash: r.Hash}
+		if r.Error != "" {
+			results[i].Err = errors.New(r.Error)
+		}
+	}
+	verbosef("Read %d hashes from %s\n", len(results), path)
+	return results, nil
+}
+
+// adoptAlgorithm selects the algorithm of stored hashes, unless -t was
+// given, so that images are hashed comparably. Hashes of several
+// algorithms select nothing.
+func adoptAlgorithm(results []hashResult) error {
+	flags := RootCmd.PersistentFlags()
+	if flags.Changed("hash-type") || flags.Changed("hash-size") || flags.Changed("width") || flags.Changed("height") {
+		return nil
+	}
+	var selected *goimagehash.Algorithm
+	for _, r := range results {
+		if r.Err != nil {
+			continue
+		}
+		a, err := algorithmOf(r.Hash)
+		if err != nil {
+			return fmt.Errorf("%s: %w", r.ID, err)
+		}
+		if selected != nil && *selected != a {
+			verbosef("The stored hashes have several algorithms, images are hashed with %s\n", algorithmName())
+			return nil
+		}
+		selected = &a
+	}
+	if selected != nil {
+		hashType = selected.String()
+		verbosef("Hashing images with %s, the algorithm of the stored hashes\n", hashType)
+	}
+	return nil
+}
+
+// algorithmOf returns the algorithm h was computed with. Hashes parsed from
+// their canonical form do not know their size and are assumed square.
+func algorithmOf(h *goimagehash.ExtImageHash) (goimagehash.Algorithm, error) {
+	a := goimagehash.Algorithm{Kind: h.GetKind()}
+	a.Width, a.Height = h.Size()
+	if a.Width == 0 || a.Height == 0 {
+		size, err := sizeForBits(a.Kind, h.Bits())
+		if err != nil {
+			return a, err
+		}
+		a.Width, a.Height = size, size
+	}
+	return a, nil
+}
+
+// loadIndex returns an index of the hashes of an index file or a hash
+// database. Failures recorded in a database are skipped.
+func loadIndex(path string) (*index.Index, error) {
+	results, err := loadHashDatabase(path)
+	if err != nil {
+		return nil, err
+	}
+	x := index.New()
+	for _, r := range results {
+		if r.Err != nil {
+			continue
+		}
+		if err := x.Add(r.ID, r.Hash); err != nil {
+			return nil, fmt.Errorf("%s: %w", r.ID, err)
+		}
+	}
+	return x, nil
+}
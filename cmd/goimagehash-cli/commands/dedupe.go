@@ -0,0 +1,141 @@
+package commands
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/lollipopkit/goimagehash/cluster"
+	"github.com/lollipopkit/goimagehash/dedupe"
+)
+
+var (
+	keepPolicy  string
+	preferPaths []string
+	dupAction   string
+	moveTo      string
+	applyAction bool
+)
+
+// duplicatePolicy returns the policy and the action configured by the
+// batch flags, checking them before any image is hashed.
+func duplicatePolicy() (dedupe.Policy, dedupe.Action, error) {
+	spec := keepPolicy
+	if len(preferPaths) > 0 && !strings.Contains(spec, "path") {
+		spec = "path," + spec
+	}
+	policy, err := dedupe.ParsePolicy(spec, preferPaths)
+	if err != nil {
+		return nil, dedupe.None, err
+	}
+	action, err := dedupe.ParseAction(dupAction)
+	if err != nil {
+		return nil, dedupe.None, err
+	}
+	if action == dedupe.Move && moveTo == "" {
+		return nil, dedupe.None, fmt.Errorf("--action move requires --move-to")
+	}
+	return policy, action, nil
+}
+
+// planDuplicates ranks the members of every group and returns the plan
+// along with the decision (keep or remove) of every file.
+func planDuplicates(groups []cluster.Cluster, policy dedupe.Policy) (dedupe.Plan, map[string]string, error) {
+	var files [][]dedupe.File
+	for _, g := range groups {
+		var group []dedupe.File
+		for _, m := range g.Members {
+			f, err := inspectImage(m.ID)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to inspect %s: %w", m.ID, err)
+			}
+			group = append(group, f)
+		}
+		files = append(files, group)
+	}
+	plan := dedupe.Resolve(files, policy)
+	decisions := make(map[string]string)
+	for _, d := range plan {
+		decisions[d.Keep.Path] = "keep"
+		for _, f := range d.Remove {
+			decisions[f.Path] = "remove"
+		}
+	}
+	return plan, decisions, nil
+}
+
+// inspectImage returns the description of the image with the given
+// identifier, which may name an archive entry.
+func inspectImage(id string) (dedupe.File, error) {
+	if _, _, ok := splitArchiveID(id); !ok {
+		return dedupe.Inspect(id)
+	}
+	rc, entry, err := openImageSource(id)
+	if err != nil {
+		return dedupe.File{}, err
+	}
+	defer rc.Close()
+	content, err := io.ReadAll(rc)
+	if err != nil {
+		return dedupe.File{}, err
+	}
+	return dedupe.InspectReader(id, bytes.NewReader(content), entry.Size, entry.ModTime)
+}
+
+// skipArchiveEntries removes from the plan the files that action can not
+// touch because they are inside an archive, or because the kept file a link
+// would point to is.
+func skipArchiveEntries(plan dedupe.Plan, action dedupe.Action) dedupe.Plan {
+	inArchive := func(f dedupe.File) bool {
+		_, _, ok := splitArchiveID(f.Path)
+		return ok
+	}
+	var kept dedupe.Plan
+	for _, d := range plan {
+		linked := action == dedupe.Hardlink || action == dedupe.Symlink
+		var remove []dedupe.File
+		for _, f := range d.Remove {
+			if inArchive(f) || (linked && inArchive(d.Keep)) {
+				infof("Skipping %s: files inside archives can not be changed\n", f.Path)
+				continue
+			}
+			remove = append(remove, f)
+		}
+		if len(remove) > 0 {
+			kept = append(kept, dedupe.Decision{Keep: d.Keep, Remove: remove})
+		}
+	}
+	return kept
+}
+
+// applyPlan performs action on the files to remove, or only prints the
+// operations unless --apply is set.
+func applyPlan(plan dedupe.Plan, action dedupe.Action) error {
+	if action == dedupe.None {
+		return nil
+	}
+	plan = skipArchiveEntries(plan, action)
+	ops, err := plan.Apply(dedupe.Options{Action: action, MoveTo: moveTo, DryRun: !applyAction})
+	if len(ops) == 0 {
+		// Every copy is a link to the kept file.
+		infof("Nothing to %s\n", action)
+		return err
+	}
+	if applyAction {
+		infof("Performed %s:\n", action)
+	} else {
+		infof("Dry run, pass --apply to perform:\n")
+	}
+	for _, op := range ops {
+		switch {
+		case !applyAction:
+			infof("  would %s\n", op)
+		case op.Err != nil:
+			infof("  failed to %s: %v\n", op, op.Err)
+		default:
+			infof("  %s\n", op)
+		}
+	}
+	return err
+}
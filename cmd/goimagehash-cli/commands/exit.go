@@ -0,0 +1,116 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/spf13/pflag"
+)
+
+// Exit codes of goimagehash-cli.
+const (
+	// ExitOK is returned on success, and by compare for similar images.
+	ExitOK = 0
+	// ExitDifferent is returned by compare for images that are not similar.
+	ExitDifferent = 1
+	// ExitError is returned when the command failed: invalid arguments,
+	// unreadable input, or a failed file with --fail-on-error.
+	ExitError = 2
+	// ExitPartial is returned when the command completed but some files
+	// could not be processed, unless --skip-errors is set.
+	ExitPartial = 3
+)
+
+var (
+	failOnError bool
+	skipErrors  bool
+)
+
+// exitError is an error leading to a given exit code. A nil err means that
+// the outcome was already reported and nothing is printed.
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string {
+	if e.err == nil {
+		return fmt.Sprintf("exit code %d", e.code)
+	}
+	return e.err.Error()
+}
+
+func (e *exitError) Unwrap() error {
+	return e.err
+}
+
+// Execute runs the command selected by the arguments, prints its error, and
+// returns the exit code of the process.
+func Execute() int {
+	err := RootCmd.Execute()
+	if err == nil {
+		return ExitOK
+	}
+	var exit *exitError
+	if errors.As(err, &exit) {
+		if exit.err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", exit.err)
+		}
+		return exit.code
+	}
+	fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	return ExitError
+}
+
+// addErrorFlags adds the flags choosing how failed files affect the exit
+// code to a command processing many files.
+func addErrorFlags(flags *pflag.FlagSet) {
+	flags.BoolVar(&failOnError, "fail-on-error", false, "Stop at the first file that can not be processed, with exit code 2")
+	flags.BoolVar(&skipErrors, "skip-errors", false, "Exit with code 0 even if some files could not be processed")
+}
+
+// checkErrorFlags rejects --fail-on-error along with --skip-errors.
+func checkErrorFlags() error {
+	if failOnError && skipErrors {
+		return fmt.Errorf("--fail-on-error and --skip-errors can not be used together")
+	}
+	return nil
+}
+
+// firstFailure returns the error of the first failed result, or nil. With
+// --fail-on-error, remaining files are canceled once a file fails, and
+// their errors are not failures of their own.
+func firstFailure(results []hashResult) error {
+	for _, r := range results {
+		if r.Err != nil && !errors.Is(r.Err, context.Canceled) {
+			return &exitError{code: ExitError, err: fmt.Errorf("%s: %w", r.ID, r.Err)}
+		}
+	}
+	return nil
+}
+
+// reportFailures prints the summary of the files that could not be
+// processed to the standard error, and returns the error leading to
+// ExitPartial unless --skip-errors is set. Structured output also carries
+// the failures in its records.
+func reportFailures(results []hashResult) error {
+	var failed []hashResult
+	for _, r := range results {
+		if r.Err != nil {
+			failed = append(failed, r)
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	fmt.Fprintf(os.Stderr, "%d of %d files could not be processed:\n", len(failed), len(results))
+	for _, r := range failed {
+		fmt.Fprintf(os.Stderr, "  %s: %v\n", r.ID, r.Err)
+	}
+	if skipErrors {
+		return nil
+	}
+	return &exitError{code: ExitPartial}
+}
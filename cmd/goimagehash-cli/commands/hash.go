@@ -1,24 +1,26 @@
 package commands
 
 import (
+	"encoding/base64"
 	"encoding/hex"
 	"fmt"
-	"image"
-	_ "image/gif"
-	_ "image/jpeg"
-	_ "image/png"
-	"os"
+	"math"
+	"math/big"
 	"path/filepath"
+	"strings"
 
 	"github.com/lollipopkit/goimagehash"
 	"github.com/spf13/cobra"
 )
 
 var (
-	outputFormat string
+	hashEncoding string
 	bits         int
 )
 
+// hashEncodings lists the values of hash --format.
+var hashEncodings = []string{"canonical", "binary", "hex", "base64", "base64url", "imghash-base64", "decimal"}
+
 // hashCmd represents the hash command
 var hashCmd = &cobra.Command{
 	Use:   "hash [image_file]",
@@ -26,131 +28,220 @@ var hashCmd = &cobra.Command{
 	Long: `Compute the perceptual hash of an image using the specified algorithm.
 Supported formats: JPEG, PNG, GIF, and other formats supported by Go's image package.
 
+The hash is printed in one of these encodings:
+  canonical  kind code and hex digits, e.g. p:af97d2205c6b1f82 (parsed back by every command)
+  binary     one 0 or 1 per bit, bit 0 first
+  hex        hash bytes in hexadecimal, bit 0 being the most significant bit
+  base64     hash bytes in unpadded standard base64
+  base64url  hash bytes in unpadded URL safe base64
+  imghash-base64
+             unpadded standard base64 of the bits packed bit 0 first, the
+             least significant bit of each byte, as by ToBase64 and the Rust
+             img_hash library
+  decimal    the bits read as one unsigned integer, bit 0 first
+
+The image can be "-" to read it from the standard input, or an entry of a
+zip or tar archive such as "photos.zip!/2019/a.jpg".
+
+Larger hashes are computed with --bits, or with --hash-size, --width and
+--height.
+
 Examples:
   goimagehash-cli hash image.jpg
   goimagehash-cli hash -t perception image.png
-  goimagehash-cli hash -t average -f hex image.jpg`,
+  goimagehash-cli hash -t average -f hex image.jpg
+  goimagehash-cli hash -t perception -b 256 -f base64url image.jpg
+  goimagehash-cli hash -t dgrad --width 16 --height 16 image.jpg
+  cat image.jpg | goimagehash-cli hash -`,
 	Args: cobra.ExactArgs(1),
 	RunE: runHash,
 }
 
 func init() {
-	hashCmd.Flags().StringVarP(&outputFormat, "format", "f", "binary", "Output format (binary, hex, base64)")
-	hashCmd.Flags().IntVarP(&bits, "bits", "b", 64, "Hash bits (for extended hashes)")
+	hashCmd.Flags().StringVarP(&hashEncoding, "format", "f", "canonical", "Hash encoding ("+strings.Join(hashEncodings, ", ")+")")
+	hashCmd.Flags().IntVarP(&bits, "bits", "b", 0, "Hash bits, e.g. 256 for a 16x16 hash [default: 64]")
 }
 
 func runHash(cmd *cobra.Command, args []string) error {
+	if err := checkOutputFormat(); err != nil {
+		return err
+	}
+	algorithm, err := hashAlgorithm()
+	if err != nil {
+		return err
+	}
+	if _, err := encodeHash(goimagehash.NewExtImageHash([]uint64{0}, algorithm.Kind, 1), hashEncoding); err != nil {
+		return err
+	}
 	imagePath := args[0]
-	
-	if verbose {
-		fmt.Printf("Processing image: %s\n", imagePath)
-		fmt.Printf("Hash algorithm: %s\n", hashType)
-		fmt.Printf("Output format: %s\n", outputFormat)
+
+	verbosef("Processing image: %s\n", imagePath)
+	verbosef("Hash algorithm: %s\n", algorithm)
+	verbosef("Output format: %s\n", hashEncoding)
+
+	var hash *goimagehash.ExtImageHash
+	img, err := loadImage(imagePath)
+	if err == nil {
+		hash, err = algorithm.Hash(img)
+		if err != nil {
+			err = fmt.Errorf("failed to compute hash: %w", err)
+		}
 	}
 
-	// Open and decode image
-	file, err := os.Open(imagePath)
+	if structuredOutput() {
+		rec := newHashRecord(imagePath, algorithm.String(), hash, err)
+		if werr := writeRecords("", outputFormat, []record{rec}); werr != nil {
+			return werr
+		}
+		return err
+	}
 	if err != nil {
-		return fmt.Errorf("failed to open image file: %w", err)
+		return err
 	}
-	defer file.Close()
 
-	img, _, err := image.Decode(file)
+	output, err := encodeHash(hash, hashEncoding)
 	if err != nil {
-		return fmt.Errorf("failed to decode image: %w", err)
+		return err
 	}
+	fmt.Println(output)
 
-	// Compute hash
-	var output string
-	var hashKind goimagehash.Kind
-	var hashBits int
+	verbosef("Hash type: %v\n", hash.GetKind())
+	verbosef("Bits: %d\n", hash.Bits())
+	verbosef("File: %s\n", filepath.Base(imagePath))
 
-	switch hashType {
-	case "average", "ahash":
-		hash, err := goimagehash.AverageHash(img)
+	return nil
+}
+
+// hashAlgorithm returns the selected algorithm, sized after --bits unless
+// another size flag is set.
+func hashAlgorithm() (goimagehash.Algorithm, error) {
+	if bits < 0 {
+		return goimagehash.Algorithm{}, fmt.Errorf("hash size can not be negative")
+	}
+	if bits > 0 && hashSize == 0 && hashWidth == 0 && hashHeight == 0 {
+		a, err := goimagehash.ParseAlgorithm(hashType)
 		if err != nil {
-			return fmt.Errorf("failed to compute hash: %w", err)
+			return a, err
 		}
-		switch outputFormat {
-		case "binary":
-			output = hash.ToString()
-		case "hex":
-			output = fmt.Sprintf("%x", hash.GetHash())
-		case "base64":
-			output = hex.EncodeToString([]byte{byte(hash.GetKind())}) + fmt.Sprintf("0x%x", hash.GetHash())
-		default:
-			return fmt.Errorf("unsupported output format: %s", outputFormat)
+		if hashSize, err = sizeForBits(a.Kind, bits); err != nil {
+			return a, err
 		}
-		hashKind = hash.GetKind()
-		hashBits = hash.Bits()
+	}
+	a, err := selectedAlgorithm()
+	if err != nil {
+		return a, err
+	}
+	if bits > 0 && a.Bits() != bits {
+		return a, fmt.Errorf("--bits %d does not match the %d bits of a %s hash", bits, a.Bits(), a)
+	}
+	return a, nil
+}
 
-	case "difference", "dhash":
-		hash, err := goimagehash.DifferenceHash(img)
-		if err != nil {
-			return fmt.Errorf("failed to compute hash: %w", err)
+// sizeForBits returns the side of the square hash of the given kind having
+// the given number of bits.
+func sizeForBits(kind goimagehash.Kind, bits int) (int, error) {
+	if kind == goimagehash.DGHash {
+		for size := 2; size <= 1024; size += 2 {
+			if (goimagehash.Algorithm{Kind: kind, Width: size, Height: size}).Bits() == bits {
+				return size, nil
+			}
 		}
-		switch outputFormat {
-		case "binary":
-			output = hash.ToString()
-		case "hex":
-			output = fmt.Sprintf("%x", hash.GetHash())
-		case "base64":
-			output = hex.EncodeToString([]byte{byte(hash.GetKind())}) + fmt.Sprintf("0x%x", hash.GetHash())
-		default:
-			return fmt.Errorf("unsupported output format: %s", outputFormat)
+		return 0, fmt.Errorf("no square %v hash has %d bits", kind, bits)
+	}
+	size := int(math.Sqrt(float64(bits)) + 0.5)
+	if size*size != bits {
+		return 0, fmt.Errorf("%d bits is not a square hash size, use --width and --height", bits)
+	}
+	return size, nil
+}
+
+// encodeHash returns the hash in the given encoding.
+func encodeHash(h *goimagehash.ExtImageHash, encoding string) (string, error) {
+	switch encoding {
+	case "canonical":
+		return h.String(), nil
+	case "binary":
+		var sb strings.Builder
+		for i := 0; i < h.Bits(); i++ {
+			if h.Bit(i) {
+				sb.WriteByte('1')
+			} else {
+				sb.WriteByte('0')
+			}
 		}
-		hashKind = hash.GetKind()
-		hashBits = hash.Bits()
+		return sb.String(), nil
+	case "hex":
+		return hex.EncodeToString(h.Bytes()), nil
+	case "base64":
+		return base64.RawStdEncoding.EncodeToString(h.Bytes()), nil
+	case "base64url":
+		return base64.RawURLEncoding.EncodeToString(h.Bytes()), nil
+	case "imghash-base64":
+		return h.ToBase64(), nil
+	case "decimal":
+		b := h.Bytes()
+		n := new(big.Int).SetBytes(b)
+		// Drop the zero padding of the last byte.
+		n.Rsh(n, uint(len(b)*8-h.Bits()))
+		return n.String(), nil
+	}
+	return "", fmt.Errorf("unsupported output format: %s (use %s)", encoding, strings.Join(hashEncodings, ", "))
+}
 
-	case "perception", "phash":
-		hash, err := goimagehash.PerceptionHash(img)
-		if err != nil {
-			return fmt.Errorf("failed to compute hash: %w", err)
+// decodeHash parses a hash printed by the hash command in the given
+// encoding, or, when it is empty, a canonical hash or hex digits prefixed by
+// 0x. Other encodings are not guessed, as the same digits can be valid in
+// several of them. Hashes without a kind code are of algorithm a.
+func decodeHash(s string, a goimagehash.Algorithm, encoding string) (*goimagehash.ExtImageHash, error) {
+	if encoding == "" || encoding == "canonical" {
+		if strings.Contains(s, ":") {
+			return goimagehash.ParseExtImageHash(s)
 		}
-		switch outputFormat {
-		case "binary":
-			output = hash.ToString()
-		case "hex":
-			output = fmt.Sprintf("%x", hash.GetHash())
-		case "base64":
-			output = hex.EncodeToString([]byte{byte(hash.GetKind())}) + fmt.Sprintf("0x%x", hash.GetHash())
-		default:
-			return fmt.Errorf("unsupported output format: %s", outputFormat)
+		if digits, ok := strings.CutPrefix(s, "0x"); ok && encoding == "" {
+			s, encoding = digits, "hex"
+		} else {
+			return nil, fmt.Errorf("%q is not a canonical hash, use --query-format for other encodings", s)
 		}
-		hashKind = hash.GetKind()
-		hashBits = hash.Bits()
-
-	case "double-gradient", "dgrad":
-		// For DoubleGradient, use ExtImageHash with base64 format by default
-		extHash, err := goimagehash.DoubleGradientHash(img, 8, 8)
+	}
+	bits := a.Bits()
+	size := (bits + 7) / 8
+	fromBytes := func(b []byte, err error) (*goimagehash.ExtImageHash, error) {
 		if err != nil {
-			return fmt.Errorf("failed to compute double gradient hash: %w", err)
+			return nil, fmt.Errorf("%q is not a %s hash: %w", s, encoding, err)
 		}
-		
-		switch outputFormat {
-		case "binary":
-			output = extHash.ToString()
-		case "hex":
-			output = fmt.Sprintf("%x", extHash.GetHash())
-		case "base64":
-			output = extHash.ToBase64()
-		default:
-			return fmt.Errorf("unsupported output format: %s", outputFormat)
+		if len(b) != size {
+			return nil, fmt.Errorf("%q is not a %d bits %v hash", s, bits, a.Kind)
 		}
-		hashKind = extHash.GetKind()
-		hashBits = extHash.Bits()
-
-	default:
-		return fmt.Errorf("unsupported hash type: %s. Use: average, difference, perception, double-gradient", hashType)
+		return goimagehash.ExtImageHashFromBytes(b, a.Kind, bits)
 	}
-
-	fmt.Println(output)
-
-	if verbose {
-		fmt.Printf("Hash type: %v\n", hashKind)
-		fmt.Printf("Bits: %d\n", hashBits)
-		fmt.Printf("File: %s\n", filepath.Base(imagePath))
+	switch encoding {
+	case "binary":
+		if len(s) != bits || strings.Trim(s, "01") != "" {
+			return nil, fmt.Errorf("%q is not a %d bits binary hash", s, bits)
+		}
+		b := make([]byte, size)
+		for i := 0; i < bits; i++ {
+			if s[i] == '1' {
+				b[i/8] |= 0x80 >> uint(i%8)
+			}
+		}
+		return fromBytes(b, nil)
+	case "hex":
+		return fromBytes(hex.DecodeString(s))
+	case "base64":
+		return fromBytes(base64.RawStdEncoding.DecodeString(s))
+	case "base64url":
+		return fromBytes(base64.RawURLEncoding.DecodeString(s))
+	case "imghash-base64":
+		return goimagehash.ExtImageHashFromBase64(s, a.Kind, bits)
+	case "decimal":
+		n, ok := new(big.Int).SetString(s, 10)
+		if !ok || n.Sign() < 0 || n.BitLen() > bits {
+			return nil, fmt.Errorf("%q is not a %d bits decimal hash", s, bits)
+		}
+		// Restore the zero padding of the last byte dropped by encodeHash.
+		n.Lsh(n, uint(size*8-bits))
+		return fromBytes(n.FillBytes(make([]byte, size)), nil)
 	}
-
-	return nil
-}
\ No newline at end of file
+	return nil, fmt.Errorf("unsupported query format: %s (use %s)", encoding, strings.Join(hashEncodings, ", "))
+}
@@ -0,0 +1,135 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/lollipopkit/goimagehash/index"
+	"github.com/spf13/cobra"
+)
+
+var (
+	indexFile   string
+	indexUpdate bool
+)
+
+// indexCmd represents the index command
+var indexCmd = &cobra.Command{
+	Use:   "index",
+	Short: "Build indexes of image hashes for the search command",
+}
+
+var indexBuildCmd = &cobra.Command{
+	Use:   "build [directory|archive|database...]",
+	Short: "Hash the images of directories and save them to an index file",
+	Long: `Hash the images of directories and archives with the selected algorithm and
+save the hashes to an index file, which search, match and watch read.
+
+The index file holds one JSON object per line with the image path and its
+hash, computed with the -t algorithm. Hashes of different algorithms never
+match each other, and search hashes its queries with every algorithm of the
+index. With --update, the images are added to an existing
+index, replacing the hashes of images indexed before.
+
+Hash databases written by batch -o or --output-format (CSV, JSON or JSON
+Lines) are indexed without hashing their images again.
+
+Examples:
+  goimagehash-cli index build -r --index photos.jsonl ./photos
+  goimagehash-cli index build -t phash:16x16 -r --index photos-p16.jsonl ./photos
+  goimagehash-cli index build --update --index photos.jsonl ./new-photos
+  goimagehash-cli index build --index photos.jsonl hashes.csv`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: runIndexBuild,
+}
+
+func init() {
+	indexBuildCmd.Flags().StringVar(&indexFile, "index", "", "Index file to write (required)")
+	indexBuildCmd.MarkFlagRequired("index")
+	indexBuildCmd.Flags().BoolVar(&indexUpdate, "update", false, "Add to the existing index instead of replacing it")
+	indexBuildCmd.Flags().BoolVarP(&recursive, "recursive", "r", false, "Process directories recursively")
+	indexBuildCmd.Flags().StringSliceVarP(&extensions, "extensions", "e", defaultExtensions, "File extensions to process")
+	indexBuildCmd.Flags().BoolVar(&walkArchives, "archives", false, "Also process images inside zip, tar, tar.gz and tgz archives")
+	addCacheFlags(indexBuildCmd.Flags(), true)
+	addErrorFlags(indexBuildCmd.Flags())
+	indexCmd.AddCommand(indexBuildCmd)
+}
+
+func runIndexBuild(cmd *cobra.Command, args []string) error {
+	if err := checkOutputFormat(); err != nil {
+		return err
+	}
+	x := index.New()
+	if indexUpdate {
+		loaded, err := index.Load(indexFile)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to load index: %w", err)
+		}
+		if loaded != nil {
+			x = loaded
+			verbosef("Loaded %d hashes from %s\n", x.Len(), indexFile)
+		}
+	}
+
+	var ids []string
+	var failures, stored []hashResult
+	for _, dir := range args {
+		if isHashDatabase(dir) {
+			results, err := loadHashDatabase(dir)
+			if err != nil {
+				return err
+			}
+			stored = append(stored, results...)
+			continue
+		}
+		found, failed, err := findImageFiles(dir, recursive, extensions)
+		if err != nil {
+			return fmt.Errorf("failed to find image files: %w", err)
+		}
+		ids = append(ids, found...)
+		failures = append(failures, failed...)
+	}
+	verbosef("Found %d image files\n", len(ids))
+
+	hashCache, err := openCache()
+	if err != nil {
+		return err
+	}
+	results := append(append(hashFiles(ids, hashCache), failures...), stored...)
+	saveCache(hashCache)
+	if failOnError {
+		if err := firstFailure(results); err != nil {
+			return err
+		}
+	}
+
+	var records []record
+	indexed := 0
+	for i, r := range results {
+		if r.Err == nil {
+			if r.Err = x.Add(r.ID, r.Hash); r.Err == nil {
+				indexed++
+			}
+			results[i].Err = r.Err
+		}
+		name := algorithmName()
+		if r.Hash != nil {
+			if a, err := algorithmOf(r.Hash); err == nil {
+				name = a.String()
+			}
+		}
+		records = append(records, newHashRecord(r.ID, name, r.Hash, r.Err))
+	}
+
+	if err := x.Save(indexFile); err != nil {
+		return fmt.Errorf("failed to save index: %w", err)
+	}
+	if structuredOutput() {
+		if err := writeRecords("", outputFormat, records); err != nil {
+			return err
+		}
+	}
+	infof("Indexed %d images, %d hashes written to %s\n", indexed, x.Len(), indexFile)
+	return reportFailures(results)
+}
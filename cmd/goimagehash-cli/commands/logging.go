@@ -0,0 +1,121 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	logLevel  string
+	logFormat string
+)
+
+// logger receives the notes of every command. It is replaced by
+// setupLogging once the flags are parsed.
+var logger = slog.New(newTextHandler(os.Stderr, slog.LevelWarn))
+
+// setupLogging creates the logger of --log-level and --log-format. The
+// level defaults to warn, or debug with --verbose.
+func setupLogging() error {
+	level := slog.LevelWarn
+	if verbose {
+		level = slog.LevelDebug
+	}
+	if logLevel != "" {
+		if err := level.UnmarshalText([]byte(logLevel)); err != nil {
+			return fmt.Errorf("invalid --log-level %q: use debug, info, warn or error", logLevel)
+		}
+	}
+	switch logFormat {
+	case "text":
+		logger = slog.New(newTextHandler(os.Stderr, level))
+	case "json":
+		logger = slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: level}))
+	default:
+		return fmt.Errorf("invalid --log-format %q: use text or json", logFormat)
+	}
+	return nil
+}
+
+// textHandler writes log records for humans: the message and its
+// attributes as key=value pairs, without time, and prefixed by the level
+// from warn up.
+type textHandler struct {
+	mu     *sync.Mutex
+	w      io.Writer
+	level  slog.Leveler
+	prefix string
+	attrs  []slog.Attr
+}
+
+func newTextHandler(w io.Writer, level slog.Leveler) *textHandler {
+	return &textHandler{mu: new(sync.Mutex), w: w, level: level}
+}
+
+func (h *textHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+func (h *textHandler) Handle(ctx context.Context, r slog.Record) error {
+	var sb strings.Builder
+	if r.Level >= slog.LevelWarn {
+		sb.WriteString(r.Level.String())
+		sb.WriteString(": ")
+	}
+	sb.WriteString(r.Message)
+	for _, a := range h.attrs {
+		writeAttr(&sb, "", a)
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		writeAttr(&sb, h.prefix, a)
+		return true
+	})
+	sb.WriteByte('\n')
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := io.WriteString(h.w, sb.String())
+	return err
+}
+
+func (h *textHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	c := *h
+	c.attrs = append([]slog.Attr(nil), h.attrs...)
+	for _, a := range attrs {
+		c.attrs = append(c.attrs, slog.Attr{Key: h.prefix + a.Key, Value: a.Value})
+	}
+	return &c
+}
+
+func (h *textHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	c := *h
+	c.prefix = h.prefix + name + "."
+	return &c
+}
+
+// writeAttr writes a as " key=value", quoting values with spaces.
+func writeAttr(sb *strings.Builder, prefix string, a slog.Attr) {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+	if a.Value.Kind() == slog.KindGroup {
+		for _, g := range a.Value.Group() {
+			writeAttr(sb, prefix+a.Key+".", g)
+		}
+		return
+	}
+	value := a.Value.String()
+	if value == "" || strings.ContainsAny(value, " \t\n\"=") {
+		value = strconv.Quote(value)
+	}
+	fmt.Fprintf(sb, " %s%s=%s", prefix, a.Key, value)
+}
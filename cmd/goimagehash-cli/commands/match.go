@@ -0,0 +1,239 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/lollipopkit/goimagehash"
+	"github.com/lollipopkit/goimagehash/cache"
+	"github.com/lollipopkit/goimagehash/index"
+	"github.com/spf13/cobra"
+)
+
+var (
+	matchK           int
+	matchMaxDistance int
+	matchUnmatched   bool
+)
+
+// matchCmd represents the match command
+var matchCmd = &cobra.Command{
+	Use:   "match [query] [reference]",
+	Short: "Find the images of a query set that appear in a reference set",
+	Long: `Find, for each image of the query set, its closest images in the reference
+set, e.g. which incoming files already exist in an archive.
+
+Each set is one of:
+  a directory or a zip or tar archive, whose images are hashed
+  an index file built by "index build" or "watch"
+  a hash database: a CSV, JSON or JSON Lines file written by batch -o or
+  --output-format
+
+The reference set is loaded into an index, so that each query is compared
+with a few reference hashes only. When one set holds hashes computed with a
+single algorithm and -t is not given, the images of the other set are hashed
+with that algorithm.
+
+At most -k matches within the distance are listed per query. --max-distance
+defaults to --threshold, or --similarity when set.
+
+Examples:
+  goimagehash-cli match ./incoming ./archive
+  goimagehash-cli match -r ./incoming archive.jsonl
+  goimagehash-cli match --unmatched -r ./incoming archive.jsonl
+  goimagehash-cli match -k 3 --output-format csv hashes.csv archive.jsonl`,
+	Args: cobra.ExactArgs(2),
+	RunE: runMatch,
+}
+
+func init() {
+	matchCmd.Flags().IntVarP(&matchK, "k", "k", 1, "Number of reference matches to list per query")
+	matchCmd.Flags().IntVar(&matchMaxDistance, "max-distance", -1, "Largest distance of a match [default: --threshold or --similarity]")
+	matchCmd.Flags().BoolVar(&matchUnmatched, "unmatched", false, "Only list the queries without a match")
+	matchCmd.Flags().BoolVarP(&recursive, "recursive", "r", false, "Process directories recursively")
+	matchCmd.Flags().StringSliceVarP(&extensions, "extensions", "e", defaultExtensions, "File extensions to process")
+	matchCmd.Flags().BoolVar(&walkArchives, "archives", false, "Also process images inside zip, tar, tar.gz and tgz archives")
+	addCacheFlags(matchCmd.Flags(), true)
+	addErrorFlags(matchCmd.Flags())
+}
+
+// matchRecord is a reference match of a query, a query without match, or
+// the error that prevented hashing a query.
+type matchRecord struct {
+	Query      string  `json:"query"`
+	QueryHash  string  `json:"query_hash"`
+	Rank       int     `json:"rank"`
+	Reference  string  `json:"reference"`
+	Hash       string  `json:"hash"`
+	Distance   int     `json:"distance"`
+	Similarity float64 `json:"similarity"`
+	Matched    bool    `json:"matched"`
+	Error      string  `json:"error"`
+}
+
+func (r matchRecord) csvHeader() []string {
+	return []string{"Query", "QueryHash", "Rank", "Reference", "Hash", "Distance", "Similarity", "Matched", "Error"}
+}
+
+func (r matchRecord) csvRow() []string {
+	rank, distance, similarity := "", "", ""
+	if r.Matched {
+		rank, distance, similarity = fmt.Sprint(r.Rank), fmt.Sprint(r.Distance), formatRate(r.Similarity)
+	}
+	return []string{r.Query, r.QueryHash, rank, r.Reference, r.Hash, distance, similarity, fmt.Sprint(r.Matched), r.Error}
+}
+
+func runMatch(cmd *cobra.Command, args []string) error {
+	if err := checkOutputFormat(); err != nil {
+		return err
+	}
+	if matchK <= 0 {
+		return fmt.Errorf("-k must be positive")
+	}
+	querySource, referenceSource := args[0], args[1]
+
+	// Read the stored hashes first: they select the algorithm the images of
+	// the other set are hashed with.
+	var queries, references []hashResult
+	var err error
+	if !isImageSource(querySource) {
+		if queries, err = loadHashDatabase(querySource); err != nil {
+			return err
+		}
+	}
+	if !isImageSource(referenceSource) {
+		if references, err = loadHashDatabase(referenceSource); err != nil {
+			return err
+		}
+	}
+	if err := adoptAlgorithm(append(append([]hashResult{}, queries...), references...)); err != nil {
+		return err
+	}
+
+	hashCache, err := openCache()
+	if err != nil {
+		return err
+	}
+	if isImageSource(querySource) {
+		if queries, err = hashSource(querySource, hashCache); err != nil {
+			return err
+		}
+	}
+	if isImageSource(referenceSource) {
+		if references, err = hashSource(referenceSource, hashCache); err != nil {
+			return err
+		}
+	}
+	saveCache(hashCache)
+	if failOnError {
+		if err := firstFailure(append(append([]hashResult{}, queries...), references...)); err != nil {
+			return err
+		}
+	}
+
+	x := index.New()
+	spaces := make(map[string]bool)
+	for i, r := range references {
+		if r.Err == nil {
+			references[i].Err = x.Add(r.ID, r.Hash)
+		}
+		if references[i].Err == nil {
+			spaces[hashSpace(r.Hash)] = true
+		}
+	}
+	verbosef("Matching %d queries against %d reference hashes\n", len(queries), x.Len())
+
+	var records []record
+	matched, incomparable := 0, 0
+	for _, q := range queries {
+		if q.Err != nil {
+			records = append(records, matchRecord{Query: q.ID, Error: q.Err.Error()})
+			continue
+		}
+		if !spaces[hashSpace(q.Hash)] {
+			incomparable++
+		}
+		limit := matchMaxDistance
+		if limit < 0 {
+			limit = maxDistance(q.Hash.Bits())
+		}
+		matches := x.Nearest(q.Hash, matchK, limit)
+		if len(matches) > 0 {
+			matched++
+		}
+		if matchUnmatched && len(matches) > 0 {
+			continue
+		}
+		if len(matches) == 0 {
+			records = append(records, matchRecord{Query: q.ID, QueryHash: q.Hash.String()})
+		}
+		for i, m := range matches {
+			records = append(records, matchRecord{
+				Query:      q.ID,
+				QueryHash:  q.Hash.String(),
+				Rank:       i + 1,
+				Reference:  m.ID,
+				Hash:       m.Hash.String(),
+				Distance:   m.Distance,
+				Similarity: 1 - float64(m.Distance)/float64(m.Hash.Bits()),
+				Matched:    true,
+			})
+		}
+	}
+
+	if structuredOutput() {
+		if err := writeRecords("", outputFormat, records); err != nil {
+			return err
+		}
+	} else {
+		printMatchRecords(records)
+	}
+	if incomparable > 0 {
+		logger.Warn("Queries without reference hash of the same algorithm and size, use -t to select it", "count", incomparable)
+	}
+	infof("%d of %d queries matched\n", matched, len(queries))
+	return reportFailures(append(queries, references...))
+}
+
+// hashSpace identifies the hashes comparable with h.
+func hashSpace(h *goimagehash.ExtImageHash) string {
+	return fmt.Sprintf("%v/%d", h.GetKind(), h.Bits())
+}
+
+// isImageSource reports whether source is a set of images, i.e. a
+// directory or an archive, rather than a file of hashes.
+func isImageSource(source string) bool {
+	info, err := os.Stat(source)
+	return err != nil || info.IsDir() || isArchive(source)
+}
+
+// hashSource hashes the images of a directory or an archive.
+func hashSource(source string, c *cache.Cache) ([]hashResult, error) {
+	ids, failures, err := findImageFiles(source, recursive, extensions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find image files: %w", err)
+	}
+	verbosef("Found %d image files in %s\n", len(ids), source)
+	return append(hashFiles(ids, c), failures...), nil
+}
+
+func printMatchRecords(records []record) {
+	if len(records) == 0 {
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "QUERY\tDISTANCE\tSIMILARITY\tREFERENCE")
+	for _, r := range records {
+		r := r.(matchRecord)
+		switch {
+		case r.Error != "":
+			continue
+		case !r.Matched:
+			fmt.Fprintf(w, "%s\t-\t-\t(no match)\n", r.Query)
+		default:
+			fmt.Fprintf(w, "%s\t%d\t%.4f\t%s\n", r.Query, r.Distance, r.Similarity, r.Reference)
+		}
+	}
+	w.Flush()
+}
@@ -0,0 +1,243 @@
+package commands
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/lollipopkit/goimagehash"
+	"github.com/lollipopkit/goimagehash/hashdb"
+)
+
+// outputFormats lists the values of --output-format.
+var outputFormats = []string{"text", "json", "jsonl", "csv"}
+
+// checkOutputFormat validates --output-format.
+func checkOutputFormat() error {
+	for _, f := range outputFormats {
+		if outputFormat == f {
+			return nil
+		}
+	}
+	return fmt.Errorf("unsupported output format: %s (use text, json, jsonl or csv)", outputFormat)
+}
+
+// tableFormat returns the format of commands printing a table: their own
+// --format flag when set, otherwise --output-format with text as a table.
+func tableFormat(flag string) (string, error) {
+	format := flag
+	if format == "" {
+		if err := checkOutputFormat(); err != nil {
+			return "", err
+		}
+		format = outputFormat
+		if format == "text" {
+			format = "table"
+		}
+	}
+	switch format {
+	case "table", "csv", "json", "jsonl":
+		return format, nil
+	}
+	return "", fmt.Errorf("unsupported output format: %s", format)
+}
+
+// structuredOutput reports whether commands emit records instead of text.
+func structuredOutput() bool {
+	return outputFormat != "text"
+}
+
+// record is a row of structured output. Fields are always present in JSON
+// so that the schema does not depend on the data.
+type record interface {
+	csvHeader() []string
+	csvRow() []string
+}
+
+// hashRecord is a hashed image, or the error that prevented hashing it,
+// written with the columns and fields read back by the hashdb package.
+type hashRecord struct {
+	hashdb.Record
+}
+
+func newHashRecord(path, algorithm string, h *goimagehash.ExtImageHash, err error) hashRecord {
+	return hashRecord{hashdb.NewRecord(path, algorithm, h, err)}
+}
+
+func (r hashRecord) csvHeader() []string {
+	return hashdb.Header
+}
+
+func (r hashRecord) csvRow() []string {
+	return r.CSVRow()
+}
+
+// compareRecord is the comparison of two images.
+type compareRecord struct {
+	Path1      string  `json:"path1"`
+	Path2      string  `json:"path2"`
+	Algorithm  string  `json:"algorithm"`
+	Bits       int     `json:"bits"`
+	Hash1      string  `json:"hash1"`
+	Hash2      string  `json:"hash2"`
+	Distance   int     `json:"distance"`
+	Similarity float64 `json:"similarity"`
+	Threshold  int     `json:"threshold"`
+	Similar    bool    `json:"similar"`
+	Error      string  `json:"error"`
+}
+
+func (r compareRecord) csvHeader() []string {
+	return []string{"File1", "File2", "Algorithm", "Bits", "Hash1", "Hash2", "Distance", "Similarity", "Threshold", "Similar", "Error"}
+}
+
+func (r compareRecord) csvRow() []string {
+	return []string{r.Path1, r.Path2, r.Algorithm, strconv.Itoa(r.Bits), r.Hash1, r.Hash2,
+		strconv.Itoa(r.Distance), strconv.FormatFloat(r.Similarity, 'f', 6, 64),
+		strconv.Itoa(r.Threshold), strconv.FormatBool(r.Similar), r.Error}
+}
+
+// groupRecord is an image of a group of similar images. Images that could
+// not be hashed have group 0 and an error.
+type groupRecord struct {
+	Group          int    `json:"group"`
+	Path           string `json:"path"`
+	Algorithm      string `json:"algorithm"`
+	Hash           string `json:"hash"`
+	Distance       int    `json:"distance"`
+	Representative bool   `json:"representative"`
+	Decision       string `json:"decision"`
+	Error          string `json:"error"`
+}
+
+func (r groupRecord) csvHeader() []string {
+	return []string{"Group", "File", "Hash", "Distance", "Decision", "Algorithm", "Representative", "Error"}
+}
+
+func (r groupRecord) csvRow() []string {
+	group := ""
+	if r.Group > 0 {
+		group = fmt.Sprintf("Group %d", r.Group)
+	}
+	return []string{group, r.Path, r.Hash, strconv.Itoa(r.Distance), r.Decision, r.Algorithm,
+		strconv.FormatBool(r.Representative), r.Error}
+}
+
+// recordWriter writes records in a structured format: a JSON array, one
+// JSON object per line, or CSV with a header row.
+type recordWriter struct {
+	format  string
+	w       io.Writer
+	csv     *csv.Writer
+	header  bool
+	records []record
+}
+
+func newRecordWriter(w io.Writer, format string) *recordWriter {
+	rw := &recordWriter{format: format, w: w}
+	if format == "csv" {
+		rw.csv = csv.NewWriter(w)
+	}
+	return rw
+}
+
+func (rw *recordWriter) Write(r record) error {
+	switch rw.format {
+	case "json":
+		rw.records = append(rw.records, r)
+		return nil
+	case "jsonl":
+		return json.NewEncoder(rw.w).Encode(r)
+	case "csv":
+		if !rw.header {
+			rw.header = true
+			if err := rw.csv.Write(r.csvHeader()); err != nil {
+				return err
+			}
+		}
+		return rw.csv.Write(r.csvRow())
+	}
+	return fmt.Errorf("unsupported output format: %s", rw.format)
+}
+
+// Flush method writes the buffered CSV rows. JSON arrays are only written
+// by Close.
+func (rw *recordWriter) Flush() error {
+	if rw.csv == nil {
+		return nil
+	}
+	rw.csv.Flush()
+	return rw.csv.Error()
+}
+
+// Close method writes the buffered JSON array or flushes the CSV writer.
+func (rw *recordWriter) Close() error {
+	switch rw.format {
+	case "json":
+		records := rw.records
+		if records == nil {
+			records = []record{}
+		}
+		enc := json.NewEncoder(rw.w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(records)
+	case "csv":
+		rw.csv.Flush()
+		return rw.csv.Error()
+	}
+	return nil
+}
+
+// writeRecords writes records to the file named path, or to the standard
+// output when path is empty, in the given format.
+func writeRecords(path, format string, records []record) error {
+	var w io.Writer = os.Stdout
+	if path != "" {
+		file, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		w = file
+	}
+	rw := newRecordWriter(w, format)
+	for _, r := range records {
+		if err := rw.Write(r); err != nil {
+			return err
+		}
+	}
+	return rw.Close()
+}
+
+// verbosef logs a progress note at the debug level, printed to the
+// standard error with --verbose or --log-level debug, keeping the standard
+// output for results.
+func verbosef(format string, args ...interface{}) {
+	if logger.Enabled(context.Background(), slog.LevelDebug) {
+		logger.Debug(strings.TrimSuffix(fmt.Sprintf(format, args...), "\n"))
+	}
+}
+
+// infof prints a note for humans: to the standard output in text mode, and
+// to the standard error when the standard output carries records.
+func infof(format string, args ...interface{}) {
+	if structuredOutput() {
+		fmt.Fprintf(os.Stderr, format, args...)
+	} else {
+		fmt.Printf(format, args...)
+	}
+}
+
+// reportError prints a per-file error to the standard error in text mode;
+// structured output carries errors in its records instead.
+func reportError(path string, err error) {
+	if !structuredOutput() {
+		fmt.Fprintf(os.Stderr, "Error: %s: %v\n", path, err)
+	}
+}
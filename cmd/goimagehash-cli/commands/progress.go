@@ -0,0 +1,145 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/lollipopkit/goimagehash/batch"
+)
+
+var (
+	progressMode     string
+	progressInterval time.Duration
+)
+
+// progressModes lists the values of --progress.
+var progressModes = []string{"auto", "bar", "lines", "none"}
+
+// barRefresh is the time between two redraws of the progress bar.
+const barRefresh = 100 * time.Millisecond
+
+// barWidth is the number of cells of the progress bar.
+const barWidth = 30
+
+// progressReporter prints the progress of a run to the standard error,
+// either as a bar redrawn in place or as a line every --progress-interval.
+type progressReporter struct {
+	w       io.Writer
+	bar     bool
+	label   string
+	last    time.Time
+	printed bool
+}
+
+// startProgress returns a tracker of a run hashing total images, which
+// reports its progress per --progress, and a function to call once the run
+// is over. Runs of a single image report nothing.
+func startProgress(label string, total int) (*batch.Tracker, func()) {
+	mode := progressMode
+	if mode == "auto" {
+		mode = "lines"
+		if isTerminal(os.Stderr) && !logger.Enabled(context.Background(), slog.LevelDebug) {
+			// A bar would be torn by debug notes.
+			mode = "bar"
+		}
+	}
+	if mode == "none" || total < 2 {
+		return batch.NewTracker(total, nil), func() {}
+	}
+	r := &progressReporter{w: os.Stderr, bar: mode == "bar", label: label, last: time.Now()}
+	tracker := batch.NewTracker(total, r.update)
+	return tracker, func() { r.finish(tracker.Progress()) }
+}
+
+// checkProgressMode validates --progress.
+func checkProgressMode() error {
+	for _, m := range progressModes {
+		if progressMode == m {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid --progress %q: use %s", progressMode, strings.Join(progressModes, ", "))
+}
+
+// isTerminal reports whether f is a terminal.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+func (r *progressReporter) update(p batch.Progress) {
+	now := time.Now()
+	if r.bar {
+		if now.Sub(r.last) < barRefresh && p.Done < p.Total {
+			return
+		}
+		r.last = now
+		r.printed = true
+		fmt.Fprintf(r.w, "\r%s\x1b[K", formatBar(p))
+		return
+	}
+	if now.Sub(r.last) < progressInterval || p.Done == p.Total {
+		return
+	}
+	r.last = now
+	r.printed = true
+	fmt.Fprintf(r.w, "%s %s\n", r.label, formatProgress(p))
+}
+
+func (r *progressReporter) finish(p batch.Progress) {
+	if !r.printed {
+		return
+	}
+	if r.bar {
+		// Leave the line to the results.
+		fmt.Fprint(r.w, "\r\x1b[K")
+		return
+	}
+	fmt.Fprintf(r.w, "%s %d/%d images, %d failed, in %s\n", r.label, p.Done, p.Total, p.Failed, p.Elapsed.Round(time.Second))
+}
+
+// formatProgress returns the progress as "450/1000 images (45%), 3 failed,
+// 12.3/s, ETA 44s".
+func formatProgress(p batch.Progress) string {
+	return fmt.Sprintf("%d/%d images (%d%%), %d failed, %.1f/s, ETA %s",
+		p.Done, p.Total, percent(p), p.Failed, p.Rate(), formatETA(p))
+}
+
+// formatBar returns the progress as a bar followed by the counts, the rate
+// and the estimated remaining time.
+func formatBar(p batch.Progress) string {
+	filled := 0
+	if p.Total > 0 {
+		filled = barWidth * p.Done / p.Total
+	}
+	bar := strings.Repeat("=", filled)
+	if filled < barWidth {
+		bar += ">" + strings.Repeat(" ", barWidth-filled-1)
+	}
+	failed := ""
+	if p.Failed > 0 {
+		failed = fmt.Sprintf(" %d failed", p.Failed)
+	}
+	return fmt.Sprintf("[%s] %3d%% %d/%d%s %.1f/s ETA %s", bar, percent(p), p.Done, p.Total, failed, p.Rate(), formatETA(p))
+}
+
+func percent(p batch.Progress) int {
+	if p.Total == 0 {
+		return 100
+	}
+	return 100 * p.Done / p.Total
+}
+
+// formatETA returns the estimated remaining time rounded to the second, or
+// "?" before the first image is done.
+func formatETA(p batch.Progress) string {
+	if p.Done == 0 {
+		return "?"
+	}
+	return p.Remaining().Round(time.Second).String()
+}
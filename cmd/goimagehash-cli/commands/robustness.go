@@ -0,0 +1,168 @@
+package commands
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"image"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/lollipopkit/goimagehash"
+	"github.com/lollipopkit/goimagehash/distort"
+	"github.com/spf13/cobra"
+)
+
+var (
+	robustnessAlgorithms  []string
+	robustnessDistortions []string
+	robustnessFormat      string
+)
+
+// robustnessCmd represents the robustness command
+var robustnessCmd = &cobra.Command{
+	Use:   "robustness [image_or_directory...]",
+	Short: "Measure how hash distances react to common image edits",
+	Long: `Apply synthetic distortions (JPEG re-compression, scaling, cropping, rotation,
+brightness, contrast, gamma, blur, noise, watermark and flips) to each image
+and report, for every algorithm, the distribution of distances between the
+original and the distorted hashes.
+
+The SIMILAR column is the fraction of distorted copies that stay within the
+algorithm's recommended threshold.
+
+Examples:
+  goimagehash-cli robustness ./_examples
+  goimagehash-cli robustness -a phash,phash:16x16 -d jpeg-q30,blur-3 photo.jpg
+  goimagehash-cli robustness -f json ./images > robustness.json`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: runRobustness,
+}
+
+func init() {
+	var algorithms, distortions []string
+	for _, a := range goimagehash.Algorithms() {
+		algorithms = append(algorithms, a.String())
+	}
+	for _, d := range distort.Defaults() {
+		distortions = append(distortions, d.Name)
+	}
+	robustnessCmd.Flags().StringSliceVarP(&robustnessAlgorithms, "algorithms", "a", algorithms, "Algorithms to evaluate, optionally with a size (e.g. phash:16x16)")
+	robustnessCmd.Flags().StringSliceVarP(&robustnessDistortions, "distortions", "d", distortions, "Distortions to apply")
+	robustnessCmd.Flags().StringVarP(&robustnessFormat, "format", "f", "", "Output format (table, csv, json, jsonl) [default: from --output-format]")
+}
+
+func runRobustness(cmd *cobra.Command, args []string) error {
+	var algorithms []goimagehash.Algorithm
+	for _, name := range robustnessAlgorithms {
+		a, err := goimagehash.ParseAlgorithm(name)
+		if err != nil {
+			return err
+		}
+		algorithms = append(algorithms, a)
+	}
+	var distortions []distort.Distortion
+	for _, name := range robustnessDistortions {
+		d, err := distort.Lookup(name)
+		if err != nil {
+			return err
+		}
+		distortions = append(distortions, d)
+	}
+	format, err := tableFormat(robustnessFormat)
+	if err != nil {
+		return err
+	}
+
+	paths, err := collectImages(args)
+	if err != nil {
+		return err
+	}
+	var images []image.Image
+	for _, path := range paths {
+		img, err := loadImage(path)
+		if err != nil {
+			reportError(path, err)
+			continue
+		}
+		images = append(images, img)
+	}
+	if len(images) == 0 {
+		return fmt.Errorf("no images found")
+	}
+
+	verbosef("Evaluating %d images with %d algorithms and %d distortions\n", len(images), len(algorithms), len(distortions))
+
+	stats, err := distort.Evaluate(images, algorithms, distortions)
+	if err != nil {
+		return err
+	}
+
+	switch format {
+	case "jsonl":
+		enc := json.NewEncoder(os.Stdout)
+		for _, r := range stats {
+			if err := enc.Encode(r); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(stats)
+	case "csv":
+		w := csv.NewWriter(os.Stdout)
+		w.Write([]string{"Distortion", "Algorithm", "Bits", "Count", "Min", "Max", "Mean", "Median", "P90", "Similar"})
+		for _, s := range stats {
+			w.Write([]string{s.Distortion, s.Algorithm, strconv.Itoa(s.Bits), strconv.Itoa(s.Count),
+				strconv.Itoa(s.Min), strconv.Itoa(s.Max), formatRate(s.Mean), formatRate(s.Median),
+				formatRate(s.P90), formatRate(s.Similar)})
+		}
+		w.Flush()
+		return w.Error()
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "DISTORTION\tALGORITHM\tBITS\tMIN\tMEDIAN\tMEAN\tP90\tMAX\tSIMILAR")
+	for _, s := range stats {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%.1f\t%.2f\t%.1f\t%d\t%.0f%%\n",
+			s.Distortion, s.Algorithm, s.Bits, s.Min, s.Median, s.Mean, s.P90, s.Max, s.Similar*100)
+	}
+	return w.Flush()
+}
+
+// collectImages expands directories in args to the image files they contain,
+// sorted by path, and keeps file arguments as they are.
+func collectImages(args []string) ([]string, error) {
+	var paths []string
+	for _, arg := range args {
+		info, err := os.Stat(arg)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			paths = append(paths, arg)
+			continue
+		}
+		var found []string
+		err = filepath.Walk(arg, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !info.IsDir() && hasExtension(path, defaultExtensions) {
+				found = append(found, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(found)
+		paths = append(paths, found...)
+	}
+	return paths, nil
+}
@@ -1,13 +1,27 @@
 package commands
 
 import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/lollipopkit/goimagehash"
 	"github.com/spf13/cobra"
 )
 
+// defaultThreshold is the --threshold default for 64 bits hashes. It is
+// scaled to the size of larger hashes unless --threshold is set.
+const defaultThreshold = 10
+
 var (
-	hashType  string
-	threshold int
-	verbose   bool
+	hashType      string
+	hashSize      int
+	hashWidth     int
+	hashHeight    int
+	threshold     int
+	minSimilarity float64
+	verbose       bool
+	outputFormat  string
 )
 
 // RootCmd represents the base command when called without any subcommands
@@ -17,18 +31,118 @@ var RootCmd = &cobra.Command{
 	Long: `goimagehash-cli is a command-line interface for computing and comparing 
 image hashes using various perceptual hashing algorithms including 
 Average Hash, Difference Hash, Perception Hash, and more.`,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := applyConfig(cmd)
+		if err != nil {
+			// Not a usage error: the arguments are fine.
+			cmd.SilenceUsage = true
+			return err
+		}
+		if err := setupLogging(); err != nil {
+			return err
+		}
+		warnUnknownSettings(cmd.Root(), cfg)
+		if err := checkProgressMode(); err != nil {
+			return err
+		}
+		if err := checkErrorFlags(); err != nil {
+			return err
+		}
+		// Reject invalid algorithms and sizes before reading any image.
+		if _, err := selectedAlgorithm(); err != nil {
+			return err
+		}
+		// The arguments and flags are valid: later errors are not usage
+		// errors and do not print the usage.
+		cmd.SilenceUsage = true
+		return nil
+	},
+	// Execute prints errors, once.
+	SilenceErrors: true,
 }
 
 func init() {
-	RootCmd.PersistentFlags().StringVarP(&hashType, "hash-type", "t", "average", "Hash algorithm (average, difference, perception, wavelet, double-gradient)")
-	RootCmd.PersistentFlags().IntVarP(&threshold, "threshold", "x", 10, "Similarity threshold for comparisons")
-	RootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "Verbose output")
+	RootCmd.PersistentFlags().StringVarP(&hashType, "hash-type", "t", "average", "Hash algorithm (average, difference, perception, double-gradient), optionally with a size (e.g. perception:16x16)")
+	RootCmd.PersistentFlags().IntVar(&hashSize, "hash-size", 0, "Width and height of the hash, e.g. 16 for 256 bits hashes [default: 8]")
+	RootCmd.PersistentFlags().IntVar(&hashWidth, "width", 0, "Hash width; overrides --hash-size")
+	RootCmd.PersistentFlags().IntVar(&hashHeight, "height", 0, "Hash height; overrides --hash-size")
+	RootCmd.PersistentFlags().IntVarP(&threshold, "threshold", "x", defaultThreshold, "Similarity threshold for comparisons of 64 bits hashes, scaled to larger hashes unless set")
+	RootCmd.PersistentFlags().Float64VarP(&minSimilarity, "similarity", "s", 0, "Minimum normalized similarity (0..1); overrides --threshold when set")
+	RootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "Verbose output; same as --log-level debug")
+	RootCmd.PersistentFlags().StringVar(&logLevel, "log-level", "", "Level of the log written to the standard error (debug, info, warn, error) [default: warn]")
+	RootCmd.PersistentFlags().StringVar(&logFormat, "log-format", "text", "Format of the log (text, json)")
+	RootCmd.PersistentFlags().StringVar(&progressMode, "progress", "auto", "Progress of long runs on the standard error (auto, bar, lines, none); auto draws a bar on terminals and prints lines otherwise")
+	RootCmd.PersistentFlags().DurationVar(&progressInterval, "progress-interval", 10*time.Second, "Time between two progress lines")
+	RootCmd.PersistentFlags().StringVar(&outputFormat, "output-format", "text", "Output format of results (text, json, jsonl, csv)")
+	RootCmd.PersistentFlags().StringVar(&configFile, "config", "", "Configuration file [default: $GOIMAGEHASH_CONFIG, ./.goimagehash.json, ./.goimagehash.conf, or goimagehash/config.json or goimagehash/config in the user config directory]")
 
 	RootCmd.AddCommand(hashCmd)
 	RootCmd.AddCommand(compareCmd)
 	RootCmd.AddCommand(batchCmd)
+	RootCmd.AddCommand(calibrateCmd)
+	RootCmd.AddCommand(robustnessCmd)
+	RootCmd.AddCommand(serveCmd)
+	RootCmd.AddCommand(cacheCmd)
+	RootCmd.AddCommand(watchCmd)
+	RootCmd.AddCommand(indexCmd)
+	RootCmd.AddCommand(searchCmd)
+	RootCmd.AddCommand(matchCmd)
+	RootCmd.AddCommand(configCmd)
 }
 
 func init() {
 	cobra.EnablePrefixMatching = true
-}
\ No newline at end of file
+}
+
+// selectedAlgorithm returns the algorithm of --hash-type with the size of
+// --width and --height, else --hash-size, else the size in --hash-type.
+func selectedAlgorithm() (goimagehash.Algorithm, error) {
+	a, err := goimagehash.ParseAlgorithm(hashType)
+	if err != nil {
+		return a, err
+	}
+	if hashSize < 0 || hashWidth < 0 || hashHeight < 0 {
+		return a, fmt.Errorf("hash size can not be negative")
+	}
+	if hashSize > 0 {
+		a.Width, a.Height = hashSize, hashSize
+	}
+	if hashWidth > 0 {
+		a.Width = hashWidth
+	}
+	if hashHeight > 0 {
+		a.Height = hashHeight
+	}
+	if err := a.Validate(); err != nil {
+		return a, fmt.Errorf("invalid %s hash: %w", a, err)
+	}
+	return a, nil
+}
+
+// isSimilar reports whether two hashes of the given bit size at the given
+// distance are similar, using --similarity when set and --threshold otherwise.
+func isSimilar(distance, bits int) bool {
+	return distance <= maxDistance(bits)
+}
+
+// maxDistance returns the largest distance between similar hashes of the
+// given bit size.
+func maxDistance(bits int) int {
+	if minSimilarity > 0 {
+		// Allow for rounding errors, e.g. (1-0.9)*10 is 0.99999...
+		return int(math.Floor((1-minSimilarity)*float64(bits) + 1e-9))
+	}
+	if RootCmd.PersistentFlags().Changed("threshold") || bits <= 0 {
+		return threshold
+	}
+	return int(math.Round(float64(threshold) * float64(bits) / 64))
+}
+
+// describeThreshold returns the similarity criterion of hashes of the given
+// bit size for human output.
+func describeThreshold(bits int) string {
+	if minSimilarity > 0 {
+		return fmt.Sprintf("similarity: %g", minSimilarity)
+	}
+	return fmt.Sprintf("threshold: %d", maxDistance(bits))
+}
@@ -0,0 +1,288 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/lollipopkit/goimagehash"
+	"github.com/lollipopkit/goimagehash/index"
+	"github.com/spf13/cobra"
+)
+
+var (
+	searchIndex       string
+	searchK           int
+	searchMaxDistance int
+	queryFormat       string
+)
+
+// searchCmd represents the search command
+var searchCmd = &cobra.Command{
+	Use:   "search [image|hash...]",
+	Short: "Find the indexed images most similar to an image or a hash",
+	Long: `Find the images of an index built by "index build" or "watch", or of a hash
+database, that are the closest to each query, ranked by distance.
+
+A query is an image file, "-" for the standard input, an archive entry, a
+hash printed by the hash command, or a hash database (a CSV, JSON or JSON
+Lines file written by batch -o or --output-format) whose every hash is
+searched. Canonical hashes such as p:af97d2205c6b1f82 carry their
+algorithm. Hashes in another encoding are only read as hex digits prefixed
+by 0x, or in the --query-format encoding (binary, hex, base64, base64url,
+imghash-base64, decimal), with the algorithm of the index, or the -t algorithm when it is
+set. Images are hashed with the algorithm of the index.
+
+At most -k matches are listed. --max-distance limits their distance; when it
+is not set, --threshold and --similarity apply if given, otherwise any
+distance is accepted.
+
+Examples:
+  goimagehash-cli search --index photos.jsonl photo.jpg
+  goimagehash-cli search --index photos.jsonl -k 5 --max-distance 8 p:af97d2205c6b1f82
+  goimagehash-cli hash -f hex photo.jpg | xargs goimagehash-cli search --index photos.jsonl --query-format hex`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: runSearch,
+}
+
+func init() {
+	searchCmd.Flags().StringVar(&searchIndex, "index", "", "Index file built by index build, or hash database (required)")
+	searchCmd.MarkFlagRequired("index")
+	searchCmd.Flags().IntVarP(&searchK, "k", "k", 10, "Number of matches to list per query")
+	searchCmd.Flags().IntVar(&searchMaxDistance, "max-distance", -1, "Largest distance of a match [default: --threshold or --similarity when set, else no limit]")
+	searchCmd.Flags().StringVar(&queryFormat, "query-format", "", "Encoding of hash queries ("+strings.Join(hashEncodings, ", ")+") [default: canonical, or hex prefixed by 0x]")
+	addErrorFlags(searchCmd.Flags())
+}
+
+// searchRecord is a match of a query, or the error that prevented the
+// query.
+type searchRecord struct {
+	Query      string  `json:"query"`
+	Algorithm  string  `json:"algorithm"`
+	Rank       int     `json:"rank"`
+	Path       string  `json:"path"`
+	Hash       string  `json:"hash"`
+	Distance   int     `json:"distance"`
+	Similarity float64 `json:"similarity"`
+	Error      string  `json:"error"`
+}
+
+func (r searchRecord) csvHeader() []string {
+	return []string{"Query", "Rank", "File", "Hash", "Distance", "Similarity", "Algorithm", "Error"}
+}
+
+func (r searchRecord) csvRow() []string {
+	rank, distance, similarity := "", "", ""
+	if r.Rank > 0 {
+		rank, distance, similarity = fmt.Sprint(r.Rank), fmt.Sprint(r.Distance), formatRate(r.Similarity)
+	}
+	return []string{r.Query, rank, r.Path, r.Hash, distance, similarity, r.Algorithm, r.Error}
+}
+
+func runSearch(cmd *cobra.Command, args []string) error {
+	if err := checkOutputFormat(); err != nil {
+		return err
+	}
+	if searchK <= 0 {
+		return fmt.Errorf("-k must be positive")
+	}
+	if queryFormat != "" {
+		if _, err := encodeHash(goimagehash.NewExtImageHash([]uint64{0}, goimagehash.PHash, 1), queryFormat); err != nil {
+			return fmt.Errorf("unsupported query format: %s (use %s)", queryFormat, strings.Join(hashEncodings, ", "))
+		}
+	}
+	x, err := loadIndex(searchIndex)
+	if err != nil {
+		return err
+	}
+	algorithms, err := searchAlgorithms(x)
+	if err != nil {
+		return err
+	}
+	verbosef("Searching %d hashes of %s\n", x.Len(), searchIndex)
+
+	var queries []hashResult
+	for _, query := range args {
+		if !isHashDatabase(query) {
+			queries = append(queries, hashResult{ID: query})
+			continue
+		}
+		results, err := loadHashDatabase(query)
+		if err != nil {
+			return err
+		}
+		queries = append(queries, results...)
+	}
+
+	var records []record
+	for qi, q := range queries {
+		query := q.ID
+		var matches []searchMatch
+		err := q.Err
+		if err == nil && q.Hash != nil {
+			// A hash read from a database.
+			name := q.Hash.GetKind().String()
+			if a, aerr := algorithmOf(q.Hash); aerr == nil {
+				name = a.String()
+			}
+			matches = nearest(x, []*goimagehash.ExtImageHash{q.Hash}, []string{name})
+		} else if err == nil {
+			matches, err = searchQuery(x, query, algorithms)
+		}
+		if err != nil {
+			if failOnError {
+				return &exitError{code: ExitError, err: fmt.Errorf("%s: %w", query, err)}
+			}
+			queries[qi].Err = err
+			records = append(records, searchRecord{Query: query, Error: err.Error()})
+			continue
+		}
+		for i, m := range matches {
+			records = append(records, searchRecord{
+				Query:      query,
+				Algorithm:  m.algorithm,
+				Rank:       i + 1,
+				Path:       m.ID,
+				Hash:       m.Hash.String(),
+				Distance:   m.Distance,
+				Similarity: 1 - float64(m.Distance)/float64(m.Hash.Bits()),
+			})
+		}
+		if !structuredOutput() {
+			printMatches(query, matches)
+		}
+	}
+
+	if structuredOutput() {
+		if err := writeRecords("", outputFormat, records); err != nil {
+			return err
+		}
+	}
+	return reportFailures(queries)
+}
+
+// searchMatch is a match along with the algorithm of its hash.
+type searchMatch struct {
+	index.Match
+	algorithm string
+}
+
+// searchAlgorithms returns the algorithms of the hashes of the index, or
+// the -t algorithm when it is set.
+func searchAlgorithms(x *index.Index) ([]goimagehash.Algorithm, error) {
+	flags := RootCmd.PersistentFlags()
+	if flags.Changed("hash-type") || flags.Changed("hash-size") || flags.Changed("width") || flags.Changed("height") {
+		a, err := selectedAlgorithm()
+		return []goimagehash.Algorithm{a}, err
+	}
+	seen := make(map[goimagehash.Algorithm]bool)
+	var algorithms []goimagehash.Algorithm
+	for _, e := range x.Entries() {
+		a, err := algorithmOf(e.Hash)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", e.ID, err)
+		}
+		if !seen[a] {
+			seen[a] = true
+			algorithms = append(algorithms, a)
+		}
+	}
+	if len(algorithms) == 0 {
+		a, err := selectedAlgorithm()
+		return []goimagehash.Algorithm{a}, err
+	}
+	sort.Slice(algorithms, func(i, j int) bool { return algorithms[i].String() < algorithms[j].String() })
+	return algorithms, nil
+}
+
+// searchQuery returns the matches of a query: an image, or a hash.
+func searchQuery(x *index.Index, query string, algorithms []goimagehash.Algorithm) ([]searchMatch, error) {
+	var hashes []*goimagehash.ExtImageHash
+	var names []string
+	if _, err := os.Stat(query); err != nil && query != "-" && !isArchiveID(query) {
+		// Not a file: a hash of one of the algorithms.
+		var errs []error
+		for _, a := range algorithms {
+			h, err := decodeHash(query, a, queryFormat)
+			if err == nil {
+				hashes, names = append(hashes, h), append(names, a.String())
+				break
+			}
+			errs = append(errs, err)
+		}
+		if len(hashes) == 0 {
+			return nil, fmt.Errorf("not an image file nor a hash: %v", errs[0])
+		}
+	} else {
+		img, err := loadImage(query)
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range algorithms {
+			h, err := a.Hash(img)
+			if err != nil {
+				return nil, fmt.Errorf("failed to compute hash: %w", err)
+			}
+			hashes, names = append(hashes, h), append(names, a.String())
+		}
+	}
+
+	return nearest(x, hashes, names), nil
+}
+
+// nearest returns the -k nearest matches of hashes, computed with the
+// algorithms of names.
+func nearest(x *index.Index, hashes []*goimagehash.ExtImageHash, names []string) []searchMatch {
+	var matches []searchMatch
+	for i, h := range hashes {
+		for _, m := range x.Nearest(h, searchK, searchDistance(h.Bits())) {
+			matches = append(matches, searchMatch{m, names[i]})
+		}
+	}
+	// Rank the matches of several algorithms by similarity, as their
+	// distances have different scales.
+	sort.SliceStable(matches, func(i, j int) bool {
+		si := float64(matches[i].Distance) / float64(matches[i].Hash.Bits())
+		sj := float64(matches[j].Distance) / float64(matches[j].Hash.Bits())
+		return si < sj
+	})
+	if len(matches) > searchK {
+		matches = matches[:searchK]
+	}
+	return matches
+}
+
+// isArchiveID reports whether id names an archive entry.
+func isArchiveID(id string) bool {
+	_, _, ok := splitArchiveID(id)
+	return ok
+}
+
+// searchDistance returns the largest distance of a match between hashes of
+// the given bit size, or -1 for no limit.
+func searchDistance(bits int) int {
+	if searchMaxDistance >= 0 {
+		return searchMaxDistance
+	}
+	flags := RootCmd.PersistentFlags()
+	if flags.Changed("threshold") || flags.Changed("similarity") {
+		return maxDistance(bits)
+	}
+	return -1
+}
+
+func printMatches(query string, matches []searchMatch) {
+	if len(matches) == 0 {
+		fmt.Printf("%s: no match\n", query)
+		return
+	}
+	fmt.Printf("%s:\n", query)
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "  RANK\tDISTANCE\tSIMILARITY\tFILE")
+	for i, m := range matches {
+		fmt.Fprintf(w, "  %d\t%d\t%.4f\t%s\n", i+1, m.Distance, 1-float64(m.Distance)/float64(m.Hash.Bits()), m.ID)
+	}
+	w.Flush()
+}
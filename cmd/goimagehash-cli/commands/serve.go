@@ -0,0 +1,103 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/lollipopkit/goimagehash/server"
+	"github.com/spf13/cobra"
+)
+
+var (
+	listenAddr    string
+	maxBodyBytes  int64
+	maxPixels     int64
+	maxConcurrent int
+	serveIndex    string
+)
+
+// serveCmd represents the serve command
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serve hashing, comparison and similarity search over HTTP",
+	Long: `Run an HTTP server hashing uploaded images, comparing them and searching an
+index of hashes. Images are sent as the request body or as multipart form
+files, and every response is JSON.
+
+Endpoints:
+  POST   /hash      hash an image (?algorithm=phash,dhash:16x16)
+  POST   /compare   compare the image1 and image2 files, or hash1 and hash2
+  GET    /index     number of indexed hashes
+  POST   /index     index an image, or a hash, under ?id=
+  DELETE /index     remove the hash indexed under ?id=
+  GET    /search    nearest indexed hashes of ?hash= (?k=10&max_distance=)
+  POST   /search    nearest indexed hashes of an image
+  GET    /healthz   health check
+  GET    /metrics   Prometheus metrics
+
+The algorithm of requests that do not name one is the -t algorithm. With
+--index, the index is loaded at startup and saved after every change.
+
+Examples:
+  goimagehash-cli serve
+  goimagehash-cli serve -t phash --addr :9000 --index hashes.jsonl
+  curl --data-binary @image.jpg 'localhost:8080/hash?algorithm=phash,dhash'
+  curl --data-binary @image.jpg 'localhost:8080/search?k=5'`,
+	Args: cobra.NoArgs,
+	RunE: runServe,
+}
+
+func init() {
+	serveCmd.Flags().StringVar(&listenAddr, "addr", ":8080", "Address to listen on")
+	serveCmd.Flags().Int64Var(&maxBodyBytes, "max-body", server.DefaultMaxBodyBytes, "Largest accepted request body in bytes")
+	serveCmd.Flags().Int64Var(&maxPixels, "max-pixels", server.DefaultMaxPixels, "Largest accepted image width times height, checked before decoding")
+	serveCmd.Flags().IntVar(&maxConcurrent, "max-concurrent", 0, "Requests hashing images at once; others get 503 [default: number of CPUs]")
+	serveCmd.Flags().StringVar(&serveIndex, "index", "", "Index file loaded at startup and saved after every change [default: in memory]")
+}
+
+func runServe(cmd *cobra.Command, args []string) error {
+	algorithm, err := selectedAlgorithm()
+	if err != nil {
+		return err
+	}
+	handler, err := server.New(server.Options{
+		Algorithm:     algorithm,
+		MaxBodyBytes:  maxBodyBytes,
+		MaxPixels:     maxPixels,
+		MaxConcurrent: maxConcurrent,
+		IndexPath:     serveIndex,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to start server: %w", err)
+	}
+
+	srv := &http.Server{
+		Addr:              listenAddr,
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdown)
+	}()
+
+	verbosef("Default algorithm: %s\n", algorithm)
+	if serveIndex != "" {
+		verbosef("Index: %s (%d hashes)\n", serveIndex, handler.Len())
+	}
+	infof("Listening on %s\n", listenAddr)
+	if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
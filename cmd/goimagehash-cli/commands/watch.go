@@ -0,0 +1,316 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/lollipopkit/goimagehash"
+	"github.com/lollipopkit/goimagehash/cache"
+	"github.com/lollipopkit/goimagehash/index"
+	"github.com/lollipopkit/goimagehash/watch"
+	"github.com/spf13/cobra"
+)
+
+var (
+	watchIndex    string
+	watchInterval time.Duration
+	watchDebounce time.Duration
+	watchOnce     bool
+)
+
+// watchCmd represents the watch command
+var watchCmd = &cobra.Command{
+	Use:   "watch [directory]",
+	Short: "Keep an index of a directory up to date and report near-duplicates",
+	Long: `Scan a directory, then poll it for created, modified, renamed and deleted
+images, keeping an index of their hashes up to date. When an image is added
+or modified, every indexed image within the threshold is reported as a
+near-duplicate.
+
+Polling works on every platform and file system. A created or modified file
+is only hashed once its size and modification time stayed the same for
+--debounce, so that files being copied are not read half written.
+
+With --index, the index is loaded at startup and saved after every change.
+The initial scan then reports the images added, modified or deleted since
+the index was saved; without an index file it only builds the index.
+With --cache, hashes come from the hash cache, so restarting on a large
+directory only decodes new and changed images.
+
+Examples:
+  goimagehash-cli watch ./inbox
+  goimagehash-cli watch -r --index photos.jsonl --interval 10s ./photos
+  goimagehash-cli watch -t phash -x 6 --output-format jsonl ./uploads`,
+	Args: cobra.ExactArgs(1),
+	RunE: runWatch,
+}
+
+func init() {
+	watchCmd.Flags().StringVar(&watchIndex, "index", "", "Index file loaded at startup and saved after every change [default: in memory]")
+	watchCmd.Flags().DurationVar(&watchInterval, "interval", 2*time.Second, "Time between two polls of the directory")
+	watchCmd.Flags().DurationVar(&watchDebounce, "debounce", time.Second, "Time a changed file must stay unchanged before it is hashed")
+	watchCmd.Flags().BoolVar(&watchOnce, "once", false, "Exit after the initial scan")
+	watchCmd.Flags().BoolVarP(&recursive, "recursive", "r", false, "Watch directories recursively")
+	watchCmd.Flags().StringSliceVarP(&extensions, "extensions", "e", defaultExtensions, "File extensions to watch")
+	addCacheFlags(watchCmd.Flags(), true)
+}
+
+// watchRecord is an event of the watch command.
+type watchRecord struct {
+	Time     string `json:"time"`
+	Event    string `json:"event"`
+	Path     string `json:"path"`
+	OldPath  string `json:"old_path"`
+	Hash     string `json:"hash"`
+	Match    string `json:"match"`
+	Distance int    `json:"distance"`
+	Error    string `json:"error"`
+}
+
+func (r watchRecord) csvHeader() []string {
+	return []string{"Time", "Event", "File", "OldFile", "Hash", "Match", "Distance", "Error"}
+}
+
+func (r watchRecord) csvRow() []string {
+	distance := ""
+	if r.Event == "duplicate" {
+		distance = strconv.Itoa(r.Distance)
+	}
+	return []string{r.Time, r.Event, r.Path, r.OldPath, r.Hash, r.Match, distance, r.Error}
+}
+
+// watcher applies the events of a watch.Watcher to an index.
+type watcher struct {
+	dir   string
+	index *index.Index
+	cache *cache.Cache
+	out   *recordWriter
+}
+
+func runWatch(cmd *cobra.Command, args []string) error {
+	if err := checkOutputFormat(); err != nil {
+		return err
+	}
+	if watchInterval <= 0 {
+		return fmt.Errorf("--interval must be positive")
+	}
+	dir := args[0]
+	if info, err := os.Stat(dir); err != nil {
+		return err
+	} else if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+
+	x := index.New()
+	loaded := false
+	if watchIndex != "" {
+		var err error
+		x, err = index.Load(watchIndex)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+			x = index.New()
+		case err != nil:
+			return fmt.Errorf("failed to load index: %w", err)
+		default:
+			loaded = true
+			verbosef("Loaded %d hashes from %s\n", x.Len(), watchIndex)
+		}
+	}
+	hashCache, err := openCache()
+	if err != nil {
+		return err
+	}
+	defer saveCache(hashCache)
+
+	format := outputFormat
+	if format == "json" {
+		// The stream never ends, so it can not be one JSON array.
+		format = "jsonl"
+	}
+	wr := &watcher{dir: dir, index: x, cache: hashCache, out: newRecordWriter(os.Stdout, format)}
+	w := watch.New(dir, watch.Options{
+		Recursive: recursive,
+		Match:     func(path string) bool { return hasExtension(path, extensions) },
+		Debounce:  watchDebounce,
+	})
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	events, err := w.Poll(time.Now())
+	if err != nil {
+		return err
+	}
+	if err := wr.scan(events, w.Files(), loaded); err != nil {
+		return err
+	}
+	if watchOnce {
+		return nil
+	}
+
+	verbosef("Polling %s every %s\n", dir, watchInterval)
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			verbosef("Stopped watching %s\n", dir)
+			return nil
+		case now := <-ticker.C:
+			events, err := w.Poll(now)
+			if err != nil {
+				// The directory may be briefly unavailable, e.g. on a
+				// network share; keep the index and try again.
+				reportError(dir, err)
+				continue
+			}
+			if len(events) == 0 {
+				continue
+			}
+			if err := wr.apply(events, true); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// scan applies the initial scan to the index: images that are not
+// indexed yet are added and indexed images of the directory that no longer
+// exist are removed. Events are only reported for an index loaded from a
+// file, whose changes they are.
+func (wr *watcher) scan(events []watch.Event, files map[string]watch.File, report bool) error {
+	var changes []watch.Event
+	for _, entry := range wr.index.Entries() {
+		if _, ok := files[entry.ID]; !ok && wr.contains(entry.ID) {
+			changes = append(changes, watch.Event{Op: watch.Delete, Path: entry.ID})
+		}
+	}
+	for _, e := range events {
+		if old, ok := wr.index.Get(e.Path); ok {
+			if hash, err := wr.hash(e.Path); err == nil && hash.String() == old.String() {
+				continue
+			}
+			e.Op = watch.Modify
+		}
+		changes = append(changes, e)
+	}
+	if err := wr.apply(changes, report); err != nil {
+		return err
+	}
+	infof("Indexed %d images of %s\n", len(files), wr.dir)
+	return nil
+}
+
+// contains reports whether path is one of the watched files, i.e. inside
+// the watched directory, or directly inside without --recursive.
+func (wr *watcher) contains(path string) bool {
+	rel, err := filepath.Rel(wr.dir, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return false
+	}
+	return recursive || !strings.ContainsRune(rel, filepath.Separator)
+}
+
+// hash returns the hash of the image at path, from the cache when possible.
+func (wr *watcher) hash(path string) (*goimagehash.ExtImageHash, error) {
+	r := hashFiles([]string{path}, wr.cache)[0]
+	return r.Hash, r.Err
+}
+
+// apply updates the index with events, reports them when report is set,
+// and saves the index when it changed.
+func (wr *watcher) apply(events []watch.Event, report bool) error {
+	changed := false
+	for _, e := range events {
+		rec := watchRecord{Time: time.Now().Format(time.RFC3339), Event: e.Op.String(), Path: e.Path, OldPath: e.OldPath}
+		var duplicates []index.Match
+		switch e.Op {
+		case watch.Delete:
+			changed = wr.index.Remove(e.Path) || changed
+		case watch.Rename:
+			hash, ok := wr.index.Get(e.OldPath)
+			wr.index.Remove(e.OldPath)
+			changed = true
+			if !ok {
+				var err error
+				if hash, err = wr.hash(e.Path); err != nil {
+					rec.Error = err.Error()
+					break
+				}
+			}
+			wr.index.Add(e.Path, hash)
+			rec.Hash = hash.String()
+		default:
+			hash, err := wr.hash(e.Path)
+			if err != nil {
+				// Keep no stale hash of a file that can not be read.
+				changed = wr.index.Remove(e.Path) || changed
+				rec.Error = err.Error()
+				break
+			}
+			rec.Hash = hash.String()
+			for _, m := range wr.index.Within(hash, maxDistance(hash.Bits())) {
+				if m.ID != e.Path {
+					duplicates = append(duplicates, m)
+				}
+			}
+			wr.index.Add(e.Path, hash)
+			changed = true
+		}
+
+		if !report {
+			continue
+		}
+		if err := wr.report(rec); err != nil {
+			return err
+		}
+		for _, m := range duplicates {
+			dup := rec
+			dup.Event, dup.OldPath, dup.Match, dup.Distance = "duplicate", "", m.ID, m.Distance
+			if err := wr.report(dup); err != nil {
+				return err
+			}
+		}
+	}
+	if err := wr.out.Flush(); err != nil {
+		return err
+	}
+
+	if changed && watchIndex != "" {
+		if err := wr.index.Save(watchIndex); err != nil {
+			return fmt.Errorf("failed to save index: %w", err)
+		}
+	}
+	if changed && wr.cache != nil {
+		if err := wr.cache.Save(); err != nil {
+			logger.Warn("Failed to save cache", "path", wr.cache.Path(), "error", err)
+		}
+	}
+	return nil
+}
+
+// report prints an event.
+func (wr *watcher) report(rec watchRecord) error {
+	if structuredOutput() {
+		return wr.out.Write(rec)
+	}
+	switch {
+	case rec.Error != "":
+		reportError(rec.Path, errors.New(rec.Error))
+	case rec.Event == "duplicate":
+		fmt.Printf("%s duplicate %s ~ %s (distance: %d)\n", rec.Time, rec.Path, rec.Match, rec.Distance)
+	case rec.Event == "rename":
+		fmt.Printf("%s rename    %s -> %s\n", rec.Time, rec.OldPath, rec.Path)
+	default:
+		fmt.Printf("%s %-9s %s\n", rec.Time, rec.Event, rec.Path)
+	}
+	return nil
+}
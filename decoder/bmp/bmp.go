@@ -0,0 +1,318 @@
+// Copyright 2017 The goimagehash Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package bmp implements a pure Go decoder of Windows BMP images and
+// registers it with the decoder package on import.
+//
+// Uncompressed images of 1, 4, 8, 16, 24 and 32 bits per pixel are
+// supported, with the BITMAPCOREHEADER, BITMAPINFOHEADER and later headers,
+// bit field masks and top-down rows. Run-length encoded images are not.
+package bmp
+
+import (
+	"encoding/binary"
+	"image"
+	"image/color"
+	"io"
+	"math/bits"
+
+	"github.com/lollipopkit/goimagehash/decoder"
+)
+
+func init() {
+	decoder.Register(decoder.Format{
+		Name:         "bmp",
+		Magic:        []string{"BM????\x00\x00\x00\x00"},
+		Extensions:   []string{"bmp"},
+		Decode:       Decode,
+		DecodeConfig: DecodeConfig,
+	})
+}
+
+// A FormatError reports that the input is not a valid BMP image.
+type FormatError string
+
+func (e FormatError) Error() string { return "bmp: invalid format: " + string(e) }
+
+// An UnsupportedError reports that the input uses a valid but unimplemented
+// BMP feature.
+type UnsupportedError string
+
+func (e UnsupportedError) Error() string { return "bmp: unsupported feature: " + string(e) }
+
+// maxPixels bounds the size of the images, so that a forged header does not
+// allocate gigabytes.
+const maxPixels = 1 << 28
+
+// Compression methods.
+const (
+	compressionRGB            = 0
+	compressionBitFields      = 3
+	compressionAlphaBitFields = 6
+)
+
+const fileHeaderLen = 14
+
+type header struct {
+	width, height int
+	topDown       bool
+	bpp           int
+	compression   uint32
+	// masks are the red, green, blue and alpha masks of 16 and 32 bits
+	// pixels.
+	masks   [4]uint32
+	palette color.Palette
+}
+
+// colorModel returns the color model of the decoded image.
+func (h *header) colorModel() color.Model {
+	switch {
+	case h.bpp <= 8:
+		return h.palette
+	case h.masks[3] != 0:
+		return color.NRGBAModel
+	default:
+		return color.RGBAModel
+	}
+}
+
+// readHeader reads the headers and the palette of a BMP image and skips to
+// its pixels.
+func readHeader(r io.Reader) (*header, error) {
+	var b [fileHeaderLen + 4]byte
+	if _, err := io.ReadFull(r, b[:]); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	if string(b[:2]) != "BM" {
+		return nil, FormatError("not a BMP file")
+	}
+	offset := int64(binary.LittleEndian.Uint32(b[10:]))
+	infoLen := binary.LittleEndian.Uint32(b[14:])
+	if infoLen != 12 && (infoLen < 40 || infoLen > 1024) {
+		return nil, UnsupportedError("header size")
+	}
+	info := make([]byte, infoLen)
+	if _, err := io.ReadFull(r, info[4:]); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	read := int64(fileHeaderLen + infoLen)
+
+	h := &header{}
+	entryLen, colors := 4, 0
+	if infoLen == 12 {
+		// BITMAPCOREHEADER.
+		h.width = int(binary.LittleEndian.Uint16(info[4:]))
+		h.height = int(binary.LittleEndian.Uint16(info[6:]))
+		h.bpp = int(binary.LittleEndian.Uint16(info[10:]))
+		entryLen = 3
+	} else {
+		h.width = int(int32(binary.LittleEndian.Uint32(info[4:])))
+		height := int32(binary.LittleEndian.Uint32(info[8:]))
+		if height < 0 {
+			h.topDown = true
+			height = -height
+		}
+		h.height = int(height)
+		h.bpp = int(binary.LittleEndian.Uint16(info[14:]))
+		h.compression = binary.LittleEndian.Uint32(info[16:])
+		colors = int(binary.LittleEndian.Uint32(info[32:]))
+		for i := 0; i < 4 && 40+4*i+4 <= int(infoLen); i++ {
+			h.masks[i] = binary.LittleEndian.Uint32(info[40+4*i:])
+		}
+		if infoLen == 40 && (h.compression == compressionBitFields || h.compression == compressionAlphaBitFields) {
+			// The masks follow the header.
+			n := 3
+			if h.compression == compressionAlphaBitFields {
+				n = 4
+			}
+			masks := make([]byte, 4*n)
+			if _, err := io.ReadFull(r, masks); err != nil {
+				return nil, unexpectedEOF(err)
+			}
+			read += int64(len(masks))
+			for i := 0; i < n; i++ {
+				h.masks[i] = binary.LittleEndian.Uint32(masks[4*i:])
+			}
+		}
+	}
+	if h.width <= 0 || h.height <= 0 {
+		return nil, FormatError("non-positive dimension")
+	}
+	if h.width > maxPixels/h.height {
+		return nil, UnsupportedError("image too large")
+	}
+	if err := h.checkPixelFormat(); err != nil {
+		return nil, err
+	}
+
+	if h.bpp <= 8 {
+		if colors <= 0 || colors > 1<<h.bpp {
+			colors = 1 << h.bpp
+		}
+		entries := make([]byte, colors*entryLen)
+		if _, err := io.ReadFull(r, entries); err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		read += int64(len(entries))
+		// Pad the palette so that every index has a color.
+		h.palette = make(color.Palette, 1<<h.bpp)
+		for i := range h.palette {
+			h.palette[i] = color.RGBA{A: 0xff}
+			if i < colors {
+				e := entries[i*entryLen:]
+				h.palette[i] = color.RGBA{e[2], e[1], e[0], 0xff}
+			}
+		}
+	}
+
+	if offset > read {
+		if _, err := io.CopyN(io.Discard, r, offset-read); err != nil {
+			return nil, unexpectedEOF(err)
+		}
+	} else if offset != 0 && offset < read {
+		return nil, FormatError("pixel data overlaps the header")
+	}
+	return h, nil
+}
+
+// checkPixelFormat rejects the unsupported combinations of bits per pixel
+// and compression, and sets the default masks.
+func (h *header) checkPixelFormat() error {
+	switch h.compression {
+	case compressionRGB:
+		switch h.bpp {
+		case 1, 4, 8, 24:
+			// Masks of later headers only apply to bit fields.
+			h.masks = [4]uint32{}
+		case 16:
+			h.masks = [4]uint32{0x7c00, 0x03e0, 0x001f, 0}
+		case 32:
+			// The fourth byte is unused.
+			h.masks = [4]uint32{0xff0000, 0xff00, 0xff, 0}
+		default:
+			return UnsupportedError("bits per pixel")
+		}
+	case compressionBitFields, compressionAlphaBitFields:
+		if h.bpp != 16 && h.bpp != 32 {
+			return FormatError("bit fields need 16 or 32 bits per pixel")
+		}
+		if h.compression == compressionBitFields && h.bpp == 16 && h.masks == [4]uint32{} {
+			h.masks = [4]uint32{0x7c00, 0x03e0, 0x001f, 0}
+		}
+	default:
+		return UnsupportedError("compression")
+	}
+	return nil
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// DecodeConfig function returns the color model and dimensions of a BMP
+// image without decoding the entire image.
+func DecodeConfig(r io.Reader) (image.Config, error) {
+	h, err := readHeader(r)
+	if err != nil {
+		return image.Config{}, err
+	}
+	return image.Config{ColorModel: h.colorModel(), Width: h.width, Height: h.height}, nil
+}
+
+// Decode function reads a BMP image from r and returns it as an
+// image.Image: an *image.Paletted up to 8 bits per pixel, an *image.NRGBA
+// with an alpha mask, and an *image.RGBA otherwise.
+func Decode(r io.Reader) (image.Image, error) {
+	h, err := readHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	rect := image.Rect(0, 0, h.width, h.height)
+	var (
+		paletted *image.Paletted
+		pix      []uint8
+		stride   int
+		img      image.Image
+	)
+	switch {
+	case h.bpp <= 8:
+		paletted = image.NewPaletted(rect, h.palette)
+		img = paletted
+	case h.masks[3] != 0:
+		m := image.NewNRGBA(rect)
+		pix, stride, img = m.Pix, m.Stride, m
+	default:
+		m := image.NewRGBA(rect)
+		pix, stride, img = m.Pix, m.Stride, m
+	}
+	channels := [4]channel{newChannel(h.masks[0]), newChannel(h.masks[1]), newChannel(h.masks[2]), newChannel(h.masks[3])}
+
+	// Rows are padded to 4 bytes.
+	row := make([]byte, (h.width*h.bpp+31)/32*4)
+	for i := 0; i < h.height; i++ {
+		if _, err := io.ReadFull(r, row); err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		y := h.height - 1 - i
+		if h.topDown {
+			y = i
+		}
+		if paletted != nil {
+			dst := paletted.Pix[y*paletted.Stride : y*paletted.Stride+h.width]
+			perByte := 8 / h.bpp
+			for x := range dst {
+				shift := 8 - h.bpp*(x%perByte+1)
+				dst[x] = row[x/perByte] >> uint(shift) & (1<<uint(h.bpp) - 1)
+			}
+			continue
+		}
+		for x := 0; x < h.width; x++ {
+			d := pix[y*stride+4*x : y*stride+4*x+4]
+			var p uint32
+			switch h.bpp {
+			case 24:
+				// Blue, green and red bytes.
+				d[0], d[1], d[2], d[3] = row[3*x+2], row[3*x+1], row[3*x], 0xff
+				continue
+			case 16:
+				p = uint32(binary.LittleEndian.Uint16(row[2*x:]))
+			case 32:
+				p = binary.LittleEndian.Uint32(row[4*x:])
+			}
+			d[0] = channels[0].value(p, 0)
+			d[1] = channels[1].value(p, 0)
+			d[2] = channels[2].value(p, 0)
+			d[3] = channels[3].value(p, 0xff)
+		}
+	}
+	return img, nil
+}
+
+// channel extracts a color channel from a pixel with a bit mask.
+type channel struct {
+	mask  uint32
+	shift uint
+	max   uint64
+}
+
+func newChannel(mask uint32) channel {
+	if mask == 0 {
+		return channel{}
+	}
+	shift := uint(bits.TrailingZeros32(mask))
+	return channel{mask: mask, shift: shift, max: uint64(mask >> shift)}
+}
+
+// value returns the channel of p scaled to 8 bits, or missing without a
+// mask.
+func (c channel) value(p uint32, missing uint8) uint8 {
+	if c.mask == 0 {
+		return missing
+	}
+	v := uint64(p&c.mask) >> c.shift
+	return uint8((v*0xff + c.max/2) / c.max)
+}
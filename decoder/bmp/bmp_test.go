@@ -0,0 +1,181 @@
+// Copyright 2017 The goimagehash Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bmp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/jpeg"
+	"os"
+	"reflect"
+	"testing"
+)
+
+// encode returns a BMP file with a header of infoLen bytes, the given
+// compression, palette and masks, and the rows of pixels, bottom-up unless
+// topDown.
+func encode(width, height, bpp int, compression uint32, infoLen int, topDown bool, palette []color.RGBA, masks []uint32, rows [][]byte) []byte {
+	var info bytes.Buffer
+	le := func(v interface{}) { binary.Write(&info, binary.LittleEndian, v) }
+	le(uint32(infoLen))
+	h := int32(height)
+	if topDown {
+		h = -h
+	}
+	le(int32(width))
+	le(h)
+	le(uint16(1))
+	le(uint16(bpp))
+	le(compression)
+	le(uint32(0))
+	le([4]uint32{0, 0, uint32(len(palette)), 0})
+	for _, m := range masks {
+		le(m)
+	}
+	// Masks follow a BITMAPINFOHEADER and are part of later headers.
+	for info.Len() < infoLen {
+		info.WriteByte(0)
+	}
+	for _, c := range palette {
+		info.Write([]byte{c.B, c.G, c.R, 0})
+	}
+
+	var b bytes.Buffer
+	offset := fileHeaderLen + info.Len()
+	b.WriteString("BM")
+	binary.Write(&b, binary.LittleEndian, [3]uint32{0, 0, uint32(offset)})
+	b.Write(info.Bytes())
+	for _, row := range rows {
+		b.Write(row)
+		for n := len(row); n%4 != 0; n++ {
+			b.WriteByte(0)
+		}
+	}
+	return b.Bytes()
+}
+
+func TestDecode(t *testing.T) {
+	red, green, blue := color.RGBA{0xff, 0, 0, 0xff}, color.RGBA{0, 0xff, 0, 0xff}, color.RGBA{0, 0, 0xff, 0xff}
+	for _, tt := range []struct {
+		name string
+		data []byte
+		// want is the top row and the bottom row of a 2x2 image.
+		want [4]color.NRGBA
+	}{
+		{"24 bits", encode(2, 2, 24, 0, 40, false, nil, nil, [][]byte{
+			{0xff, 0, 0, 0, 0xff, 0}, {0, 0, 0xff, 0xff, 0xff, 0xff},
+		}), [4]color.NRGBA{{0xff, 0, 0, 0xff}, {0xff, 0xff, 0xff, 0xff}, {0, 0, 0xff, 0xff}, {0, 0xff, 0, 0xff}}},
+		{"top-down 24 bits", encode(2, 2, 24, 0, 40, true, nil, nil, [][]byte{
+			{0, 0, 0xff, 0xff, 0xff, 0xff}, {0xff, 0, 0, 0, 0xff, 0},
+		}), [4]color.NRGBA{{0xff, 0, 0, 0xff}, {0xff, 0xff, 0xff, 0xff}, {0, 0, 0xff, 0xff}, {0, 0xff, 0, 0xff}}},
+		{"8 bits", encode(2, 2, 8, 0, 40, false, []color.RGBA{red, green, blue}, nil, [][]byte{
+			{2, 1}, {0, 0},
+		}), [4]color.NRGBA{{0xff, 0, 0, 0xff}, {0xff, 0, 0, 0xff}, {0, 0, 0xff, 0xff}, {0, 0xff, 0, 0xff}}},
+		{"1 bit", encode(2, 2, 1, 0, 40, false, []color.RGBA{{}, {0xff, 0xff, 0xff, 0xff}}, nil, [][]byte{
+			{0x40}, {0x80},
+		}), [4]color.NRGBA{{0xff, 0xff, 0xff, 0xff}, {0, 0, 0, 0xff}, {0, 0, 0, 0xff}, {0xff, 0xff, 0xff, 0xff}}},
+		{"4 bits core header", encodeCore(), [4]color.NRGBA{{0, 0, 0xff, 0xff}, {0xff, 0, 0, 0xff}, {0xff, 0, 0, 0xff}, {0, 0, 0xff, 0xff}}},
+		{"16 bits 565", encode(2, 2, 16, 3, 40, false, nil, []uint32{0xf800, 0x07e0, 0x001f}, [][]byte{
+			{0x1f, 0, 0xe0, 0x07}, {0, 0xf8, 0xff, 0xff},
+		}), [4]color.NRGBA{{0xff, 0, 0, 0xff}, {0xff, 0xff, 0xff, 0xff}, {0, 0, 0xff, 0xff}, {0, 0xff, 0, 0xff}}},
+		{"16 bits 555", encode(2, 2, 16, 0, 40, false, nil, nil, [][]byte{
+			{0x1f, 0, 0xe0, 0x03}, {0, 0x7c, 0xff, 0x7f},
+		}), [4]color.NRGBA{{0xff, 0, 0, 0xff}, {0xff, 0xff, 0xff, 0xff}, {0, 0, 0xff, 0xff}, {0, 0xff, 0, 0xff}}},
+		{"32 bits", encode(2, 2, 32, 0, 40, false, nil, nil, [][]byte{
+			{0xff, 0, 0, 0, 0, 0xff, 0, 0}, {0, 0, 0xff, 0, 0xff, 0xff, 0xff, 0},
+		}), [4]color.NRGBA{{0xff, 0, 0, 0xff}, {0xff, 0xff, 0xff, 0xff}, {0, 0, 0xff, 0xff}, {0, 0xff, 0, 0xff}}},
+		{"32 bits V5 alpha", encode(2, 2, 32, 3, 124, false, nil, []uint32{0xff0000, 0xff00, 0xff, 0xff000000}, [][]byte{
+			{0xff, 0, 0, 0x80, 0, 0xff, 0, 0xff}, {0, 0, 0xff, 0xff, 0xff, 0xff, 0xff, 0},
+		}), [4]color.NRGBA{{0xff, 0, 0, 0xff}, {0xff, 0xff, 0xff, 0}, {0, 0, 0xff, 0x80}, {0, 0xff, 0, 0xff}}},
+	} {
+		img, err := Decode(bytes.NewReader(tt.data))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if b := img.Bounds(); b.Dx() != 2 || b.Dy() != 2 {
+			t.Errorf("%s: unexpected bounds %v", tt.name, b)
+			continue
+		}
+		for i, p := range []image.Point{{0, 0}, {1, 0}, {0, 1}, {1, 1}} {
+			if got := color.NRGBAModel.Convert(img.At(p.X, p.Y)).(color.NRGBA); got != tt.want[i] {
+				t.Errorf("%s: pixel %v is %v, expected %v", tt.name, p, got, tt.want[i])
+			}
+		}
+		config, err := DecodeConfig(bytes.NewReader(tt.data))
+		if err != nil || config.Width != 2 || config.Height != 2 || !reflect.DeepEqual(config.ColorModel, img.ColorModel()) {
+			t.Errorf("%s: unexpected config %+v, %v", tt.name, config, err)
+		}
+	}
+}
+
+// encodeCore returns a 2x2 image of 4 bits per pixel with a
+// BITMAPCOREHEADER, blue and red on the top row, red and blue at the
+// bottom.
+func encodeCore() []byte {
+	var b bytes.Buffer
+	b.WriteString("BM")
+	binary.Write(&b, binary.LittleEndian, [3]uint32{0, 0, fileHeaderLen + 12 + 16*3})
+	binary.Write(&b, binary.LittleEndian, uint32(12))
+	binary.Write(&b, binary.LittleEndian, [4]uint16{2, 2, 1, 4})
+	// Blue, red, then black entries of 3 bytes.
+	b.Write([]byte{0xff, 0, 0, 0, 0, 0xff})
+	b.Write(make([]byte, 14*3))
+	b.Write([]byte{0x10, 0, 0, 0, 0x01, 0, 0, 0})
+	return b.Bytes()
+}
+
+func TestDecodeSample(t *testing.T) {
+	f, err := os.Open("../../_examples/sample1.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	src, _, err := image.Decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := src.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), src, b.Min, draw.Src)
+
+	rows := make([][]byte, b.Dy())
+	for y := range rows {
+		row := make([]byte, 3*b.Dx())
+		for x := 0; x < b.Dx(); x++ {
+			p := rgba.Pix[y*rgba.Stride+4*x:]
+			row[3*x], row[3*x+1], row[3*x+2] = p[2], p[1], p[0]
+		}
+		rows[b.Dy()-1-y] = row
+	}
+	img, err := Decode(bytes.NewReader(encode(b.Dx(), b.Dy(), 24, 0, 40, false, nil, nil, rows)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(img.(*image.RGBA).Pix, rgba.Pix) {
+		t.Errorf("Decoded pixels differ from the encoded ones")
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	valid := encode(2, 2, 24, 0, 40, false, nil, nil, [][]byte{make([]byte, 6), make([]byte, 6)})
+	rle := encode(2, 2, 8, 1, 40, false, nil, nil, nil)
+	huge := encode(1<<20, 1<<20, 24, 0, 40, false, nil, nil, nil)
+	for _, data := range [][]byte{
+		nil,
+		[]byte("BM"),
+		[]byte("GIF89a"),
+		valid[:len(valid)-1],
+		rle,
+		huge,
+	} {
+		if _, err := Decode(bytes.NewReader(data)); err == nil {
+			t.Errorf("Should got error for %q", data)
+		}
+	}
+}
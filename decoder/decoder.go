@@ -0,0 +1,188 @@
+// Copyright 2017 The goimagehash Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package decoder
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"os"
+	"sync"
+)
+
+// Format is an image format: how to recognize its files and decode them.
+type Format struct {
+	// Name is the name of the format, such as "png", returned by Decode.
+	Name string
+	// Magic lists the prefixes of the encoded images. A '?' matches any
+	// byte.
+	Magic []string
+	// Extensions lists the usual file extensions of the format, in lower
+	// case and without dot, such as "jpg" and "jpeg".
+	Extensions []string
+	// Decode decodes an image.
+	Decode func(io.Reader) (image.Image, error)
+	// DecodeConfig decodes the color model and dimensions of an image
+	// without decoding the image.
+	DecodeConfig func(io.Reader) (image.Config, error)
+}
+
+var (
+	mu      sync.RWMutex
+	formats []Format
+)
+
+func init() {
+	// The standard library formats register themselves with the image
+	// package on import.
+	add(Format{Name: "jpeg", Magic: []string{"\xff\xd8"}, Extensions: []string{"jpg", "jpeg"}, Decode: jpeg.Decode, DecodeConfig: jpeg.DecodeConfig})
+	add(Format{Name: "png", Magic: []string{"\x89PNG\r\n\x1a\n"}, Extensions: []string{"png"}, Decode: png.Decode, DecodeConfig: png.DecodeConfig})
+	add(Format{Name: "gif", Magic: []string{"GIF87a", "GIF89a"}, Extensions: []string{"gif"}, Decode: gif.Decode, DecodeConfig: gif.DecodeConfig})
+}
+
+// Register function registers an image format, with this package and with
+// the image package. It is meant to be called from the init function of
+// the package of the format. Register panics if the format is incomplete
+// or if a format of the same name is already registered.
+func Register(f Format) {
+	add(f)
+	for _, magic := range f.Magic {
+		image.RegisterFormat(f.Name, magic, f.Decode, f.DecodeConfig)
+	}
+}
+
+func add(f Format) {
+	if f.Name == "" || len(f.Magic) == 0 || f.Decode == nil || f.DecodeConfig == nil {
+		panic("decoder: Register of an incomplete format " + f.Name)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	for _, g := range formats {
+		if g.Name == f.Name {
+			panic("decoder: Register called twice for format " + f.Name)
+		}
+	}
+	formats = append(formats, f)
+}
+
+// Formats function returns the registered formats, in the order of
+// registration.
+func Formats() []Format {
+	mu.RLock()
+	defer mu.RUnlock()
+	return append([]Format(nil), formats...)
+}
+
+// Extensions function returns the file extensions of the registered
+// formats, in the order of registration.
+func Extensions() []string {
+	var extensions []string
+	seen := make(map[string]bool)
+	for _, f := range Formats() {
+		for _, ext := range f.Extensions {
+			if !seen[ext] {
+				seen[ext] = true
+				extensions = append(extensions, ext)
+			}
+		}
+	}
+	return extensions
+}
+
+// Sniff function returns the first registered format of which a magic
+// string is a prefix of header.
+func Sniff(header []byte) (Format, bool) {
+	for _, f := range Formats() {
+		for _, magic := range f.Magic {
+			if match(magic, header) {
+				return f, true
+			}
+		}
+	}
+	return Format{}, false
+}
+
+// match reports whether magic, with '?' matching any byte, is a prefix of
+// b.
+func match(magic string, b []byte) bool {
+	if len(magic) > len(b) {
+		return false
+	}
+	for i := 0; i < len(magic); i++ {
+		if magic[i] != b[i] && magic[i] != '?' {
+			return false
+		}
+	}
+	return true
+}
+
+// magicLen returns the length of the longest magic string.
+func magicLen() int {
+	n := 0
+	for _, f := range Formats() {
+		for _, magic := range f.Magic {
+			if len(magic) > n {
+				n = len(magic)
+			}
+		}
+	}
+	return n
+}
+
+// sniff returns a reader of the content of r and the format of its header.
+// Unless ok, the format is not registered with this package.
+func sniff(r io.Reader) (*bufio.Reader, Format, bool) {
+	br, isBuffered := r.(*bufio.Reader)
+	if !isBuffered {
+		br = bufio.NewReader(r)
+	}
+	// A short image fails to decode, not to peek.
+	header, _ := br.Peek(magicLen())
+	f, ok := Sniff(header)
+	return br, f, ok
+}
+
+// Decode function decodes an image of a registered format, recognized by
+// its magic bytes. Images of formats registered only with the image
+// package are decoded by image.Decode. The string returned is the name of
+// the format.
+func Decode(r io.Reader) (image.Image, string, error) {
+	br, f, ok := sniff(r)
+	if !ok {
+		return image.Decode(br)
+	}
+	img, err := f.Decode(br)
+	return img, f.Name, err
+}
+
+// DecodeConfig function decodes the color model and dimensions of an image
+// as Decode does, without decoding the image.
+func DecodeConfig(r io.Reader) (image.Config, string, error) {
+	br, f, ok := sniff(r)
+	if !ok {
+		return image.DecodeConfig(br)
+	}
+	config, err := f.DecodeConfig(br)
+	return config, f.Name, err
+}
+
+// DecodeFile function decodes the image file at path, whatever its
+// extension.
+func DecodeFile(path string) (image.Image, string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, "", err
+	}
+	defer f.Close()
+	img, format, err := Decode(f)
+	if err != nil {
+		return nil, format, fmt.Errorf("%s: %w", path, err)
+	}
+	return img, format, nil
+}
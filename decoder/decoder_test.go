@@ -0,0 +1,107 @@
+// Copyright 2017 The goimagehash Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package decoder
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+// decodeTest decodes images of the "test" format: "TEST" followed by the
+// gray level of a 1x1 image.
+func decodeTest(r io.Reader) (image.Image, error) {
+	var b [5]byte
+	if _, err := io.ReadFull(r, b[:]); err != nil {
+		return nil, err
+	}
+	img := image.NewGray(image.Rect(0, 0, 1, 1))
+	img.Pix[0] = b[4]
+	return img, nil
+}
+
+func decodeTestConfig(r io.Reader) (image.Config, error) {
+	return image.Config{ColorModel: color.GrayModel, Width: 1, Height: 1}, nil
+}
+
+func TestRegister(t *testing.T) {
+	Register(Format{Name: "test", Magic: []string{"TE?T"}, Extensions: []string{"tst", "jpg"}, Decode: decodeTest, DecodeConfig: decodeTestConfig})
+
+	img, format, err := Decode(strings.NewReader("TEST\x80"))
+	if err != nil || format != "test" || img.(*image.Gray).Pix[0] != 0x80 {
+		t.Errorf("Unexpected decoding %v, %s, %v", img, format, err)
+	}
+	if config, format, err := DecodeConfig(strings.NewReader("TEXT\x80")); err != nil || format != "test" || config.Width != 1 {
+		t.Errorf("Unexpected config %+v, %s, %v", config, format, err)
+	}
+	// The image package knows the format too.
+	if _, format, err := image.Decode(strings.NewReader("TEST\x80")); err != nil || format != "test" {
+		t.Errorf("Unexpected decoding by the image package %s, %v", format, err)
+	}
+
+	want := []string{"jpg", "jpeg", "png", "gif", "tst"}
+	if got := Extensions(); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("Expected extensions %v but got %v", want, got)
+	}
+
+	for _, f := range []Format{
+		{Name: "test", Magic: []string{"TEST"}, Decode: decodeTest, DecodeConfig: decodeTestConfig},
+		{Name: "incomplete", Magic: []string{"INC"}},
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Should got panic for %s", f.Name)
+				}
+			}()
+			Register(f)
+		}()
+	}
+}
+
+func TestSniff(t *testing.T) {
+	for header, want := range map[string]string{
+		"\xff\xd8\xff\xe0":     "jpeg",
+		"\x89PNG\r\n\x1a\n...": "png",
+		"GIF87a":               "gif",
+		"GIF89a":               "gif",
+		"GIF8":                 "",
+		"":                     "",
+		"BM":                   "",
+	} {
+		f, ok := Sniff([]byte(header))
+		if ok != (want != "") || f.Name != want {
+			t.Errorf("Expected %q for %q but got %q, %v", want, header, f.Name, ok)
+		}
+	}
+}
+
+func TestDecodeFile(t *testing.T) {
+	// The format comes from the content, not the extension.
+	data, err := os.ReadFile("../_examples/sample1.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := t.TempDir() + "/sample1.png"
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	img, format, err := DecodeFile(path)
+	if err != nil || format != "jpeg" || img.Bounds().Empty() {
+		t.Errorf("Unexpected decoding %s, %v", format, err)
+	}
+
+	if _, _, err := Decode(bytes.NewReader([]byte("not an image"))); !errors.Is(err, image.ErrFormat) {
+		t.Errorf("Expected image.ErrFormat but got %v", err)
+	}
+	if _, _, err := DecodeFile(t.TempDir() + "/missing.png"); err == nil {
+		t.Errorf("Should got error for a missing file")
+	}
+}
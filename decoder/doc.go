@@ -0,0 +1,23 @@
+// Copyright 2017 The goimagehash Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package decoder keeps a registry of image formats with their magic bytes
+// and file extensions, and decodes images by sniffing their format from the
+// content rather than from the file name.
+//
+// The GIF, JPEG and PNG formats of the standard library are registered by
+// this package. Other formats register themselves when their package is
+// imported, such as the pure Go decoders of the subpackages:
+//
+//	import (
+//		"github.com/lollipopkit/goimagehash/decoder"
+//		_ "github.com/lollipopkit/goimagehash/decoder/bmp"
+//		_ "github.com/lollipopkit/goimagehash/decoder/netpbm"
+//	)
+//
+//	img, format, err := decoder.DecodeFile("scan.pgm")
+//
+// Registered formats are also registered with the image package, so that
+// image.Decode and image.DecodeConfig decode them too.
+package decoder
@@ -0,0 +1,411 @@
+// Copyright 2017 The goimagehash Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package netpbm implements a pure Go decoder of the Netpbm image formats
+// and registers it with the decoder package on import: PBM (P1 and P4),
+// PGM (P2 and P5), PPM (P3 and P6) and PAM (P7), with 8 and 16 bits
+// samples.
+package netpbm
+
+import (
+	"bufio"
+	"image"
+	"image/color"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/lollipopkit/goimagehash/decoder"
+)
+
+func init() {
+	for _, f := range []struct {
+		name       string
+		magic      []string
+		extensions []string
+	}{
+		{"pbm", []string{"P1", "P4"}, []string{"pbm"}},
+		{"pgm", []string{"P2", "P5"}, []string{"pgm"}},
+		{"ppm", []string{"P3", "P6"}, []string{"ppm", "pnm"}},
+		{"pam", []string{"P7"}, []string{"pam"}},
+	} {
+		decoder.Register(decoder.Format{
+			Name:         f.name,
+			Magic:        f.magic,
+			Extensions:   f.extensions,
+			Decode:       Decode,
+			DecodeConfig: DecodeConfig,
+		})
+	}
+}
+
+// A FormatError reports that the input is not a valid Netpbm image.
+type FormatError string
+
+func (e FormatError) Error() string { return "netpbm: invalid format: " + string(e) }
+
+// An UnsupportedError reports that the input uses a valid but unimplemented
+// Netpbm feature.
+type UnsupportedError string
+
+func (e UnsupportedError) Error() string { return "netpbm: unsupported feature: " + string(e) }
+
+// maxPixels bounds the number of pixels of an image read from a header.
+const maxPixels = 1 << 28
+
+// maxValue is the largest sample value of the header of an image.
+const maxValue = 65535
+
+type header struct {
+	// magic is the format number, 1 to 7 for P1 to P7.
+	magic         byte
+	width, height int
+	// channels is the number of samples per pixel: 1 for gray, 2 for gray
+	// and alpha, 3 for RGB and 4 for RGB and alpha.
+	channels int
+	maxval   int
+}
+
+func (h *header) plain() bool { return h.magic <= '3' }
+
+func (h *header) bitmap() bool { return h.magic == '1' || h.magic == '4' }
+
+// colorModel returns the color model of the decoded image.
+func (h *header) colorModel() color.Model {
+	wide := h.maxval > 0xff
+	switch {
+	case h.channels == 1 && wide:
+		return color.Gray16Model
+	case h.channels == 1:
+		return color.GrayModel
+	case h.channels == 3 && wide:
+		return color.RGBA64Model
+	case h.channels == 3:
+		return color.RGBAModel
+	case wide:
+		return color.NRGBA64Model
+	default:
+		return color.NRGBAModel
+	}
+}
+
+// reader returns r as a *bufio.Reader.
+func reader(r io.Reader) *bufio.Reader {
+	if br, ok := r.(*bufio.Reader); ok {
+		return br
+	}
+	return bufio.NewReader(r)
+}
+
+// readHeader reads the header of an image, up to its first sample.
+func readHeader(r *bufio.Reader) (*header, error) {
+	var magic [2]byte
+	if _, err := io.ReadFull(r, magic[:]); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	if magic[0] != 'P' || magic[1] < '1' || magic[1] > '7' {
+		return nil, FormatError("not a Netpbm file")
+	}
+	h := &header{magic: magic[1], channels: 1, maxval: 1}
+	if h.magic == '7' {
+		if err := readPAMHeader(r, h); err != nil {
+			return nil, err
+		}
+	} else {
+		if c, err := r.Peek(1); err != nil || !isSpace(c[0]) && c[0] != '#' {
+			return nil, FormatError("not a Netpbm file")
+		}
+		fields := []*int{&h.width, &h.height}
+		if !h.bitmap() {
+			fields = append(fields, &h.maxval)
+		}
+		for _, field := range fields {
+			if err := skipSpace(r); err != nil {
+				return nil, err
+			}
+			n, err := readInt(r)
+			if err != nil {
+				return nil, err
+			}
+			*field = n
+		}
+		if h.magic == '3' || h.magic == '6' {
+			h.channels = 3
+		}
+		if !h.plain() {
+			// A single whitespace precedes the samples.
+			c, err := r.ReadByte()
+			if err != nil {
+				return nil, unexpectedEOF(err)
+			}
+			if !isSpace(c) {
+				return nil, FormatError("no whitespace after the header")
+			}
+		}
+	}
+	if h.width <= 0 || h.height <= 0 {
+		return nil, FormatError("non-positive dimension")
+	}
+	if h.width > maxPixels/h.height {
+		return nil, UnsupportedError("image too large")
+	}
+	if h.maxval <= 0 || h.maxval > maxValue {
+		return nil, FormatError("maximum value out of range")
+	}
+	return h, nil
+}
+
+// readPAMHeader reads the header lines of a PAM image, up to ENDHDR.
+func readPAMHeader(r *bufio.Reader, h *header) error {
+	depth := 0
+	h.maxval = 0
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return unexpectedEOF(err)
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if fields[0] == "ENDHDR" {
+			break
+		}
+		if fields[0] == "TUPLTYPE" {
+			// The depth tells how to read the samples.
+			continue
+		}
+		var field *int
+		switch fields[0] {
+		case "WIDTH":
+			field = &h.width
+		case "HEIGHT":
+			field = &h.height
+		case "DEPTH":
+			field = &depth
+		case "MAXVAL":
+			field = &h.maxval
+		default:
+			return FormatError("unknown header line " + strconv.Quote(fields[0]))
+		}
+		if len(fields) != 2 {
+			return FormatError("invalid header line " + strconv.Quote(strings.TrimSpace(line)))
+		}
+		n, err := strconv.Atoi(fields[1])
+		if err != nil || n < 0 {
+			return FormatError("invalid " + fields[0])
+		}
+		*field = n
+	}
+	if depth < 1 || depth > 4 {
+		return UnsupportedError("depth " + strconv.Itoa(depth))
+	}
+	h.channels = depth
+	return nil
+}
+
+// skipSpace skips the whitespace and the comments before a header field.
+func skipSpace(r *bufio.Reader) error {
+	for {
+		c, err := r.ReadByte()
+		if err != nil {
+			return unexpectedEOF(err)
+		}
+		switch {
+		case c == '#':
+			if _, err := r.ReadString('\n'); err != nil {
+				return unexpectedEOF(err)
+			}
+		case !isSpace(c):
+			return r.UnreadByte()
+		}
+	}
+}
+
+// readInt reads a decimal number and leaves the following byte unread.
+func readInt(r *bufio.Reader) (int, error) {
+	n, digits := 0, 0
+	for {
+		c, err := r.ReadByte()
+		if err == io.EOF && digits > 0 {
+			return n, nil
+		}
+		if err != nil {
+			return 0, unexpectedEOF(err)
+		}
+		if c < '0' || c > '9' {
+			if digits == 0 {
+				return 0, FormatError("expected a number")
+			}
+			return n, r.UnreadByte()
+		}
+		if n > maxPixels {
+			return 0, FormatError("number out of range")
+		}
+		n = n*10 + int(c-'0')
+		digits++
+	}
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\v' || c == '\f'
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// DecodeConfig function returns the color model and dimensions of a Netpbm
+// image without decoding the entire image.
+func DecodeConfig(r io.Reader) (image.Config, error) {
+	h, err := readHeader(reader(r))
+	if err != nil {
+		return image.Config{}, err
+	}
+	return image.Config{ColorModel: h.colorModel(), Width: h.width, Height: h.height}, nil
+}
+
+// Decode function reads a Netpbm image from r and returns it as an
+// image.Image: an *image.Gray or *image.Gray16 for one sample per pixel,
+// bitmaps included, an *image.RGBA or *image.RGBA64 for RGB, and an
+// *image.NRGBA or *image.NRGBA64 with alpha. Samples are scaled from the
+// maximum value of the image to the full range.
+func Decode(r io.Reader) (image.Image, error) {
+	br := reader(r)
+	h, err := readHeader(br)
+	if err != nil {
+		return nil, err
+	}
+	img, set := newImage(h)
+	samples := make([]int, h.width*h.channels)
+	for y := 0; y < h.height; y++ {
+		if err := readRow(br, h, samples); err != nil {
+			return nil, err
+		}
+		for i, v := range samples {
+			if v > h.maxval {
+				return nil, FormatError("sample out of range")
+			}
+			if h.bitmap() {
+				// 1 is black.
+				samples[i] = 1 - v
+			}
+		}
+		for x := 0; x < h.width; x++ {
+			set(x, y, samples[x*h.channels:(x+1)*h.channels])
+		}
+	}
+	return img, nil
+}
+
+// readRow reads the samples of a row.
+func readRow(r *bufio.Reader, h *header, samples []int) error {
+	switch {
+	case h.magic == '1':
+		// Digits need no separator.
+		for i := range samples {
+			if err := skipSpace(r); err != nil {
+				return err
+			}
+			c, _ := r.ReadByte()
+			if c != '0' && c != '1' {
+				return FormatError("invalid bit")
+			}
+			samples[i] = int(c - '0')
+		}
+	case h.plain():
+		for i := range samples {
+			if err := skipSpace(r); err != nil {
+				return err
+			}
+			n, err := readInt(r)
+			if err != nil {
+				return err
+			}
+			samples[i] = n
+		}
+	case h.magic == '4':
+		// Rows are packed 8 pixels per byte, most significant bit first.
+		row := make([]byte, (h.width+7)/8)
+		if _, err := io.ReadFull(r, row); err != nil {
+			return unexpectedEOF(err)
+		}
+		for i := range samples {
+			samples[i] = int(row[i/8]>>(7-uint(i%8))) & 1
+		}
+	default:
+		size := 1
+		if h.maxval > 0xff {
+			size = 2
+		}
+		row := make([]byte, len(samples)*size)
+		if _, err := io.ReadFull(r, row); err != nil {
+			return unexpectedEOF(err)
+		}
+		for i := range samples {
+			if size == 2 {
+				samples[i] = int(row[2*i])<<8 | int(row[2*i+1])
+			} else {
+				samples[i] = int(row[i])
+			}
+		}
+	}
+	return nil
+}
+
+// newImage returns the image of a header and a function setting a pixel
+// from its samples.
+func newImage(h *header) (image.Image, func(x, y int, s []int)) {
+	rect := image.Rect(0, 0, h.width, h.height)
+	max := h.maxval
+	if h.maxval > 0xff {
+		scale := func(v int) uint16 { return uint16((v*0xffff + max/2) / max) }
+		switch h.channels {
+		case 1:
+			m := image.NewGray16(rect)
+			return m, func(x, y int, s []int) { m.SetGray16(x, y, color.Gray16{scale(s[0])}) }
+		case 2:
+			m := image.NewNRGBA64(rect)
+			return m, func(x, y int, s []int) {
+				g := scale(s[0])
+				m.SetNRGBA64(x, y, color.NRGBA64{g, g, g, scale(s[1])})
+			}
+		case 3:
+			m := image.NewRGBA64(rect)
+			return m, func(x, y int, s []int) {
+				m.SetRGBA64(x, y, color.RGBA64{scale(s[0]), scale(s[1]), scale(s[2]), 0xffff})
+			}
+		default:
+			m := image.NewNRGBA64(rect)
+			return m, func(x, y int, s []int) {
+				m.SetNRGBA64(x, y, color.NRGBA64{scale(s[0]), scale(s[1]), scale(s[2]), scale(s[3])})
+			}
+		}
+	}
+	scale := func(v int) uint8 { return uint8((v*0xff + max/2) / max) }
+	switch h.channels {
+	case 1:
+		m := image.NewGray(rect)
+		return m, func(x, y int, s []int) { m.Pix[y*m.Stride+x] = scale(s[0]) }
+	case 2:
+		m := image.NewNRGBA(rect)
+		return m, func(x, y int, s []int) {
+			g := scale(s[0])
+			copy(m.Pix[y*m.Stride+4*x:], []uint8{g, g, g, scale(s[1])})
+		}
+	case 3:
+		m := image.NewRGBA(rect)
+		return m, func(x, y int, s []int) {
+			copy(m.Pix[y*m.Stride+4*x:], []uint8{scale(s[0]), scale(s[1]), scale(s[2]), 0xff})
+		}
+	default:
+		m := image.NewNRGBA(rect)
+		return m, func(x, y int, s []int) {
+			copy(m.Pix[y*m.Stride+4*x:], []uint8{scale(s[0]), scale(s[1]), scale(s[2]), scale(s[3])})
+		}
+	}
+}
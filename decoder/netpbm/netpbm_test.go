@@ -0,0 +1,111 @@
+// Copyright 2017 The goimagehash Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netpbm
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/jpeg"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDecode(t *testing.T) {
+	black, white := color.NRGBA{0, 0, 0, 0xff}, color.NRGBA{0xff, 0xff, 0xff, 0xff}
+	gray := color.NRGBA{0x80, 0x80, 0x80, 0xff}
+	red, green, blue := color.NRGBA{0xff, 0, 0, 0xff}, color.NRGBA{0, 0xff, 0, 0xff}, color.NRGBA{0, 0, 0xff, 0xff}
+	for _, tt := range []struct {
+		name string
+		data string
+		// want is the top row and the bottom row of a 2x2 image.
+		want [4]color.NRGBA
+	}{
+		{"P1", "P1\n# comment\n2 2\n1 0\n01\n", [4]color.NRGBA{black, white, white, black}},
+		{"P4", "P4 2 2\n\x80\x40", [4]color.NRGBA{black, white, white, black}},
+		{"P2", "P2\n2 2\n4\n0 4\n2 4\n", [4]color.NRGBA{black, white, gray, white}},
+		{"P5", "P5\n2 2 255\n\x00\xff\x80\xff", [4]color.NRGBA{black, white, gray, white}},
+		{"P5 16 bits", "P5\n2 2 65535\n\x00\x00\xff\xff\x80\x80\xff\xff", [4]color.NRGBA{black, white, gray, white}},
+		{"P3", "P3 2 2 1  1 0 0  0 1 0  0 0 1  1 1 1", [4]color.NRGBA{red, green, blue, white}},
+		{"P6", "P6\n2 2\n255\n\xff\x00\x00\x00\xff\x00\x00\x00\xff\xff\xff\xff", [4]color.NRGBA{red, green, blue, white}},
+		{"P7 RGB_ALPHA", "P7\nWIDTH 2\nHEIGHT 2\nDEPTH 4\nMAXVAL 255\nTUPLTYPE RGB_ALPHA\nENDHDR\n" +
+			"\xff\x00\x00\xff\x00\xff\x00\x80\x00\x00\xff\x00\xff\xff\xff\xff",
+			[4]color.NRGBA{red, {0, 0xff, 0, 0x80}, {0, 0, 0xff, 0}, white}},
+		{"P7 BLACKANDWHITE", "P7\n# comment\nWIDTH 2\nHEIGHT 2\nDEPTH 1\nMAXVAL 1\nTUPLTYPE BLACKANDWHITE\nENDHDR\n\x00\x01\x01\x00",
+			[4]color.NRGBA{black, white, white, black}},
+		{"P7 GRAYSCALE_ALPHA", "P7\nWIDTH 2\nHEIGHT 2\nDEPTH 2\nMAXVAL 255\nENDHDR\n\x00\xff\xff\xff\x80\xff\xff\xff",
+			[4]color.NRGBA{black, white, gray, white}},
+	} {
+		img, err := Decode(strings.NewReader(tt.data))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if b := img.Bounds(); b.Dx() != 2 || b.Dy() != 2 {
+			t.Errorf("%s: unexpected bounds %v", tt.name, b)
+			continue
+		}
+		for i, p := range []image.Point{{0, 0}, {1, 0}, {0, 1}, {1, 1}} {
+			if got := color.NRGBAModel.Convert(img.At(p.X, p.Y)).(color.NRGBA); got != tt.want[i] {
+				t.Errorf("%s: pixel %v is %v, expected %v", tt.name, p, got, tt.want[i])
+			}
+		}
+		config, err := DecodeConfig(strings.NewReader(tt.data))
+		if err != nil || config.Width != 2 || config.Height != 2 || !reflect.DeepEqual(config.ColorModel, img.ColorModel()) {
+			t.Errorf("%s: unexpected config %+v, %v", tt.name, config, err)
+		}
+	}
+}
+
+func TestDecodeSample(t *testing.T) {
+	f, err := os.Open("../../_examples/sample1.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	src, _, err := image.Decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := src.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), src, b.Min, draw.Src)
+
+	var ppm bytes.Buffer
+	fmt.Fprintf(&ppm, "P6\n%d %d\n255\n", b.Dx(), b.Dy())
+	for i := 0; i < len(rgba.Pix); i += 4 {
+		ppm.Write(rgba.Pix[i : i+3])
+	}
+	img, err := Decode(&ppm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(img.(*image.RGBA).Pix, rgba.Pix) {
+		t.Errorf("Decoded pixels differ from the encoded ones")
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	for _, data := range []string{
+		"",
+		"P8\n1 1\n",
+		"P12 2\n",
+		"P5\n2 2\n255\n\x00\x00\x00",
+		"P2\n1 1\n4\n5\n",
+		"P2\n1 1\n0\n0\n",
+		"P1\n1 1\n2\n",
+		"P5\n100000 100000\n255\n",
+		"P7\nWIDTH 1\nHEIGHT 1\nDEPTH 5\nMAXVAL 255\nENDHDR\n\x00\x00\x00\x00\x00",
+		"P7\nWIDTH 1\nHEIGHT 1\nDEPTH 1\nMAXVAL 255\n",
+	} {
+		if _, err := Decode(strings.NewReader(data)); err == nil {
+			t.Errorf("Should got error for %q", data)
+		}
+	}
+}
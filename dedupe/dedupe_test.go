@@ -0,0 +1,253 @@
+// Copyright 2017 The goimagehash Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dedupe
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestJPEGQuality(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 16, 16))
+	for y := 0; y < 16; y++ {
+		for x := 0; x < 16; x++ {
+			img.Set(x, y, color.RGBA{uint8(x * 16), uint8(y * 16), 0, 255})
+		}
+	}
+	for _, quality := range []int{5, 10, 30, 50, 75, 90, 100} {
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+			t.Fatalf("%v", err)
+		}
+		q, err := JPEGQuality(&buf)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		if q < quality-2 || q > quality+2 {
+			t.Errorf("Expected quality about %d but got %d", quality, q)
+		}
+	}
+	if _, err := JPEGQuality(bytes.NewReader([]byte("GIF89a"))); err == nil {
+		t.Errorf("Should got error for non JPEG stream")
+	}
+}
+
+func TestInspectReader(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 24, 12))
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 60}); err != nil {
+		t.Fatalf("%v", err)
+	}
+	modTime := time.Date(2019, 4, 1, 0, 0, 0, 0, time.UTC)
+	f, err := InspectReader("a.zip!/b.jpg", bytes.NewReader(buf.Bytes()), 1234, modTime)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if f.Path != "a.zip!/b.jpg" || f.Format != "jpeg" || f.Width != 24 || f.Height != 12 {
+		t.Errorf("Unexpected file %+v", f)
+	}
+	if f.Size != 1234 || !f.ModTime.Equal(modTime) {
+		t.Errorf("Expected the given size and time but got %d and %v", f.Size, f.ModTime)
+	}
+	if f.Quality < 58 || f.Quality > 62 {
+		t.Errorf("Expected quality about 60 but got %d", f.Quality)
+	}
+	if _, err := InspectReader("x", bytes.NewReader([]byte("not an image")), 12, modTime); err == nil {
+		t.Errorf("Should got error for non image stream")
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	now := time.Now()
+	files := []File{
+		{Path: "b/small.jpg", Width: 100, Height: 100, Size: 10, Quality: 90, ModTime: now},
+		{Path: "a/large.jpg", Width: 200, Height: 200, Size: 5, Quality: 50, ModTime: now},
+		{Path: "c/large.png", Width: 200, Height: 200, Size: 50, Quality: 100, ModTime: now.Add(time.Hour)},
+		{Path: "Downloads/old.jpg", Width: 200, Height: 200, Size: 8, Quality: 50, ModTime: now.Add(-time.Hour)},
+	}
+	for _, tt := range []struct {
+		spec     string
+		rules    []string
+		expected []string
+	}{
+		{"resolution", nil, []string{"Downloads/old.jpg", "a/large.jpg", "c/large.png", "b/small.jpg"}},
+		{"resolution,quality", nil, []string{"c/large.png", "Downloads/old.jpg", "a/large.jpg", "b/small.jpg"}},
+		{"size", nil, []string{"c/large.png", "b/small.jpg", "Downloads/old.jpg", "a/large.jpg"}},
+		{"oldest,path", []string{"b/"}, []string{"Downloads/old.jpg", "b/small.jpg", "a/large.jpg", "c/large.png"}},
+		{"path,oldest", []string{"!Downloads/*", "b/*.jpg"}, []string{"b/small.jpg", "a/large.jpg", "c/large.png", "Downloads/old.jpg"}},
+	} {
+		policy, err := ParsePolicy(tt.spec, tt.rules)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		for i, f := range policy.Rank(files) {
+			if f.Path != tt.expected[i] {
+				t.Errorf("%s: expected %v at %d but got %s", tt.spec, tt.expected[i], i, f.Path)
+			}
+		}
+	}
+	if _, err := ParsePolicy("resolution,prettiest", nil); err == nil {
+		t.Errorf("Should got error for unknown policy")
+	}
+
+	prefer := PathPriority([]string{"photos", "!trash/"})
+	for _, tt := range []struct {
+		a, b     string
+		expected int
+	}{
+		{"photos/a.jpg", "other/a.jpg", -1},
+		{"photos", "other/a.jpg", -1},
+		{"photos-old/a.jpg", "other/a.jpg", 0},
+		{"photos2/a.jpg", "other/a.jpg", 0},
+		{"trash/a.jpg", "trash-can/a.jpg", 1},
+	} {
+		if got := prefer(File{Path: tt.a}, File{Path: tt.b}); got != tt.expected {
+			t.Errorf("%s vs %s: expected %d but got %d", tt.a, tt.b, tt.expected, got)
+		}
+	}
+
+	plan := Resolve([][]File{files[:1], files}, Policy{LargestFile()})
+	if len(plan) != 1 || plan[0].Keep.Path != "c/large.png" || len(plan[0].Remove) != 3 {
+		t.Errorf("Unexpected plan %+v", plan)
+	}
+}
+
+func writeImage(t *testing.T, path string) {
+	var buf bytes.Buffer
+	png.Encode(&buf, image.NewGray(image.Rect(0, 0, 3, 2)))
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatalf("%v", err)
+	}
+}
+
+func TestApply(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dedupe")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, action := range []Action{Move, Hardlink, Symlink, Delete} {
+		keep := filepath.Join(dir, action.String()+"-keep.png")
+		remove := filepath.Join(dir, action.String()+"-remove.png")
+		writeImage(t, keep)
+		writeImage(t, remove)
+		kept, err := Inspect(keep)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		if kept.Format != "png" || kept.Width != 3 || kept.Height != 2 || kept.Quality != 100 {
+			t.Errorf("Unexpected file %+v", kept)
+		}
+		plan := Plan{{Keep: kept, Remove: []File{{Path: remove}}}}
+		opts := Options{Action: action, MoveTo: filepath.Join(dir, "moved"), DryRun: true}
+
+		ops, err := plan.Apply(opts)
+		if err != nil || len(ops) != 1 {
+			t.Fatalf("%v: %v, %v", action, ops, err)
+		}
+		if info, err := os.Lstat(remove); err != nil || info.Mode()&os.ModeSymlink != 0 {
+			t.Errorf("%v: dry run should not touch files", action)
+		}
+
+		opts.DryRun = false
+		if ops, err = plan.Apply(opts); err != nil {
+			t.Fatalf("%v: %v", action, err)
+		}
+		info, err := os.Lstat(remove)
+		switch action {
+		case Move:
+			if !os.IsNotExist(err) {
+				t.Errorf("move should remove the file")
+			}
+			if _, err := os.Stat(ops[0].Target); err != nil {
+				t.Errorf("move should create %s: %v", ops[0].Target, err)
+			}
+		case Delete:
+			if !os.IsNotExist(err) {
+				t.Errorf("delete should remove the file")
+			}
+		case Hardlink:
+			keepInfo, _ := os.Stat(keep)
+			if err != nil || !os.SameFile(info, keepInfo) {
+				t.Errorf("hardlink should link to the kept file")
+			}
+		case Symlink:
+			if err != nil || info.Mode()&os.ModeSymlink == 0 {
+				t.Fatalf("symlink should create a symbolic link")
+			}
+			if _, err := Inspect(remove); err != nil {
+				t.Errorf("symlink should resolve to the kept file: %v", err)
+			}
+		}
+	}
+
+	// Moves never overwrite: the second file of the same name is renamed.
+	a, b := filepath.Join(dir, "x.png"), filepath.Join(dir, "sub", "x.png")
+	os.MkdirAll(filepath.Dir(b), 0755)
+	writeImage(t, a)
+	writeImage(t, b)
+	plan := Plan{{Keep: File{Path: "keep.png"}, Remove: []File{{Path: a}, {Path: b}}}}
+	ops, err := plan.Apply(Options{Action: Move, MoveTo: filepath.Join(dir, "moved")})
+	if err != nil || ops[0].Target == ops[1].Target {
+		t.Errorf("Unexpected moves %v, %v", ops, err)
+	}
+	if _, err := plan.Apply(Options{Action: Move}); err == nil {
+		t.Errorf("Should got error for move without destination")
+	}
+}
+
+func TestSymlinks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dedupe")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// a_copy.png is a link to b.png, left by an earlier symlink action, and
+	// c.png a hard link to b.png.
+	target, link, hard := filepath.Join(dir, "b.png"), filepath.Join(dir, "a_copy.png"), filepath.Join(dir, "c.png")
+	writeImage(t, target)
+	if err := os.Symlink("b.png", link); err != nil {
+		t.Skipf("symbolic links are not supported: %v", err)
+	}
+	if err := os.Link(target, hard); err != nil {
+		t.Fatalf("%v", err)
+	}
+	var files []File
+	for _, path := range []string{link, target} {
+		f, err := Inspect(path)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		files = append(files, f)
+	}
+	if !files[0].Symlink || files[1].Symlink {
+		t.Fatalf("Unexpected files %+v", files)
+	}
+	plan := Resolve([][]File{files}, Policy{LargestResolution()})
+	if plan[0].Keep.Path != target {
+		t.Fatalf("Expected to keep %s rather than its link but kept %s", target, plan[0].Keep.Path)
+	}
+
+	plan[0].Remove = append(plan[0].Remove, File{Path: hard})
+	ops, err := plan.Apply(Options{Action: Delete})
+	if err != nil || len(ops) != 0 {
+		t.Errorf("Expected no operation on links to the kept file but got %v, %v", ops, err)
+	}
+	for _, path := range []string{target, link, hard} {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("%s should still resolve: %v", path, err)
+		}
+	}
+}
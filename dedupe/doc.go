@@ -0,0 +1,10 @@
+// Copyright 2017 The goimagehash Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package dedupe chooses which copy of a group of near-duplicate images to
+// keep. It ranks the files with a configurable policy, such as the largest
+// resolution, the largest file, the highest JPEG quality, the oldest file or
+// path priority rules, and applies the resulting plan by moving, linking or
+// deleting the other copies.
+package dedupe
@@ -0,0 +1,91 @@
+// Copyright 2017 The goimagehash Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dedupe
+
+import (
+	"bufio"
+	"image"
+	"io"
+	"os"
+	"time"
+)
+
+// File describes an image file for ranking.
+type File struct {
+	Path    string
+	Format  string
+	Width   int
+	Height  int
+	Size    int64
+	ModTime time.Time
+	// Quality is the estimated JPEG quality in [1, 100]. Lossless formats
+	// have 100 and formats of unknown quality have 0.
+	Quality int
+	// Symlink reports whether Path is a symbolic link. The other fields
+	// describe the file it points to.
+	Symlink bool
+}
+
+// Pixels method returns the resolution of the image.
+func (f File) Pixels() int {
+	return f.Width * f.Height
+}
+
+// losslessFormats are the formats of which quality is 100.
+var losslessFormats = map[string]bool{"png": true, "bmp": true, "tiff": true, "pbm": true, "pgm": true, "ppm": true, "pam": true}
+
+// Inspect function reads the size, the modification time and the image
+// header of the file at path. As with image.Decode, the decoders of the
+// supported formats must be registered by the caller.
+func Inspect(path string) (File, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return File{}, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return File{}, err
+	}
+	file, err := InspectReader(path, f, info.Size(), info.ModTime())
+	if err != nil {
+		return File{}, err
+	}
+	link, err := os.Lstat(path)
+	if err != nil {
+		return File{}, err
+	}
+	file.Symlink = link.Mode()&os.ModeSymlink != 0
+	return file, nil
+}
+
+// InspectReader function is like Inspect for an image that is not a plain
+// file, such as an archive entry: size and modTime are given by the caller
+// and r is read from its current offset.
+func InspectReader(path string, r io.ReadSeeker, size int64, modTime time.Time) (File, error) {
+	start, err := r.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return File{}, err
+	}
+	file := File{Path: path, Size: size, ModTime: modTime}
+	config, format, err := image.DecodeConfig(bufio.NewReader(r))
+	if err != nil {
+		return File{}, err
+	}
+	file.Format, file.Width, file.Height = format, config.Width, config.Height
+
+	switch {
+	case format == "jpeg":
+		if _, err := r.Seek(start, io.SeekStart); err != nil {
+			return File{}, err
+		}
+		if file.Quality, err = JPEGQuality(bufio.NewReader(r)); err != nil {
+			return File{}, err
+		}
+	case losslessFormats[format]:
+		file.Quality = 100
+	}
+	return file, nil
+}
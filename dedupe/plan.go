@@ -0,0 +1,204 @@
+// Copyright 2017 The goimagehash Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dedupe
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Decision is the outcome of a group of duplicates: the file to keep and the
+// files to remove, best first.
+type Decision struct {
+	Keep   File
+	Remove []File
+}
+
+// Plan is the list of decisions for every group of duplicates.
+type Plan []Decision
+
+// Resolve function ranks every group with the policy. Groups with less than
+// two files are ignored.
+func Resolve(groups [][]File, policy Policy) Plan {
+	var plan Plan
+	for _, g := range groups {
+		if len(g) < 2 {
+			continue
+		}
+		ranked := policy.Rank(g)
+		plan = append(plan, Decision{Keep: ranked[0], Remove: ranked[1:]})
+	}
+	return plan
+}
+
+// Action is what happens to the files to remove.
+type Action int
+
+const (
+	// None leaves the files untouched.
+	None Action = iota
+	// Move moves the files to another directory.
+	Move
+	// Hardlink replaces the files with hard links to the kept file.
+	Hardlink
+	// Symlink replaces the files with symbolic links to the kept file.
+	Symlink
+	// Delete deletes the files.
+	Delete
+)
+
+var actionNames = []string{"none", "move", "hardlink", "symlink", "delete"}
+
+// String method returns the name of the action.
+func (a Action) String() string {
+	if a < 0 || int(a) >= len(actionNames) {
+		return fmt.Sprintf("Action(%d)", int(a))
+	}
+	return actionNames[a]
+}
+
+// ParseAction function returns the action with the given name.
+func ParseAction(s string) (Action, error) {
+	for i, name := range actionNames {
+		if strings.EqualFold(s, name) {
+			return Action(i), nil
+		}
+	}
+	return None, fmt.Errorf("unknown action %q", s)
+}
+
+// Operation is a file operation of a plan.
+type Operation struct {
+	Action Action
+	// Path is the file to remove.
+	Path string
+	// Target is the kept file for links, or the destination of a move.
+	Target string
+	// Err is the error of the operation, when it was applied and failed.
+	Err error
+}
+
+// String method describes the operation.
+func (o Operation) String() string {
+	switch o.Action {
+	case Move:
+		return fmt.Sprintf("move %s -> %s", o.Path, o.Target)
+	case Hardlink, Symlink:
+		return fmt.Sprintf("%s %s -> %s", o.Action, o.Path, o.Target)
+	}
+	return fmt.Sprintf("%s %s", o.Action, o.Path)
+}
+
+// Options configures how a plan is applied.
+type Options struct {
+	Action Action
+	// MoveTo is the destination directory of Move.
+	MoveTo string
+	// DryRun only returns the operations without touching any file.
+	DryRun bool
+}
+
+// Apply method performs the action of opts on every file to remove and
+// returns the operations. Files that are the kept file itself, through a
+// symbolic or hard link, are left alone. A failed operation does not stop
+// the others; the first error is returned along with every operation and
+// its own error.
+func (p Plan) Apply(opts Options) ([]Operation, error) {
+	if opts.Action == Move && opts.MoveTo == "" {
+		return nil, errors.New("move action requires a destination directory")
+	}
+	if opts.Action < None || opts.Action > Delete {
+		return nil, fmt.Errorf("unknown action %v", opts.Action)
+	}
+	if opts.Action == None {
+		return nil, nil
+	}
+
+	var ops []Operation
+	var firstErr error
+	reserved := make(map[string]bool)
+	for _, d := range p {
+		kept, keptErr := os.Stat(d.Keep.Path)
+		for _, f := range d.Remove {
+			if info, err := os.Stat(f.Path); err == nil && keptErr == nil && os.SameFile(info, kept) {
+				continue
+			}
+			op := Operation{Action: opts.Action, Path: f.Path, Target: d.Keep.Path}
+			if opts.Action == Move {
+				op.Target = moveTarget(opts.MoveTo, f.Path, reserved)
+			}
+			if !opts.DryRun {
+				op.Err = apply(op)
+				if op.Err != nil && firstErr == nil {
+					firstErr = fmt.Errorf("%s: %v", f.Path, op.Err)
+				}
+			}
+			ops = append(ops, op)
+		}
+	}
+	return ops, firstErr
+}
+
+// moveTarget returns a path in dir named after path that neither exists nor
+// is used by another move of the plan.
+func moveTarget(dir, path string, reserved map[string]bool) string {
+	base := filepath.Base(path)
+	ext := filepath.Ext(base)
+	name := strings.TrimSuffix(base, ext)
+	target := filepath.Join(dir, base)
+	for i := 1; ; i++ {
+		if _, err := os.Lstat(target); os.IsNotExist(err) && !reserved[target] {
+			reserved[target] = true
+			return target
+		}
+		target = filepath.Join(dir, name+"-"+strconv.Itoa(i)+ext)
+	}
+}
+
+func apply(op Operation) error {
+	switch op.Action {
+	case Delete:
+		return os.Remove(op.Path)
+	case Move:
+		if err := os.MkdirAll(filepath.Dir(op.Target), 0755); err != nil {
+			return err
+		}
+		return os.Rename(op.Path, op.Target)
+	case Hardlink:
+		return replace(op.Path, func(tmp string) error { return os.Link(op.Target, tmp) })
+	case Symlink:
+		target, err := filepath.Abs(op.Target)
+		if err != nil {
+			return err
+		}
+		dir, err := filepath.Abs(filepath.Dir(op.Path))
+		if err != nil {
+			return err
+		}
+		if rel, err := filepath.Rel(dir, target); err == nil {
+			target = rel
+		}
+		return replace(op.Path, func(tmp string) error { return os.Symlink(target, tmp) })
+	}
+	return nil
+}
+
+// replace creates a link next to path with create and renames it over path,
+// so that path is never missing.
+func replace(path string, create func(tmp string) error) error {
+	tmp := path + ".goimagehash-tmp"
+	if err := create(tmp); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+// Copyright 2017 The goimagehash Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dedupe
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Criterion compares two files and returns a negative number when a should
+// be kept rather than b, a positive number for the opposite and zero when
+// the criterion can not tell them apart.
+type Criterion func(a, b File) int
+
+// Policy is a list of criteria applied in order until one of them tells two
+// files apart. Files no criterion tells apart are ranked by path.
+type Policy []Criterion
+
+func compareInts(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// LargestResolution function returns a criterion preferring more pixels.
+func LargestResolution() Criterion {
+	return func(a, b File) int { return compareInts(int64(b.Pixels()), int64(a.Pixels())) }
+}
+
+// LargestFile function returns a criterion preferring larger files.
+func LargestFile() Criterion {
+	return func(a, b File) int { return compareInts(b.Size, a.Size) }
+}
+
+// HighestQuality function returns a criterion preferring a higher estimated
+// JPEG quality, lossless formats first.
+func HighestQuality() Criterion {
+	return func(a, b File) int { return compareInts(int64(b.Quality), int64(a.Quality)) }
+}
+
+// Oldest function returns a criterion preferring the oldest modification
+// time.
+func Oldest() Criterion {
+	return func(a, b File) int { return compareInts(a.ModTime.UnixNano(), b.ModTime.UnixNano()) }
+}
+
+// PathPriority function returns a criterion preferring paths matched by the
+// earliest rule. A rule matches a path when it is the path or one of its
+// parent directories, compared by whole components so that "photos" matches
+// neither "photos-old/a.jpg" nor "photos2/a.jpg", or when it is a
+// filepath.Match pattern of the path. Rules starting with "!" match paths to
+// avoid instead: such paths rank after the paths no rule matches.
+func PathPriority(rules []string) Criterion {
+	rank := func(path string) int {
+		path = filepath.ToSlash(path)
+		prefer := 0
+		for _, rule := range rules {
+			if !strings.HasPrefix(rule, "!") {
+				prefer++
+			}
+		}
+		preferred, avoided := 0, 0
+		for _, rule := range rules {
+			avoid := strings.HasPrefix(rule, "!")
+			pattern := filepath.ToSlash(strings.TrimPrefix(rule, "!"))
+			matched, _ := filepath.Match(pattern, path)
+			if matched || hasPathPrefix(path, pattern) {
+				if avoid {
+					return prefer + 1 + avoided
+				}
+				return preferred
+			}
+			if avoid {
+				avoided++
+			} else {
+				preferred++
+			}
+		}
+		return prefer
+	}
+	return func(a, b File) int { return compareInts(int64(rank(a.Path)), int64(rank(b.Path))) }
+}
+
+// hasPathPrefix reports whether dir is path or one of its parent
+// directories. Both use slashes; dir may end with one.
+func hasPathPrefix(path, dir string) bool {
+	if dir == "" {
+		return false
+	}
+	if !strings.HasSuffix(dir, "/") {
+		if path == dir {
+			return true
+		}
+		dir += "/"
+	}
+	return strings.HasPrefix(path, dir)
+}
+
+// DefaultPolicy is the policy used when none is configured.
+const DefaultPolicy = "resolution,quality,size,oldest"
+
+// ParsePolicy function builds a policy from a comma separated list of
+// criteria among resolution, size, quality, oldest and path. The path
+// criterion applies pathRules as described by PathPriority.
+func ParsePolicy(spec string, pathRules []string) (Policy, error) {
+	var policy Policy
+	for _, name := range strings.Split(spec, ",") {
+		switch strings.TrimSpace(strings.ToLower(name)) {
+		case "resolution":
+			policy = append(policy, LargestResolution())
+		case "size":
+			policy = append(policy, LargestFile())
+		case "quality":
+			policy = append(policy, HighestQuality())
+		case "oldest":
+			policy = append(policy, Oldest())
+		case "path":
+			policy = append(policy, PathPriority(pathRules))
+		case "":
+		default:
+			return nil, fmt.Errorf("unknown keep policy %q", name)
+		}
+	}
+	return policy, nil
+}
+
+// Compare method compares two files with the criteria of the policy, then
+// by path. A regular file always comes before a symbolic link, which would
+// dangle once the file is removed.
+func (p Policy) Compare(a, b File) int {
+	if a.Symlink != b.Symlink {
+		if a.Symlink {
+			return 1
+		}
+		return -1
+	}
+	for _, c := range p {
+		if r := c(a, b); r != 0 {
+			return r
+		}
+	}
+	return strings.Compare(a.Path, b.Path)
+}
+
+// Rank method returns the files sorted from the one to keep to the first
+// one to remove.
+func (p Policy) Rank(files []File) []File {
+	ranked := append([]File(nil), files...)
+	sort.SliceStable(ranked, func(i, j int) bool { return p.Compare(ranked[i], ranked[j]) < 0 })
+	return ranked
+}
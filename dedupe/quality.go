@@ -0,0 +1,157 @@
+// Copyright 2017 The goimagehash Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dedupe
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// stdLuminance is the luminance quantization table of the JPEG standard,
+// which encoders scale by the requested quality.
+var stdLuminance = [64]int{
+	16, 11, 10, 16, 24, 40, 51, 61,
+	12, 12, 14, 19, 26, 58, 60, 55,
+	14, 13, 16, 24, 40, 57, 69, 56,
+	14, 17, 22, 29, 51, 87, 80, 62,
+	18, 22, 37, 56, 68, 109, 103, 77,
+	24, 35, 55, 64, 81, 104, 113, 92,
+	49, 64, 78, 87, 103, 121, 120, 101,
+	72, 92, 95, 98, 112, 100, 103, 99,
+}
+
+// zigzag maps the position of a coefficient in a DQT segment to its
+// position in the 8x8 block.
+var zigzag = [64]int{
+	0, 1, 8, 16, 9, 2, 3, 10,
+	17, 24, 32, 25, 18, 11, 4, 5,
+	12, 19, 26, 33, 40, 48, 41, 34,
+	27, 20, 13, 6, 7, 14, 21, 28,
+	35, 42, 49, 56, 57, 50, 43, 36,
+	29, 22, 15, 23, 30, 37, 44, 51,
+	58, 59, 52, 45, 38, 31, 39, 46,
+	53, 60, 61, 54, 47, 55, 62, 63,
+}
+
+// JPEGQuality function estimates the quality setting a JPEG stream was
+// encoded with, in [1, 100], from its luminance quantization table. The
+// estimate follows the scaling of the libjpeg reference encoder; streams
+// from other encoders get the closest equivalent quality.
+func JPEGQuality(r io.Reader) (int, error) {
+	br := bufio.NewReader(r)
+	var soi [2]byte
+	if _, err := io.ReadFull(br, soi[:]); err != nil {
+		return 0, err
+	}
+	if soi[0] != 0xff || soi[1] != 0xd8 {
+		return 0, errors.New("not a JPEG stream")
+	}
+	for {
+		marker, err := nextMarker(br)
+		if err != nil {
+			return 0, err
+		}
+		switch {
+		case marker == 0xd9 || marker == 0xda:
+			// End of image or start of scan: the tables come before.
+			return 0, errors.New("no luminance quantization table")
+		case marker == 0x01 || (marker >= 0xd0 && marker <= 0xd7):
+			// Markers without payload.
+			continue
+		}
+		var lenBuf [2]byte
+		if _, err := io.ReadFull(br, lenBuf[:]); err != nil {
+			return 0, err
+		}
+		n := int(binary.BigEndian.Uint16(lenBuf[:])) - 2
+		if n < 0 {
+			return 0, errors.New("invalid JPEG segment length")
+		}
+		segment := make([]byte, n)
+		if _, err := io.ReadFull(br, segment); err != nil {
+			return 0, err
+		}
+		if marker != 0xdb {
+			continue
+		}
+		if q, ok := luminanceQuality(segment); ok {
+			return q, nil
+		}
+	}
+}
+
+// nextMarker skips to the next marker and returns its code.
+func nextMarker(br *bufio.Reader) (byte, error) {
+	for {
+		b, err := br.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		if b != 0xff {
+			continue
+		}
+		for b == 0xff {
+			if b, err = br.ReadByte(); err != nil {
+				return 0, err
+			}
+		}
+		if b != 0 {
+			return b, nil
+		}
+	}
+}
+
+// luminanceQuality looks for table 0 in a DQT segment and converts its
+// scale relative to the standard table into a libjpeg quality.
+func luminanceQuality(segment []byte) (int, bool) {
+	for len(segment) > 0 {
+		precision, id := segment[0]>>4, segment[0]&0x0f
+		size := 64
+		if precision != 0 {
+			size = 128
+		}
+		if len(segment) < 1+size {
+			return 0, false
+		}
+		table := segment[1 : 1+size]
+		segment = segment[1+size:]
+		if id != 0 {
+			continue
+		}
+		// Encoders clamp 8 bits coefficients to 255 at low qualities, so
+		// clamped coefficients do not tell the scale.
+		sum, stdSum := 0, 0
+		for i := 0; i < 64; i++ {
+			v := int(table[i])
+			if precision != 0 {
+				v = int(table[2*i])<<8 | int(table[2*i+1])
+			} else if v == 255 {
+				continue
+			}
+			sum += v
+			stdSum += stdLuminance[zigzag[i]]
+		}
+		if stdSum == 0 {
+			return 1, true
+		}
+		scale := float64(sum) * 100 / float64(stdSum)
+		var quality float64
+		if scale <= 100 {
+			quality = (200 - scale) / 2
+		} else {
+			quality = 5000 / scale
+		}
+		q := int(quality + 0.5)
+		if q < 1 {
+			q = 1
+		} else if q > 100 {
+			q = 100
+		}
+		return q, true
+	}
+	return 0, false
+}
@@ -0,0 +1,327 @@
+// Copyright 2017 The goimagehash Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package distort
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"math"
+	"math/rand"
+
+	"github.com/nfnt/resize"
+)
+
+// Func transforms an image into a distorted copy. The input is never
+// modified.
+type Func func(img image.Image) (image.Image, error)
+
+// Distortion is a named, parameterized image transform.
+type Distortion struct {
+	Name  string
+	Apply Func
+}
+
+// Defaults function returns the registered distortions with typical
+// parameters, in a stable order.
+func Defaults() []Distortion {
+	return []Distortion{
+		{"jpeg-q75", JPEG(75)},
+		{"jpeg-q30", JPEG(30)},
+		{"scale-0.5", Scale(0.5)},
+		{"scale-2", Scale(2)},
+		{"crop-5%", Crop(0.05)},
+		{"crop-15%", Crop(0.15)},
+		{"rotate-2", Rotate(2)},
+		{"rotate-10", Rotate(10)},
+		{"brightness+0.1", Brightness(0.1)},
+		{"brightness-0.2", Brightness(-0.2)},
+		{"contrast-1.3", Contrast(1.3)},
+		{"contrast-0.7", Contrast(0.7)},
+		{"gamma-0.8", Gamma(0.8)},
+		{"gamma-1.5", Gamma(1.5)},
+		{"blur-1", Blur(1)},
+		{"blur-3", Blur(3)},
+		{"noise-0.02", Noise(0.02, 1)},
+		{"noise-0.08", Noise(0.08, 1)},
+		{"watermark", Watermark(0.1, 0.5)},
+		{"flip-h", FlipH()},
+		{"flip-v", FlipV()},
+	}
+}
+
+// Lookup function returns the default distortion with the given name.
+func Lookup(name string) (Distortion, error) {
+	for _, d := range Defaults() {
+		if d.Name == name {
+			return d, nil
+		}
+	}
+	return Distortion{}, fmt.Errorf("unknown distortion %q", name)
+}
+
+// toRGBA returns a copy of img as *image.RGBA with bounds starting at (0, 0).
+func toRGBA(img image.Image) *image.RGBA {
+	b := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Bounds(), img, b.Min, draw.Src)
+	return dst
+}
+
+// mapPixels applies f to every 8 bits color channel of img, keeping alpha.
+func mapPixels(img image.Image, f func(v float64) float64) image.Image {
+	dst := toRGBA(img)
+	var lut [256]uint8
+	for i := range lut {
+		lut[i] = clamp(f(float64(i)))
+	}
+	for i := 0; i < len(dst.Pix); i += 4 {
+		dst.Pix[i] = lut[dst.Pix[i]]
+		dst.Pix[i+1] = lut[dst.Pix[i+1]]
+		dst.Pix[i+2] = lut[dst.Pix[i+2]]
+	}
+	return dst
+}
+
+func clamp(v float64) uint8 {
+	if v <= 0 {
+		return 0
+	}
+	if v >= 255 {
+		return 255
+	}
+	return uint8(v + 0.5)
+}
+
+// JPEG function returns a distortion re-encoding the image as JPEG with the
+// given quality, from 1 to 100.
+func JPEG(quality int) Func {
+	return func(img image.Image) (image.Image, error) {
+		var b bytes.Buffer
+		if err := jpeg.Encode(&b, img, &jpeg.Options{Quality: quality}); err != nil {
+			return nil, err
+		}
+		return jpeg.Decode(&b)
+	}
+}
+
+// Scale function returns a distortion resizing the image by factor.
+func Scale(factor float64) Func {
+	return func(img image.Image) (image.Image, error) {
+		if factor <= 0 {
+			return nil, errors.New("scale factor should be positive")
+		}
+		b := img.Bounds()
+		w := uint(math.Max(1, math.Round(float64(b.Dx())*factor)))
+		h := uint(math.Max(1, math.Round(float64(b.Dy())*factor)))
+		return resize.Resize(w, h, img, resize.Bilinear), nil
+	}
+}
+
+// Crop function returns a distortion removing fraction of the width and of
+// the height, evenly from both sides.
+func Crop(fraction float64) Func {
+	return func(img image.Image) (image.Image, error) {
+		if fraction < 0 || fraction >= 1 {
+			return nil, errors.New("crop fraction should be in [0, 1)")
+		}
+		b := img.Bounds()
+		dx := int(float64(b.Dx()) * fraction / 2)
+		dy := int(float64(b.Dy()) * fraction / 2)
+		r := image.Rect(b.Min.X+dx, b.Min.Y+dy, b.Max.X-dx, b.Max.Y-dy)
+		dst := image.NewRGBA(image.Rect(0, 0, r.Dx(), r.Dy()))
+		draw.Draw(dst, dst.Bounds(), img, r.Min, draw.Src)
+		return dst, nil
+	}
+}
+
+// Rotate function returns a distortion rotating the image by degrees
+// counterclockwise around its center. The image keeps its size and uncovered
+// corners are black.
+func Rotate(degrees float64) Func {
+	return func(img image.Image) (image.Image, error) {
+		src := toRGBA(img)
+		w, h := src.Rect.Dx(), src.Rect.Dy()
+		dst := image.NewRGBA(src.Rect)
+		sin, cos := math.Sincos(degrees * math.Pi / 180)
+		cx, cy := float64(w)/2, float64(h)/2
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				// Map every destination pixel back into the source image.
+				fx, fy := float64(x)+0.5-cx, float64(y)+0.5-cy
+				sx := int(math.Floor(cos*fx - sin*fy + cx))
+				sy := int(math.Floor(sin*fx + cos*fy + cy))
+				if sx < 0 || sy < 0 || sx >= w || sy >= h {
+					dst.SetRGBA(x, y, color.RGBA{A: 0xff})
+					continue
+				}
+				dst.SetRGBA(x, y, src.RGBAAt(sx, sy))
+			}
+		}
+		return dst, nil
+	}
+}
+
+// Brightness function returns a distortion adding delta, from -1 to 1, to
+// every color channel.
+func Brightness(delta float64) Func {
+	return func(img image.Image) (image.Image, error) {
+		return mapPixels(img, func(v float64) float64 { return v + delta*255 }), nil
+	}
+}
+
+// Contrast function returns a distortion scaling the distance of every color
+// channel to mid gray by factor.
+func Contrast(factor float64) Func {
+	return func(img image.Image) (image.Image, error) {
+		return mapPixels(img, func(v float64) float64 { return (v-127.5)*factor + 127.5 }), nil
+	}
+}
+
+// Gamma function returns a distortion applying the gamma correction
+// v^(1/gamma) to every color channel.
+func Gamma(gamma float64) Func {
+	return func(img image.Image) (image.Image, error) {
+		if gamma <= 0 {
+			return nil, errors.New("gamma should be positive")
+		}
+		return mapPixels(img, func(v float64) float64 { return 255 * math.Pow(v/255, 1/gamma) }), nil
+	}
+}
+
+// Blur function returns a distortion applying a gaussian blur of standard
+// deviation sigma pixels.
+func Blur(sigma float64) Func {
+	return func(img image.Image) (image.Image, error) {
+		if sigma <= 0 {
+			return nil, errors.New("blur sigma should be positive")
+		}
+		radius := int(math.Ceil(3 * sigma))
+		kernel := make([]float64, 2*radius+1)
+		sum := 0.0
+		for i := range kernel {
+			d := float64(i - radius)
+			kernel[i] = math.Exp(-d * d / (2 * sigma * sigma))
+			sum += kernel[i]
+		}
+		for i := range kernel {
+			kernel[i] /= sum
+		}
+		return convolve(convolve(toRGBA(img), kernel, false), kernel, true), nil
+	}
+}
+
+// convolve applies kernel along the rows of src, or along its columns when
+// vertical is set. Edge pixels are repeated past the borders.
+func convolve(src *image.RGBA, kernel []float64, vertical bool) *image.RGBA {
+	dst := image.NewRGBA(src.Rect)
+	n, lines := src.Rect.Dx(), src.Rect.Dy()
+	step, lineStep := 4, src.Stride
+	if vertical {
+		n, lines = lines, n
+		step, lineStep = lineStep, step
+	}
+	radius := len(kernel) / 2
+	for line := 0; line < lines; line++ {
+		base := line * lineStep
+		for i := 0; i < n; i++ {
+			var acc [4]float64
+			for k, weight := range kernel {
+				j := i + k - radius
+				if j < 0 {
+					j = 0
+				} else if j >= n {
+					j = n - 1
+				}
+				off := base + j*step
+				for c := 0; c < 4; c++ {
+					acc[c] += weight * float64(src.Pix[off+c])
+				}
+			}
+			off := base + i*step
+			for c := 0; c < 4; c++ {
+				dst.Pix[off+c] = clamp(acc[c])
+			}
+		}
+	}
+	return dst
+}
+
+// Noise function returns a distortion adding gaussian noise of standard
+// deviation sigma, relative to the channel range, to every color channel.
+// The noise is deterministic for a given seed.
+func Noise(sigma float64, seed int64) Func {
+	return func(img image.Image) (image.Image, error) {
+		rng := rand.New(rand.NewSource(seed))
+		dst := toRGBA(img)
+		for i := 0; i < len(dst.Pix); i += 4 {
+			for c := 0; c < 3; c++ {
+				dst.Pix[i+c] = clamp(float64(dst.Pix[i+c]) + rng.NormFloat64()*sigma*255)
+			}
+		}
+		return dst, nil
+	}
+}
+
+// Watermark function returns a distortion blending a striped white box
+// covering fraction of the image area into its bottom right corner with the
+// given opacity.
+func Watermark(fraction, opacity float64) Func {
+	return func(img image.Image) (image.Image, error) {
+		if fraction <= 0 || fraction > 1 {
+			return nil, errors.New("watermark fraction should be in (0, 1]")
+		}
+		dst := toRGBA(img)
+		w, h := dst.Rect.Dx(), dst.Rect.Dy()
+		side := math.Sqrt(fraction)
+		bw, bh := int(float64(w)*side), int(float64(h)*side)
+		for y := h - bh; y < h; y++ {
+			for x := w - bw; x < w; x++ {
+				// Diagonal stripes make the mark textured like text.
+				if (x+y)/4%2 == 1 {
+					continue
+				}
+				off := dst.PixOffset(x, y)
+				for c := 0; c < 3; c++ {
+					v := float64(dst.Pix[off+c])
+					dst.Pix[off+c] = clamp(v*(1-opacity) + 255*opacity)
+				}
+			}
+		}
+		return dst, nil
+	}
+}
+
+// FlipH function returns a distortion mirroring the image horizontally.
+func FlipH() Func {
+	return func(img image.Image) (image.Image, error) {
+		src := toRGBA(img)
+		dst := image.NewRGBA(src.Rect)
+		w, h := src.Rect.Dx(), src.Rect.Dy()
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				dst.SetRGBA(w-1-x, y, src.RGBAAt(x, y))
+			}
+		}
+		return dst, nil
+	}
+}
+
+// FlipV function returns a distortion mirroring the image vertically.
+func FlipV() Func {
+	return func(img image.Image) (image.Image, error) {
+		src := toRGBA(img)
+		dst := image.NewRGBA(src.Rect)
+		h := src.Rect.Dy()
+		for y := 0; y < h; y++ {
+			copy(dst.Pix[(h-1-y)*dst.Stride:(h-y)*dst.Stride], src.Pix[y*src.Stride:(y+1)*src.Stride])
+		}
+		return dst, nil
+	}
+}
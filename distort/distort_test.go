@@ -0,0 +1,115 @@
+// Copyright 2017 The goimagehash Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package distort
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func gradient(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.SetRGBA(x, y, color.RGBA{uint8(x * 255 / w), uint8(y * 255 / h), 128, 255})
+		}
+	}
+	return img
+}
+
+func TestDistortionSizes(t *testing.T) {
+	src := gradient(40, 20)
+	for _, tt := range []struct {
+		name string
+		f    Func
+		w, h int
+	}{
+		{"jpeg", JPEG(50), 40, 20},
+		{"scale", Scale(0.5), 20, 10},
+		{"crop", Crop(0.5), 20, 10},
+		{"rotate", Rotate(30), 40, 20},
+		{"brightness", Brightness(0.2), 40, 20},
+		{"contrast", Contrast(1.5), 40, 20},
+		{"gamma", Gamma(2), 40, 20},
+		{"blur", Blur(2), 40, 20},
+		{"noise", Noise(0.1, 42), 40, 20},
+		{"watermark", Watermark(0.25, 0.5), 40, 20},
+		{"flip-h", FlipH(), 40, 20},
+		{"flip-v", FlipV(), 40, 20},
+	} {
+		before := append([]uint8(nil), src.Pix...)
+		out, err := tt.f(src)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if b := out.Bounds(); b.Dx() != tt.w || b.Dy() != tt.h {
+			t.Errorf("%s: expected %dx%d but got %dx%d", tt.name, tt.w, tt.h, b.Dx(), b.Dy())
+		}
+		for i := range before {
+			if before[i] != src.Pix[i] {
+				t.Errorf("%s: source image should not be modified", tt.name)
+				break
+			}
+		}
+	}
+}
+
+func TestDistortionPixels(t *testing.T) {
+	src := gradient(8, 4)
+	at := func(img image.Image, x, y int) color.RGBA {
+		return color.RGBAModel.Convert(img.At(x, y)).(color.RGBA)
+	}
+
+	flipped, _ := FlipH()(src)
+	if at(flipped, 0, 1) != src.RGBAAt(7, 1) {
+		t.Errorf("FlipH should mirror columns")
+	}
+	flipped, _ = FlipV()(src)
+	if at(flipped, 2, 0) != src.RGBAAt(2, 3) {
+		t.Errorf("FlipV should mirror rows")
+	}
+	rotated, _ := Rotate(0)(src)
+	if at(rotated, 3, 2) != src.RGBAAt(3, 2) {
+		t.Errorf("Rotate(0) should keep pixels")
+	}
+	brighter, _ := Brightness(1)(src)
+	if c := at(brighter, 0, 0); c.R != 255 || c.G != 255 || c.B != 255 || c.A != 255 {
+		t.Errorf("Brightness(1) should saturate to white, got %v", c)
+	}
+	gray, _ := Contrast(0)(src)
+	if c := at(gray, 5, 3); c.R != 128 || c.G != 128 {
+		t.Errorf("Contrast(0) should give mid gray, got %v", c)
+	}
+
+	n1, _ := Noise(0.1, 7)(src)
+	n2, _ := Noise(0.1, 7)(src)
+	if at(n1, 4, 2) != at(n2, 4, 2) {
+		t.Errorf("Noise should be deterministic for a seed")
+	}
+
+	for _, f := range []Func{Scale(0), Crop(1), Gamma(0), Blur(0), Watermark(0, 1)} {
+		if _, err := f(src); err == nil {
+			t.Errorf("Should got error for invalid parameters")
+		}
+	}
+}
+
+func TestLookup(t *testing.T) {
+	seen := make(map[string]bool)
+	for _, d := range Defaults() {
+		if seen[d.Name] {
+			t.Errorf("Duplicate distortion %s", d.Name)
+		}
+		seen[d.Name] = true
+		if found, err := Lookup(d.Name); err != nil || found.Name != d.Name {
+			t.Errorf("Lookup(%q) failed: %v", d.Name, err)
+		}
+	}
+	if _, err := Lookup("melt"); err == nil {
+		t.Errorf("Should got error for unknown distortion")
+	}
+}
@@ -0,0 +1,8 @@
+// Copyright 2017 The goimagehash Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package distort applies parameterized distortions to images, such as JPEG
+// re-compression, scaling, cropping, rotation, color changes, blur, noise,
+// watermarks and flips, and measures how robust hash algorithms are to them.
+package distort
@@ -0,0 +1,108 @@
+// Copyright 2017 The goimagehash Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package distort
+
+import (
+	"fmt"
+	"image"
+	"sort"
+
+	"github.com/lollipopkit/goimagehash"
+)
+
+// Stats summarizes the distances between the hashes of original images and
+// of their distorted copies, for one distortion and one algorithm.
+type Stats struct {
+	Distortion string  `json:"distortion"`
+	Algorithm  string  `json:"algorithm"`
+	Bits       int     `json:"bits"`
+	Count      int     `json:"count"`
+	Min        int     `json:"min"`
+	Max        int     `json:"max"`
+	Mean       float64 `json:"mean"`
+	Median     float64 `json:"median"`
+	P90        float64 `json:"p90"`
+	// Similar is the fraction of distorted copies whose distance is within
+	// goimagehash.RecommendedThreshold.
+	Similar float64 `json:"similar"`
+}
+
+// Evaluate function hashes every image and every distorted copy of it with
+// every algorithm, and returns the distance statistics ordered by
+// distortion, then by algorithm.
+func Evaluate(images []image.Image, algorithms []goimagehash.Algorithm, distortions []Distortion) ([]Stats, error) {
+	originals := make([][]*goimagehash.ExtImageHash, len(images))
+	for i, img := range images {
+		originals[i] = make([]*goimagehash.ExtImageHash, len(algorithms))
+		for j, a := range algorithms {
+			h, err := a.Hash(img)
+			if err != nil {
+				return nil, fmt.Errorf("%v: %v", a, err)
+			}
+			originals[i][j] = h
+		}
+	}
+
+	var stats []Stats
+	for _, d := range distortions {
+		distances := make([][]int, len(algorithms))
+		for i, img := range images {
+			distorted, err := d.Apply(img)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", d.Name, err)
+			}
+			for j, a := range algorithms {
+				h, err := a.Hash(distorted)
+				if err != nil {
+					return nil, fmt.Errorf("%v: %v", a, err)
+				}
+				distance, err := originals[i][j].Distance(h)
+				if err != nil {
+					return nil, err
+				}
+				distances[j] = append(distances[j], distance)
+			}
+		}
+		for j, a := range algorithms {
+			s := summarize(distances[j], a.Bits(), goimagehash.RecommendedThreshold(a.Kind, a.Bits()))
+			s.Distortion, s.Algorithm = d.Name, a.String()
+			stats = append(stats, s)
+		}
+	}
+	return stats, nil
+}
+
+func summarize(distances []int, bits, threshold int) Stats {
+	s := Stats{Bits: bits, Count: len(distances)}
+	if len(distances) == 0 {
+		return s
+	}
+	sorted := append([]int(nil), distances...)
+	sort.Ints(sorted)
+	s.Min, s.Max = sorted[0], sorted[len(sorted)-1]
+	total, similar := 0, 0
+	for _, d := range sorted {
+		total += d
+		if d <= threshold {
+			similar++
+		}
+	}
+	s.Mean = float64(total) / float64(len(sorted))
+	s.Median = percentile(sorted, 0.5)
+	s.P90 = percentile(sorted, 0.9)
+	s.Similar = float64(similar) / float64(len(sorted))
+	return s
+}
+
+// percentile returns the p-th percentile of sorted with linear interpolation.
+func percentile(sorted []int, p float64) float64 {
+	pos := p * float64(len(sorted)-1)
+	lo := int(pos)
+	if lo+1 >= len(sorted) {
+		return float64(sorted[lo])
+	}
+	frac := pos - float64(lo)
+	return float64(sorted[lo])*(1-frac) + float64(sorted[lo+1])*frac
+}
@@ -0,0 +1,85 @@
+// Copyright 2017 The goimagehash Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package distort
+
+import (
+	"image"
+	_ "image/jpeg"
+	"os"
+	"testing"
+
+	"github.com/lollipopkit/goimagehash"
+)
+
+func loadSamples(t *testing.T) []image.Image {
+	var images []image.Image
+	for _, name := range []string{"sample1.jpg", "sample2.jpg", "sample3.jpg", "sample4.jpg"} {
+		file, err := os.Open("../_examples/" + name)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		img, _, err := image.Decode(file)
+		file.Close()
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		images = append(images, img)
+	}
+	return images
+}
+
+func TestEvaluateRobustness(t *testing.T) {
+	images := loadSamples(t)
+	var distortions []Distortion
+	for _, name := range []string{"jpeg-q75", "scale-0.5", "brightness+0.1", "blur-1", "flip-h"} {
+		d, err := Lookup(name)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		distortions = append(distortions, d)
+	}
+	algorithms := []goimagehash.Algorithm{
+		{Kind: goimagehash.AHash},
+		{Kind: goimagehash.PHash},
+		{Kind: goimagehash.DHash},
+	}
+
+	stats, err := Evaluate(images, algorithms, distortions)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if len(stats) != len(distortions)*len(algorithms) {
+		t.Fatalf("Expected %d stats but got %d", len(distortions)*len(algorithms), len(stats))
+	}
+	for _, s := range stats {
+		if s.Count != len(images) || s.Min > s.Max || s.Median < float64(s.Min) || s.P90 > float64(s.Max) {
+			t.Errorf("Inconsistent stats %+v", s)
+		}
+		if s.Distortion == "flip-h" {
+			// Mirroring is not a near-duplicate edit for any of the algorithms.
+			if s.Similar == 1 {
+				t.Errorf("%s: flip-h should not keep every image similar, got %+v", s.Algorithm, s)
+			}
+			continue
+		}
+		// Mild edits must stay within the recommended threshold.
+		if s.Similar != 1 {
+			t.Errorf("%s: %s should keep every image similar, got %+v", s.Algorithm, s.Distortion, s)
+		}
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	s := summarize([]int{4, 0, 10, 2}, 64, 3)
+	if s.Count != 4 || s.Min != 0 || s.Max != 10 || s.Mean != 4 || s.Median != 3 || s.Similar != 0.5 {
+		t.Errorf("Unexpected stats %+v", s)
+	}
+	if p := percentile([]int{0, 10}, 0.9); p != 9 {
+		t.Errorf("Expected percentile 9 but got %v", p)
+	}
+	if s := summarize(nil, 64, 3); s.Count != 0 {
+		t.Errorf("Unexpected stats %+v", s)
+	}
+}
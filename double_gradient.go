@@ -2,19 +2,24 @@ package goimagehash
 
 import (
 	"encoding/base64"
+	"errors"
 	"image"
 
 	"github.com/nfnt/resize"
 )
 
 // DoubleGradientHash implements the DoubleGradient algorithm similar to the Rust img_hash library
-// DoubleGradient resizes the grayscaled image to (width/2 + 1) x (height/2 + 1) and compares 
+// DoubleGradient resizes the grayscaled image to (width/2 + 1) x (height/2 + 1) and compares
 // columns in addition to rows, combining both horizontal and vertical gradient comparisons.
 func DoubleGradientHash(img image.Image, width, height int) (*ExtImageHash, error) {
+	if img == nil {
+		return nil, errors.New("image object can not be nil")
+	}
+
 	// Round dimensions to next multiple of 2 (required by DoubleGradient)
 	width = int(nextMultipleOf2(uint(width)))
 	height = int(nextMultipleOf2(uint(height)))
-	
+
 	// Calculate resize dimensions: (width/2 + 1) x (height/2 + 1)
 	resizeWidth := width/2 + 1
 	resizeHeight := height/2 + 1
@@ -44,12 +49,12 @@ func DoubleGradientHash(img image.Image, width, height int) (*ExtImageHash, erro
 
 	// Compute hash bits using DoubleGradient algorithm
 	hashBits := doubleGradientHashBits(pixels, resizeWidth, resizeHeight)
-	
+
 	// Convert bits to ExtImageHash
 	hashBytes := bitsToBytes(hashBits)
 	totalBits := len(hashBits)
-	
-	return NewExtImageHash(hashBytes, DGHash, totalBits), nil
+
+	return NewExtImageHashWithSize(hashBytes, DGHash, totalBits, width, height), nil
 }
 
 // nextMultipleOf2 rounds up to the next multiple of 2
@@ -77,7 +82,7 @@ func doubleGradientHashBits(pixels []uint8, width, height int) []bool {
 		}
 	}
 
-	// Vertical gradient comparisons (like VertGradient algorithm)  
+	// Vertical gradient comparisons (like VertGradient algorithm)
 	for x := 0; x < width; x++ {
 		for y := 1; y < height; y++ {
 			current := pixels[y*rowstride+x]
@@ -89,54 +94,30 @@ func doubleGradientHashBits(pixels []uint8, width, height int) []bool {
 	return hashBits
 }
 
-// bitsToBytes converts boolean bits to bytes (LSB first - matching Rust library)
+// bitsToBytes packs boolean bits into words, MSB first like every other kind.
 func bitsToBytes(bits []bool) []uint64 {
-	var result []uint64
-	var currentWord uint64
-	var bitPos uint
-
-	for _, bit := range bits {
+	result := make([]uint64, wordsFor(len(bits)))
+	for idx, bit := range bits {
 		if bit {
-			currentWord |= 1 << bitPos
+			result[idx/64] |= 1 << uint(63-idx%64)
 		}
-		bitPos++
-		
-		if bitPos >= 64 {
-			result = append(result, currentWord)
-			currentWord = 0
-			bitPos = 0
-		}
-	}
-	
-	if bitPos > 0 {
-		result = append(result, currentWord)
 	}
-	
 	return result
 }
 
-// ToBase64 converts ExtImageHash to base64 string without padding (like Rust library)
+// ToBase64 converts ExtImageHash to base64 string without padding (like Rust library).
+// Bits are packed in LSBFirst order as img_hash does.
 func (h *ExtImageHash) ToBase64() string {
-	// Convert hash to bytes using existing serialization
-	hashBytes := make([]byte, 0)
-	for _, hashWord := range h.hash {
-		for i := uint(0); i < 8; i++ {
-			hashBytes = append(hashBytes, byte(hashWord>> (i*8) & 0xFF))
-		}
-	}
-	
-	// Only keep the actual bits needed, not the full bytes
-	if h.bits < len(hashBytes)*8 {
-		fullBytes := h.bits / 8
-		if h.bits%8 != 0 {
-			fullBytes++
-		}
-		hashBytes = hashBytes[:fullBytes]
+	return base64.RawStdEncoding.EncodeToString(h.EncodeBytes(LSBFirst))
+}
+
+// ExtImageHashFromBase64 function parses a string returned by ToBase64.
+func ExtImageHashFromBase64(s string, kind Kind, bits int) (*ExtImageHash, error) {
+	b, err := base64.RawStdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
 	}
-	
-	// Encode without padding
-	encoded := base64.RawStdEncoding.EncodeToString(hashBytes)
-	return encoded
+	return DecodeExtImageHash(b, LSBFirst, kind, bits)
 }
 
 // DoubleGradientHashToBase64 is a convenience function that computes DoubleGradient hash
@@ -147,4 +128,4 @@ func DoubleGradientHashToBase64(img image.Image, width, height int) (string, err
 		return "", err
 	}
 	return hash.ToBase64(), nil
-}
\ No newline at end of file
+}
@@ -0,0 +1,304 @@
+// Copyright 2017 The goimagehash Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package goimagehash
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Canonical string encoding
+//
+// ImageHash is encoded as "<code>:<16 hex digits>", e.g. "p:e48ae53c05e502f7".
+//
+// ExtImageHash is encoded as "<code>:<hex>" where hex holds the
+// (Bits()+7)/8 bytes returned by Bytes, so bits are in MSBFirst order. When
+// Bits() is not a multiple of 8 the bit size is written explicitly as
+// "<code>:<bits>:<hex>".
+//
+// code is the one letter Kind.Code of the hash, see ParseKind.
+//
+// MarshalText adds the width and height parameters of an ExtImageHash when
+// they are known, along with the bit size:
+// "<code>:<width>x<height>:<bits>:<hex>", e.g. "p:16x8:128:<32 hex digits>".
+
+// String method returns the canonical string encoding of the hash.
+func (h *ImageHash) String() string {
+	return fmt.Sprintf("%s:%016x", h.kind.Code(), h.hash)
+}
+
+// ParseImageHash function parses the canonical string encoding of an
+// ImageHash.
+func ParseImageHash(s string) (*ImageHash, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 2 || len(parts[1]) == 0 || len(parts[1]) > 16 {
+		return nil, fmt.Errorf("couldn't parse image hash %q", s)
+	}
+	kind, err := ParseKind(parts[0])
+	if err != nil {
+		return nil, err
+	}
+	hash, err := strconv.ParseUint(parts[1], 16, 64)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't parse image hash %q: %v", s, err)
+	}
+	return NewImageHash(hash, kind), nil
+}
+
+// String method returns the canonical string encoding of the hash.
+func (h *ExtImageHash) String() string {
+	hexStr := hex.EncodeToString(h.Bytes())
+	if h.bits%8 != 0 {
+		return fmt.Sprintf("%s:%d:%s", h.kind.Code(), h.bits, hexStr)
+	}
+	return fmt.Sprintf("%s:%s", h.kind.Code(), hexStr)
+}
+
+// ParseExtImageHash function parses the canonical string encoding of an
+// ExtImageHash, or the one of MarshalText holding its width and height.
+func ParseExtImageHash(s string) (*ExtImageHash, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) < 2 || len(parts) > 4 {
+		return nil, fmt.Errorf("couldn't parse extended image hash %q", s)
+	}
+	kind, err := ParseKind(parts[0])
+	if err != nil {
+		return nil, err
+	}
+	var width, height int
+	if len(parts) == 4 {
+		if n, err := fmt.Sscanf(parts[1], "%dx%d", &width, &height); err != nil || n != 2 || width <= 0 || height <= 0 ||
+			parts[1] != fmt.Sprintf("%dx%d", width, height) {
+			return nil, fmt.Errorf("couldn't parse width and height of %q", s)
+		}
+		parts = append(parts[:1], parts[2:]...)
+	}
+	hexStr := parts[len(parts)-1]
+	b, err := hex.DecodeString(hexStr)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't parse extended image hash %q: %v", s, err)
+	}
+	bits := len(b) * 8
+	if len(parts) == 3 {
+		bits, err = strconv.Atoi(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("couldn't parse bit size of %q: %v", s, err)
+		}
+	}
+	h, err := ExtImageHashFromBytes(b, kind, bits)
+	if err != nil {
+		return nil, err
+	}
+	h.width, h.height = width, height
+	return h, nil
+}
+
+// MarshalText method implements encoding.TextMarshaler with the canonical
+// string encoding. It has a value receiver so ImageHash can be used as a
+// map key with encoding/json.
+func (h ImageHash) MarshalText() ([]byte, error) {
+	return []byte(h.String()), nil
+}
+
+// UnmarshalText method implements encoding.TextUnmarshaler.
+func (h *ImageHash) UnmarshalText(text []byte) error {
+	parsed, err := ParseImageHash(string(text))
+	if err != nil {
+		return err
+	}
+	*h = *parsed
+	return nil
+}
+
+// Set method implements flag.Value.
+func (h *ImageHash) Set(s string) error {
+	return h.UnmarshalText([]byte(s))
+}
+
+// MarshalText method implements encoding.TextMarshaler with the canonical
+// string encoding, to which the width and height parameters are added when
+// they are known.
+func (h *ExtImageHash) MarshalText() ([]byte, error) {
+	if h.width <= 0 || h.height <= 0 {
+		return []byte(h.String()), nil
+	}
+	return []byte(fmt.Sprintf("%s:%dx%d:%d:%s", h.kind.Code(), h.width, h.height, h.bits, hex.EncodeToString(h.Bytes()))), nil
+}
+
+// UnmarshalText method implements encoding.TextUnmarshaler.
+func (h *ExtImageHash) UnmarshalText(text []byte) error {
+	parsed, err := ParseExtImageHash(string(text))
+	if err != nil {
+		return err
+	}
+	*h = *parsed
+	return nil
+}
+
+// Set method implements flag.Value.
+func (h *ExtImageHash) Set(s string) error {
+	return h.UnmarshalText([]byte(s))
+}
+
+// Binary encoding
+//
+// A hash is encoded as a version byte, a kind byte, the bit size, width and
+// height as uvarints and the (bits+7)/8 bytes returned by Bytes. ImageHash
+// is encoded with 64 bits and a zero width and height.
+
+const binaryVersion = 1
+
+func appendBinary(dst []byte, kind Kind, bits, width, height int, hash []byte) []byte {
+	dst = append(dst, binaryVersion, byte(kind))
+	dst = binary.AppendUvarint(dst, uint64(bits))
+	dst = binary.AppendUvarint(dst, uint64(width))
+	dst = binary.AppendUvarint(dst, uint64(height))
+	return append(dst, hash...)
+}
+
+func parseBinary(data []byte) (*ExtImageHash, error) {
+	if len(data) < 2 {
+		return nil, errors.New("binary image hash is too short")
+	}
+	if data[0] != binaryVersion {
+		return nil, fmt.Errorf("unsupported binary image hash version %d", data[0])
+	}
+	kind := Kind(data[1])
+	if !kind.valid() {
+		return nil, fmt.Errorf("invalid binary image hash kind %d", data[1])
+	}
+	data = data[2:]
+	var params [3]int
+	for i := range params {
+		v, n := binary.Uvarint(data)
+		if n <= 0 || v > 1<<24 {
+			return nil, errors.New("invalid binary image hash header")
+		}
+		params[i] = int(v)
+		data = data[n:]
+	}
+	h, err := DecodeExtImageHash(data, MSBFirst, kind, params[0])
+	if err != nil {
+		return nil, err
+	}
+	h.width, h.height = params[1], params[2]
+	return h, nil
+}
+
+// MarshalBinary method implements encoding.BinaryMarshaler.
+func (h *ImageHash) MarshalBinary() ([]byte, error) {
+	return appendBinary(nil, h.kind, 64, 0, 0, h.Bytes()), nil
+}
+
+// UnmarshalBinary method implements encoding.BinaryUnmarshaler.
+func (h *ImageHash) UnmarshalBinary(data []byte) error {
+	parsed, err := parseBinary(data)
+	if err != nil {
+		return err
+	}
+	if parsed.bits != 64 {
+		return fmt.Errorf("image hash should have 64 bits but got %d", parsed.bits)
+	}
+	*h = ImageHash{hash: parsed.hash[0], kind: parsed.kind}
+	return nil
+}
+
+// MarshalBinary method implements encoding.BinaryMarshaler.
+func (h *ExtImageHash) MarshalBinary() ([]byte, error) {
+	return appendBinary(nil, h.kind, h.bits, h.width, h.height, h.Bytes()), nil
+}
+
+// UnmarshalBinary method implements encoding.BinaryUnmarshaler.
+func (h *ExtImageHash) UnmarshalBinary(data []byte) error {
+	parsed, err := parseBinary(data)
+	if err != nil {
+		return err
+	}
+	*h = *parsed
+	return nil
+}
+
+// jsonHash is the JSON representation of both hash types.
+type jsonHash struct {
+	Kind   string `json:"kind"`
+	Bits   int    `json:"bits"`
+	Width  int    `json:"width,omitempty"`
+	Height int    `json:"height,omitempty"`
+	Hash   string `json:"hash"`
+}
+
+func unmarshalJSONHash(data []byte) (*ExtImageHash, error) {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		return ParseExtImageHash(s)
+	}
+	var j jsonHash
+	if err := json.Unmarshal(data, &j); err != nil {
+		return nil, err
+	}
+	kind, err := ParseKind(j.Kind)
+	if err != nil {
+		return nil, err
+	}
+	b, err := hex.DecodeString(j.Hash)
+	if err != nil {
+		return nil, err
+	}
+	h, err := ExtImageHashFromBytes(b, kind, j.Bits)
+	if err != nil {
+		return nil, err
+	}
+	h.width, h.height = j.Width, j.Height
+	return h, nil
+}
+
+// MarshalJSON method implements json.Marshaler. The hash is encoded as an
+// object holding the kind code, the bit size and the hex encoded Bytes.
+func (h ImageHash) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonHash{Kind: h.kind.Code(), Bits: 64, Hash: hex.EncodeToString(h.Bytes())})
+}
+
+// UnmarshalJSON method implements json.Unmarshaler. Both the object
+// returned by MarshalJSON and a canonical string are accepted.
+func (h *ImageHash) UnmarshalJSON(data []byte) error {
+	parsed, err := unmarshalJSONHash(data)
+	if err != nil {
+		return err
+	}
+	if parsed.bits != 64 {
+		return fmt.Errorf("image hash should have 64 bits but got %d", parsed.bits)
+	}
+	*h = ImageHash{hash: parsed.hash[0], kind: parsed.kind}
+	return nil
+}
+
+// MarshalJSON method implements json.Marshaler. The hash is encoded as an
+// object holding the kind code, the bit size, the width and height
+// parameters when known and the hex encoded Bytes.
+func (h *ExtImageHash) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonHash{
+		Kind:   h.kind.Code(),
+		Bits:   h.bits,
+		Width:  h.width,
+		Height: h.height,
+		Hash:   hex.EncodeToString(h.Bytes()),
+	})
+}
+
+// UnmarshalJSON method implements json.Unmarshaler. Both the object
+// returned by MarshalJSON and a canonical string are accepted.
+func (h *ExtImageHash) UnmarshalJSON(data []byte) error {
+	parsed, err := unmarshalJSONHash(data)
+	if err != nil {
+		return err
+	}
+	*h = *parsed
+	return nil
+}
@@ -0,0 +1,298 @@
+// Copyright 2017 The goimagehash Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package goimagehash
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"flag"
+	"image"
+	"os"
+	"testing"
+)
+
+func TestKindCodes(t *testing.T) {
+	codes := make(map[string]Kind)
+	for k := Kind(0); k.valid(); k++ {
+		code := k.Code()
+		if len(code) != 1 {
+			t.Errorf("Kind %d should have a one letter code but got %q", k, code)
+		}
+		if other, ok := codes[code]; ok {
+			t.Errorf("Kinds %v and %v share the code %q", k, other, code)
+		}
+		codes[code] = k
+
+		for _, s := range []string{k.Code(), k.String()} {
+			parsed, err := ParseKind(s)
+			if err != nil || parsed != k {
+				t.Errorf("ParseKind(%q) returned %v, %v", s, parsed, err)
+			}
+		}
+	}
+	if _, err := ParseKind("x"); err == nil {
+		t.Errorf("Should got error for unknown kind")
+	}
+}
+
+func TestStringRoundTrip(t *testing.T) {
+	for k := Kind(0); k.valid(); k++ {
+		hash := NewImageHash(0xe48ae53c05e502f7, k)
+		reHash, err := ParseImageHash(hash.String())
+		if err != nil {
+			t.Errorf("%v", err)
+			continue
+		}
+		if reHash.GetHash() != hash.GetHash() || reHash.GetKind() != k {
+			t.Errorf("Expected %v but got %v", hash, reHash)
+		}
+
+		for _, bits := range []int{1, 40, 64, 100, 162, 256, 289} {
+			ext := NewExtImageHash(make([]uint64, wordsFor(bits)), k, bits)
+			for i := 0; i < bits; i += 3 {
+				ext.SetBit(i, true)
+			}
+			s := ext.String()
+			reExt, err := ParseExtImageHash(s)
+			if err != nil {
+				t.Errorf("%v", err)
+				continue
+			}
+			if reExt.String() != s || reExt.GetKind() != k || reExt.Bits() != bits {
+				t.Errorf("Expected %v but got %v", s, reExt)
+			}
+			if distance, err := ext.Distance(reExt); err != nil || distance != 0 {
+				t.Errorf("Original and parsed hashes should be identical, got distance=%v, err=%v", distance, err)
+			}
+		}
+	}
+
+	for _, s := range []string{"", "p", "x:00", "p:zz", "p:12:00", "p:0:", "p:00:00:00", "a:4:ff"} {
+		if _, err := ParseExtImageHash(s); err == nil {
+			t.Errorf("Should got error for %q", s)
+		}
+	}
+}
+
+func TestDoubleGradientStringRoundTrip(t *testing.T) {
+	file, err := os.Open("_examples/sample2.jpg")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer file.Close()
+	img, _, err := image.Decode(file)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	for _, size := range []int{8, 9, 16} {
+		hash, err := DoubleGradientHash(img, size, size)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		s := hash.ToString()
+		if s[0] != 'g' {
+			t.Errorf("DoubleGradient hash should be encoded with kind g, got %q", s)
+		}
+		reHash, err := ExtImageHashFromString(s)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		if distance, err := hash.Distance(reHash); err != nil || distance != 0 {
+			t.Errorf("Original and parsed hashes should be identical, got distance=%v, err=%v", distance, err)
+		}
+
+		reHash, err = ExtImageHashFromBase64(hash.ToBase64(), DGHash, hash.Bits())
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		if distance, err := hash.Distance(reHash); err != nil || distance != 0 {
+			t.Errorf("Base64 round trip failed, got distance=%v, err=%v", distance, err)
+		}
+	}
+}
+
+func TestToBase64BitOrder(t *testing.T) {
+	hash := NewExtImageHash(make([]uint64, 1), DGHash, 10)
+	hash.SetBit(0, true)
+	hash.SetBit(9, true)
+	// LSBFirst packing gives the bytes 0x01 0x02.
+	if s := hash.ToBase64(); s != "AQI" {
+		t.Errorf("Expected AQI but got %s", s)
+	}
+	if b := hash.Bytes(); b[0] != 0x80 || b[1] != 0x40 {
+		t.Errorf("Expected MSBFirst bytes 80 40 but got %x", b)
+	}
+}
+
+func TestMarshalers(t *testing.T) {
+	file, err := os.Open("_examples/sample3.jpg")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer file.Close()
+	img, _, err := image.Decode(file)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	phash, _ := PerceptionHash(img)
+	extPhash, _ := ExtPerceptionHash(img, 16, 16)
+	dg, _ := DoubleGradientHash(img, 8, 8)
+
+	type record struct {
+		Hash    ImageHash            `json:"hash" xml:"hash"`
+		Ext     *ExtImageHash        `json:"ext" xml:"ext,attr"`
+		ByHash  map[ImageHash]string `json:"by_hash" xml:"-"`
+		ExtList []*ExtImageHash      `json:"ext_list" xml:"-"`
+	}
+	in := record{
+		Hash:    *phash,
+		Ext:     extPhash,
+		ByHash:  map[ImageHash]string{*phash: "sample3"},
+		ExtList: []*ExtImageHash{dg},
+	}
+
+	data, err := json.Marshal(in)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	var out record
+	if err := json.Unmarshal(data, &out); err != nil {
+		t.Fatalf("%v: %s", err, data)
+	}
+	if out.Hash != *phash || out.ByHash[*phash] != "sample3" {
+		t.Errorf("JSON round trip of ImageHash failed: %s", data)
+	}
+	if d, err := out.Ext.Distance(extPhash); err != nil || d != 0 {
+		t.Errorf("JSON round trip of ExtImageHash failed: %s", data)
+	}
+	if w, h := out.Ext.Size(); w != 16 || h != 16 {
+		t.Errorf("JSON should keep width and height, got %dx%d", w, h)
+	}
+	if d, err := out.ExtList[0].Distance(dg); err != nil || d != 0 {
+		t.Errorf("JSON round trip of DoubleGradient hash failed: %s", data)
+	}
+
+	var fromString ExtImageHash
+	if err := json.Unmarshal([]byte(`"`+dg.String()+`"`), &fromString); err != nil {
+		t.Errorf("UnmarshalJSON should accept canonical strings: %v", err)
+	}
+	var tooBig ImageHash
+	if err := json.Unmarshal([]byte(`"`+extPhash.String()+`"`), &tooBig); err == nil {
+		t.Errorf("Should got error when unmarshaling 256 bits into ImageHash")
+	}
+
+	xmlData, err := xml.Marshal(in)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	var xmlOut record
+	if err := xml.Unmarshal(xmlData, &xmlOut); err != nil {
+		t.Fatalf("%v: %s", err, xmlData)
+	}
+	if xmlOut.Hash != *phash {
+		t.Errorf("XML round trip failed: %s", xmlData)
+	}
+	if d, err := xmlOut.Ext.Distance(extPhash); err != nil || d != 0 {
+		t.Errorf("XML round trip of ExtImageHash failed: %s", xmlData)
+	}
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	var flagHash ImageHash
+	fs.Var(&flagHash, "hash", "hash")
+	if err := fs.Parse([]string{"-hash", phash.String()}); err != nil {
+		t.Fatalf("%v", err)
+	}
+	if flagHash != *phash {
+		t.Errorf("flag.Value round trip failed, got %v", flagHash)
+	}
+}
+
+func TestTextNonSquare(t *testing.T) {
+	file, err := os.Open("_examples/sample3.jpg")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer file.Close()
+	img, _, err := image.Decode(file)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	for _, a := range []Algorithm{{PHash, 16, 8}, {DGHash, 12, 6}, {DHash, 8, 8}} {
+		hash, err := a.Hash(img)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		text, err := hash.MarshalText()
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		var reHash ExtImageHash
+		if err := reHash.UnmarshalText(text); err != nil {
+			t.Errorf("%s: %v", text, err)
+			continue
+		}
+		if d, err := reHash.Distance(hash); err != nil || d != 0 || reHash.Bits() != hash.Bits() {
+			t.Errorf("Text round trip of %v failed: %s", a, text)
+		}
+		if w, h := reHash.Size(); w != a.Width || h != a.Height {
+			t.Errorf("Text round trip of %v should keep width and height, got %dx%d", a, w, h)
+		}
+	}
+
+	// Without a width and height, the text is the canonical string.
+	hash := NewExtImageHash([]uint64{0xe48ae53c05e502f7}, PHash, 64)
+	if text, _ := hash.MarshalText(); string(text) != hash.String() {
+		t.Errorf("Expected %s but got %s", hash, text)
+	}
+	for _, s := range []string{"p:16x:64:e48ae53c05e502f7", "p:0x8:64:e48ae53c05e502f7", "p:8x8:e48ae53c05e502f7", "p:+8x8:64:e48ae53c05e502f7"} {
+		if _, err := ParseExtImageHash(s); err == nil {
+			t.Errorf("Should got error for %q", s)
+		}
+	}
+}
+
+func TestBinaryMarshalers(t *testing.T) {
+	hash := NewImageHash(0xe48ae53c05e502f7, DHash)
+	data, err := hash.MarshalBinary()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	var reHash ImageHash
+	if err := reHash.UnmarshalBinary(data); err != nil {
+		t.Fatalf("%v", err)
+	}
+	if reHash != *hash {
+		t.Errorf("Expected %v but got %v", hash, reHash)
+	}
+
+	ext := NewExtImageHashWithSize(make([]uint64, 3), DGHash, 162, 16, 16)
+	ext.SetBit(0, true)
+	ext.SetBit(161, true)
+	data, err = ext.MarshalBinary()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	var reExt ExtImageHash
+	if err := reExt.UnmarshalBinary(data); err != nil {
+		t.Fatalf("%v", err)
+	}
+	if reExt.String() != ext.String() {
+		t.Errorf("Expected %v but got %v", ext, &reExt)
+	}
+	if w, h := reExt.Size(); w != 16 || h != 16 {
+		t.Errorf("Binary encoding should keep width and height, got %dx%d", w, h)
+	}
+	if err := reHash.UnmarshalBinary(data); err == nil {
+		t.Errorf("Should got error when unmarshaling 162 bits into ImageHash")
+	}
+
+	for _, bad := range [][]byte{nil, {binaryVersion}, {9, 1, 64, 0, 0}, {binaryVersion, 200, 8, 0, 0, 0}, data[:len(data)-1]} {
+		if err := reExt.UnmarshalBinary(bad); err == nil {
+			t.Errorf("Should got error for %v", bad)
+		}
+	}
+}
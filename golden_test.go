@@ -0,0 +1,197 @@
+// Copyright 2017 The goimagehash Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package goimagehash
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"os"
+	"strings"
+	"testing"
+)
+
+// The golden suite pins the exact hash of every algorithm and size on the
+// sample and synthetic images, so any change of the resize filter, the gray
+// conversion or the DCT shows up as a failing bit. When an algorithm is
+// changed on purpose, regenerate the fixture with
+//
+//	go test -run TestGoldenHashes -update-golden
+//
+// and review the diff of testdata/golden.txt.
+var updateGolden = flag.Bool("update-golden", false, "rewrite testdata/golden.txt with the computed hashes")
+
+const goldenFile = "testdata/golden.txt"
+
+type goldenHasher struct {
+	name string
+	hash func(img image.Image) (string, error)
+}
+
+func goldenHashers() []goldenHasher {
+	hashers := []goldenHasher{
+		{"AverageHash", stdGolden(AverageHash)},
+		{"DifferenceHash", stdGolden(DifferenceHash)},
+		{"PerceptionHash", stdGolden(PerceptionHash)},
+	}
+	for _, a := range []Algorithm{
+		{AHash, 8, 8}, {AHash, 16, 16}, {AHash, 16, 8},
+		{DHash, 8, 8}, {DHash, 16, 16}, {DHash, 16, 8},
+		{PHash, 8, 8}, {PHash, 16, 16}, {PHash, 32, 32},
+		{DGHash, 8, 8}, {DGHash, 16, 16}, {DGHash, 12, 6},
+	} {
+		a := a
+		hashers = append(hashers, goldenHasher{a.String(), func(img image.Image) (string, error) {
+			h, err := a.Hash(img)
+			if err != nil {
+				return "", err
+			}
+			return h.String(), nil
+		}})
+	}
+	return hashers
+}
+
+func stdGolden(f func(image.Image) (*ImageHash, error)) func(image.Image) (string, error) {
+	return func(img image.Image) (string, error) {
+		h, err := f(img)
+		if err != nil {
+			return "", err
+		}
+		return h.String(), nil
+	}
+}
+
+type goldenImage struct {
+	name string
+	img  image.Image
+}
+
+// goldenImages returns the sample images followed by synthetic images built
+// with integer arithmetic only, covering the RGBA, Gray and NRGBA paths of
+// the gray conversion in addition to the YCbCr samples.
+func goldenImages(t *testing.T) []goldenImage {
+	var images []goldenImage
+	for _, name := range []string{"sample1.jpg", "sample2.jpg", "sample3.jpg", "sample4.jpg"} {
+		file, err := os.Open("_examples/" + name)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		img, err := jpeg.Decode(file)
+		file.Close()
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		images = append(images, goldenImage{name, img})
+	}
+
+	const w, h = 97, 61
+	gradient := image.NewRGBA(image.Rect(0, 0, w, h))
+	checker := image.NewGray(image.Rect(0, 0, w, h))
+	rings := image.NewNRGBA(image.Rect(0, 0, w, h))
+	noise := image.NewRGBA(image.Rect(0, 0, w, h))
+	seed := uint32(1)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			gradient.SetRGBA(x, y, color.RGBA{uint8(x * 255 / w), uint8(y * 255 / h), uint8((x + y) * 255 / (w + h)), 255})
+			checker.SetGray(x, y, color.Gray{uint8(255 * ((x/12 + y/12) % 2))})
+			dx, dy := x-w/3, y-h/2
+			rings.SetNRGBA(x, y, color.NRGBA{uint8((dx*dx + dy*dy) / 7), 80, 160, uint8(128 + x)})
+			seed = seed*1664525 + 1013904223
+			noise.SetRGBA(x, y, color.RGBA{uint8(seed >> 24), uint8(seed >> 16), uint8(seed >> 8), 255})
+		}
+	}
+	return append(images,
+		goldenImage{"gradient", gradient},
+		goldenImage{"checker", checker},
+		goldenImage{"rings", rings},
+		goldenImage{"noise", noise},
+	)
+}
+
+func computeGolden(t *testing.T) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("# Golden hashes: image, algorithm, canonical hash.\n")
+	buf.WriteString("# Regenerate with: go test -run TestGoldenHashes -update-golden\n")
+	hashers := goldenHashers()
+	for _, gi := range goldenImages(t) {
+		for _, hasher := range hashers {
+			s, err := hasher.hash(gi.img)
+			if err != nil {
+				t.Fatalf("%s %s: %v", gi.name, hasher.name, err)
+			}
+			fmt.Fprintf(&buf, "%s %s %s\n", gi.name, hasher.name, s)
+		}
+	}
+	return buf.Bytes()
+}
+
+func readGolden(data []byte) (map[string]string, error) {
+	golden := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("malformed golden line %q", line)
+		}
+		golden[fields[0]+" "+fields[1]] = fields[2]
+	}
+	return golden, scanner.Err()
+}
+
+func TestGoldenHashes(t *testing.T) {
+	computed := computeGolden(t)
+	if *updateGolden {
+		if err := os.WriteFile(goldenFile, computed, 0644); err != nil {
+			t.Fatalf("%v", err)
+		}
+		return
+	}
+
+	data, err := os.ReadFile(goldenFile)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	expected, err := readGolden(data)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	actual, err := readGolden(computed)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	for key, want := range expected {
+		got, ok := actual[key]
+		if !ok {
+			t.Errorf("%s: no longer computed", key)
+			continue
+		}
+		if got == want {
+			continue
+		}
+		wantHash, err1 := ParseExtImageHash(want)
+		gotHash, err2 := ParseExtImageHash(got)
+		if err1 != nil || err2 != nil {
+			t.Errorf("%s: expected %s but got %s", key, want, got)
+			continue
+		}
+		distance, _ := wantHash.Distance(gotHash)
+		t.Errorf("%s: expected %s but got %s (%d bits differ)", key, want, got, distance)
+	}
+	for key := range actual {
+		if _, ok := expected[key]; !ok {
+			t.Errorf("%s: missing from %s", key, goldenFile)
+		}
+	}
+}
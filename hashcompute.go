@@ -130,7 +130,7 @@ func ExtPerceptionHash(img image.Image, width, height int) (*ExtImageHash, error
 			phash[indexOfArray] |= 1 << uint(indexOfBit)
 		}
 	}
-	return NewExtImageHash(phash, PHash, imgSize), nil
+	return NewExtImageHashWithSize(phash, PHash, imgSize, width, height), nil
 }
 
 // ExtAverageHash function returns ahash of which the size can be set larger than uint64
@@ -160,7 +160,7 @@ func ExtAverageHash(img image.Image, width, height int) (*ExtImageHash, error) {
 			ahash[indexOfArray] |= 1 << uint(indexOfBit)
 		}
 	}
-	return NewExtImageHash(ahash, AHash, imgSize), nil
+	return NewExtImageHashWithSize(ahash, AHash, imgSize, width, height), nil
 }
 
 // ExtDifferenceHash function returns dhash of which the size can be set larger than uint64
@@ -193,5 +193,5 @@ func ExtDifferenceHash(img image.Image, width, height int) (*ExtImageHash, error
 			idx++
 		}
 	}
-	return NewExtImageHash(dhash, DHash, imgSize), nil
+	return NewExtImageHashWithSize(dhash, DHash, imgSize, width, height), nil
 }
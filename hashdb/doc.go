@@ -0,0 +1,10 @@
+// Copyright 2017 The goimagehash Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package hashdb reads and writes hash databases: lists of image paths and
+// their hashes stored as CSV or JSON Lines, such as the files written by
+// goimagehash-cli batch -o. Readers accept every hash kind, the files of
+// earlier versions of the CLI and index files, and ignore unknown columns
+// and fields, so that databases can be enriched by other tools.
+package hashdb
@@ -0,0 +1,373 @@
+// Copyright 2017 The goimagehash Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hashdb
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/lollipopkit/goimagehash"
+)
+
+// Record is a hashed image, or the error that prevented hashing it.
+type Record struct {
+	// Path identifies the image, usually its file path.
+	Path string
+	// Algorithm is the algorithm the hash was computed with, e.g.
+	// "perception:8x8". It may be empty.
+	Algorithm string
+	// Hash is nil when Error is set.
+	Hash *goimagehash.ExtImageHash
+	// Error is the reason the image could not be hashed.
+	Error string
+}
+
+// NewRecord function returns the record of path hashed with algorithm,
+// holding err when it is not nil.
+func NewRecord(path, algorithm string, h *goimagehash.ExtImageHash, err error) Record {
+	if err != nil {
+		return Record{Path: path, Algorithm: algorithm, Error: err.Error()}
+	}
+	return Record{Path: path, Algorithm: algorithm, Hash: h}
+}
+
+// Header lists the CSV columns written by WriteCSV. The first four columns
+// are the ones written by the earliest versions of goimagehash-cli batch -o.
+var Header = []string{"File", "Hash", "HashType", "Bits", "Algorithm", "Hex", "Base64", "Error"}
+
+// jsonRecord is the JSON representation of a record. ID and the hash object
+// are only read, to accept index files.
+type jsonRecord struct {
+	Path      string          `json:"path"`
+	ID        string          `json:"id,omitempty"`
+	Algorithm string          `json:"algorithm"`
+	Kind      string          `json:"kind"`
+	Bits      int             `json:"bits"`
+	Hash      json.RawMessage `json:"hash"`
+	Hex       string          `json:"hex"`
+	Base64    string          `json:"base64"`
+	Error     string          `json:"error"`
+}
+
+// fields returns the kind name, bit size, canonical string, hex and base64
+// encodings of the hash of r, or empty values when it has none.
+func (r Record) fields() (kind string, bits int, canonical, hexStr, base64Str string) {
+	if r.Hash == nil {
+		return
+	}
+	b := r.Hash.Bytes()
+	return r.Hash.GetKind().String(), r.Hash.Bits(), r.Hash.String(),
+		hex.EncodeToString(b), base64.RawStdEncoding.EncodeToString(b)
+}
+
+// CSVRow method returns the record as a row of the Header columns.
+func (r Record) CSVRow() []string {
+	kind, bits, canonical, hexStr, base64Str := r.fields()
+	bitsStr := ""
+	if bits > 0 {
+		bitsStr = strconv.Itoa(bits)
+	}
+	return []string{r.Path, canonical, kind, bitsStr, r.Algorithm, hexStr, base64Str, r.Error}
+}
+
+// MarshalJSON method implements json.Marshaler. The record is written as an
+// object with the path, algorithm, kind, bits, hash (canonical string), hex,
+// base64 and error fields.
+func (r Record) MarshalJSON() ([]byte, error) {
+	j := jsonRecord{Path: r.Path, Algorithm: r.Algorithm, Error: r.Error}
+	var canonical string
+	j.Kind, j.Bits, canonical, j.Hex, j.Base64 = r.fields()
+	hash, err := json.Marshal(canonical)
+	if err != nil {
+		return nil, err
+	}
+	j.Hash = hash
+	return json.Marshal(j)
+}
+
+// UnmarshalJSON method implements json.Unmarshaler. Besides the object
+// written by MarshalJSON, it accepts the entries of index files, whose hash
+// is an object under an "id", and records whose hash is only given by the
+// kind, bits and hex fields. Unknown fields are ignored.
+func (r *Record) UnmarshalJSON(data []byte) error {
+	var j jsonRecord
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+	rec := Record{Path: j.Path, Algorithm: j.Algorithm, Error: j.Error}
+	if rec.Path == "" {
+		rec.Path = j.ID
+	}
+	if rec.Error == "" {
+		var canonical string
+		hash := bytes.TrimSpace(j.Hash)
+		if len(hash) > 0 && hash[0] == '{' {
+			rec.Hash = new(goimagehash.ExtImageHash)
+			if err := rec.Hash.UnmarshalJSON(hash); err != nil {
+				return err
+			}
+		} else if len(hash) > 0 && !bytes.Equal(hash, []byte("null")) {
+			if err := json.Unmarshal(hash, &canonical); err != nil {
+				return err
+			}
+		}
+		if rec.Hash == nil {
+			h, err := parseHash(canonical, j.Kind, j.Bits, j.Hex)
+			if err != nil {
+				return err
+			}
+			rec.Hash = h
+		}
+		rec.Hash = withSize(rec.Hash, rec.Algorithm)
+	}
+	*r = rec
+	return nil
+}
+
+// parseHash returns the hash given by its canonical string, or else by its
+// kind, bit size and hex encoding. Strings of earlier versions of the CLI,
+// such as " :000000519cc8cfb1" for double gradient hashes which had no kind
+// code, are read with kind.
+func parseHash(canonical, kind string, bits int, hexStr string) (*goimagehash.ExtImageHash, error) {
+	canonical = strings.TrimSpace(canonical)
+	if canonical == "" && hexStr == "" {
+		return nil, errors.New("no hash")
+	}
+	legacy := false
+	if canonical != "" {
+		h, err := goimagehash.ParseExtImageHash(canonical)
+		if err == nil || kind == "" {
+			return h, err
+		}
+		// The kind column or field names the kind the code lacks.
+		hexStr = canonical[strings.LastIndex(canonical, ":")+1:]
+		legacy = strings.HasPrefix(canonical, ":")
+	}
+	k, err := goimagehash.ParseKind(strings.ToLower(kind))
+	if err != nil {
+		return nil, err
+	}
+	b, err := hex.DecodeString(hexStr)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't parse hash %q: %v", hexStr, err)
+	}
+	if bits <= 0 {
+		bits = len(b) * 8
+	}
+	if legacy && k == goimagehash.DGHash {
+		return goimagehash.ParseLegacyExtImageHash(":"+hexStr, bits)
+	}
+	if n := (bits + 7) / 8; len(b) > n {
+		// Hashes used to be written as whole 64 bits words.
+		b = b[:n]
+	}
+	return goimagehash.ExtImageHashFromBytes(b, k, bits)
+}
+
+// withSize returns h with the width and height of algorithm when h does not
+// know them and algorithm matches its kind and bit size.
+func withSize(h *goimagehash.ExtImageHash, algorithm string) *goimagehash.ExtImageHash {
+	if w, _ := h.Size(); w > 0 || algorithm == "" {
+		return h
+	}
+	a, err := goimagehash.ParseAlgorithm(algorithm)
+	if err != nil || a.Kind != h.GetKind() || a.Bits() != h.Bits() {
+		return h
+	}
+	return goimagehash.NewExtImageHashWithSize(h.GetHash(), h.GetKind(), h.Bits(), a.Width, a.Height)
+}
+
+// WriteCSV function writes records to w as CSV with the Header columns.
+func WriteCSV(w io.Writer, records []Record) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(Header); err != nil {
+		return err
+	}
+	for _, r := range records {
+		if err := cw.Write(r.CSVRow()); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteJSONL function writes records to w as JSON Lines, one object per
+// record.
+func WriteJSONL(w io.Writer, records []Record) error {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	for _, r := range records {
+		if err := enc.Encode(r); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// ReadCSV function reads the records of a CSV file with a header row. The
+// columns are found by name, ignoring case: File (or Path or ID), Hash, and
+// optionally HashType (or Kind), Bits, Algorithm, Hex and Error. Other
+// columns are ignored. Rows with an error are returned with a nil Hash.
+func ReadCSV(r io.Reader) ([]Record, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	columns := make(map[string]int)
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		if _, ok := columns[name]; !ok {
+			columns[name] = i
+		}
+	}
+	column := func(names ...string) int {
+		for _, name := range names {
+			if i, ok := columns[name]; ok {
+				return i
+			}
+		}
+		return -1
+	}
+	pathColumn := column("file", "path", "id")
+	hashColumn, hexColumn := column("hash"), column("hex")
+	if pathColumn < 0 || (hashColumn < 0 && hexColumn < 0) {
+		return nil, errors.New("missing File or Hash column")
+	}
+	kindColumn, bitsColumn := column("hashtype", "kind"), column("bits")
+	algorithmColumn, errorColumn := column("algorithm"), column("error")
+
+	var records []Record
+	for {
+		row, err := cr.Read()
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := cr.FieldPos(0)
+		field := func(i int) string {
+			if i < 0 || i >= len(row) {
+				return ""
+			}
+			return strings.TrimSpace(row[i])
+		}
+		rec := Record{Path: field(pathColumn), Algorithm: field(algorithmColumn), Error: field(errorColumn)}
+		if rec.Path == "" {
+			continue
+		}
+		if rec.Error == "" {
+			bits := 0
+			if s := field(bitsColumn); s != "" {
+				if bits, err = strconv.Atoi(s); err != nil {
+					return nil, fmt.Errorf("line %d: invalid bits %q", line, s)
+				}
+			}
+			h, err := parseHash(field(hashColumn), field(kindColumn), bits, field(hexColumn))
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			rec.Hash = withSize(h, rec.Algorithm)
+		}
+		records = append(records, rec)
+	}
+}
+
+// ReadJSON function reads the records of a JSON Lines file, or of a JSON
+// array of records. Blank lines are ignored.
+func ReadJSON(r io.Reader) ([]Record, error) {
+	br := bufio.NewReader(r)
+	if first, err := peekNonSpace(br); err == io.EOF {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	} else if first == '[' {
+		var records []Record
+		if err := json.NewDecoder(br).Decode(&records); err != nil {
+			return nil, err
+		}
+		return records, nil
+	}
+
+	var records []Record
+	scanner := bufio.NewScanner(br)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+		var rec Record
+		if err := json.Unmarshal(text, &rec); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		records = append(records, rec)
+	}
+	return records, scanner.Err()
+}
+
+// peekNonSpace skips a byte order mark and white space, and returns the
+// next byte of br without consuming it.
+func peekNonSpace(br *bufio.Reader) (byte, error) {
+	if bom, _ := br.Peek(3); string(bom) == "\ufeff" {
+		br.Discard(3)
+	}
+	for {
+		b, err := br.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		if b != ' ' && b != '\t' && b != '\r' && b != '\n' {
+			return b, br.UnreadByte()
+		}
+	}
+}
+
+// Read function reads the records of a CSV or JSON file, telling them apart
+// by their first character.
+func Read(r io.Reader) ([]Record, error) {
+	br := bufio.NewReader(r)
+	first, err := peekNonSpace(br)
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if first == '{' || first == '[' {
+		return ReadJSON(br)
+	}
+	return ReadCSV(br)
+}
+
+// Load function reads the records of the CSV or JSON file at path.
+func Load(path string) ([]Record, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	records, err := Read(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return records, nil
+}
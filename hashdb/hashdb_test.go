@@ -0,0 +1,197 @@
+// Copyright 2017 The goimagehash Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hashdb
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lollipopkit/goimagehash"
+)
+
+// testRecords returns records with a hash of every kind, including a double
+// gradient hash whose bit size is not a multiple of 8, and a failure.
+func testRecords(t *testing.T) []Record {
+	img := image.NewGray(image.Rect(0, 0, 32, 32))
+	for y := 0; y < 32; y++ {
+		for x := 0; x < 32; x++ {
+			img.SetGray(x, y, color.Gray{uint8(x*8 ^ y*5)})
+		}
+	}
+	var records []Record
+	for _, name := range []string{"average", "difference:9x8", "perception:16x16", "double-gradient", "double-gradient:10x10"} {
+		a, err := goimagehash.ParseAlgorithm(name)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		h, err := a.Hash(img)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		records = append(records, NewRecord("dir/"+name+".jpg", a.String(), h, nil))
+	}
+	records = append(records, NewRecord("broken, \"quoted\".jpg", "average:8x8", nil, errors.New("failed to decode image")))
+	return records
+}
+
+func checkRecords(t *testing.T, format string, expected, got []Record) {
+	if len(got) != len(expected) {
+		t.Fatalf("%s: expected %d records but got %d", format, len(expected), len(got))
+	}
+	for i, e := range expected {
+		g := got[i]
+		if g.Path != e.Path || g.Algorithm != e.Algorithm || g.Error != e.Error {
+			t.Errorf("%s: expected %+v but got %+v", format, e, g)
+			continue
+		}
+		if e.Hash == nil {
+			if g.Hash != nil {
+				t.Errorf("%s: %s: expected no hash but got %s", format, e.Path, g.Hash)
+			}
+			continue
+		}
+		ew, eh := e.Hash.Size()
+		gw, gh := g.Hash.Size()
+		if g.Hash.String() != e.Hash.String() || g.Hash.GetKind() != e.Hash.GetKind() || gw != ew || gh != eh {
+			t.Errorf("%s: %s: expected %s %dx%d but got %s %dx%d", format, e.Path, e.Hash, ew, eh, g.Hash, gw, gh)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	records := testRecords(t)
+
+	var buf bytes.Buffer
+	if err := WriteCSV(&buf, records); err != nil {
+		t.Fatalf("%v", err)
+	}
+	got, err := ReadCSV(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	checkRecords(t, "csv", records, got)
+
+	buf.Reset()
+	if err := WriteJSONL(&buf, records); err != nil {
+		t.Fatalf("%v", err)
+	}
+	got, err = ReadJSON(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	checkRecords(t, "jsonl", records, got)
+
+	// Load tells the formats apart.
+	dir := t.TempDir()
+	for name, write := range map[string]func(*bytes.Buffer) error{
+		"hashes.txt":  func(b *bytes.Buffer) error { return WriteCSV(b, records) },
+		"hashes.json": func(b *bytes.Buffer) error { return WriteJSONL(b, records) },
+	} {
+		buf.Reset()
+		if err := write(&buf); err != nil {
+			t.Fatalf("%v", err)
+		}
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+			t.Fatalf("%v", err)
+		}
+		got, err := Load(path)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		checkRecords(t, name, records, got)
+	}
+	if _, err := Load(filepath.Join(dir, "missing.csv")); err == nil {
+		t.Errorf("Should got error for a missing file")
+	}
+}
+
+func TestReadCSV(t *testing.T) {
+	// Columns in another order, extra columns, a byte order mark, a row
+	// written by batch -o of an earlier version, without kind code for
+	// double gradient hashes, and a row with the hash given by its hex
+	// encoding only.
+	input := "\ufeffNote,Bits,hash,FILE,HashType,Hex,Owner\n" +
+		"x,64,a:00000000000000ff,a.jpg,average,,alice\n" +
+		"y,40,\" :000000519cc8cfb1\",sample1.jpg,double-gradient,,bob\n" +
+		"z,12,,c.jpg,double-gradient,fff0,carol\n" +
+		",,,,,,\n"
+	records, err := Read(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	expected := []string{"a.jpg=a:00000000000000ff", "sample1.jpg=g:8df313398a", "c.jpg=g:12:fff0"}
+	if len(records) != len(expected) {
+		t.Fatalf("Expected %d records but got %d", len(expected), len(records))
+	}
+	for i, r := range records {
+		if got := r.Path + "=" + r.Hash.String(); got != expected[i] {
+			t.Errorf("Expected %s but got %s", expected[i], got)
+		}
+	}
+
+	for _, input := range []string{
+		"Name,Value\na.jpg,a:00\n",
+		"File,Hash\na.jpg,z:00\n",
+		"File,Hash\na.jpg,\n",
+		"File,Hash,Bits\na.jpg,a:00,x\n",
+		"File,Hash\n\"a.jpg,a:00\n",
+		"File,Hash,HashType,Bits\na.jpg, :00000051,double-gradient,40\n",
+		"File,Hash,HashType,Bits\na.jpg, :000001519cc8cfb1,double-gradient,40\n",
+	} {
+		if _, err := ReadCSV(strings.NewReader(input)); err == nil {
+			t.Errorf("Should got error for %q", input)
+		}
+	}
+	if records, err := ReadCSV(strings.NewReader("")); err != nil || len(records) != 0 {
+		t.Errorf("Expected no record for an empty file but got %v, %v", records, err)
+	}
+}
+
+func TestReadJSON(t *testing.T) {
+	// An index file entry, a record with extra fields, and a JSON array.
+	input := `{"id":"a.jpg","hash":{"kind":"g","bits":12,"width":3,"height":3,"hash":"fff0"}}` + "\n\n" +
+		`{"path":"b.jpg","hash":"p:00000000000000ff","tags":["x"],"exif":{"iso":100}}` + "\n" +
+		`{"path":"c.jpg","kind":"average","bits":64,"hex":"00000000000000ff"}` + "\n"
+	records, err := Read(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	expected := []string{"a.jpg=g:12:fff0", "b.jpg=p:00000000000000ff", "c.jpg=a:00000000000000ff"}
+	if len(records) != len(expected) {
+		t.Fatalf("Expected %d records but got %d", len(expected), len(records))
+	}
+	for i, r := range records {
+		if got := r.Path + "=" + r.Hash.String(); got != expected[i] {
+			t.Errorf("Expected %s but got %s", expected[i], got)
+		}
+	}
+	if w, h := records[0].Hash.Size(); w != 3 || h != 3 {
+		t.Errorf("Expected the size of the index entry to be kept but got %dx%d", w, h)
+	}
+
+	records, err = Read(strings.NewReader(` [{"path":"a.jpg","hash":"a:00000000000000ff"},{"path":"b.jpg","error":"boom"}]`))
+	if err != nil || len(records) != 2 || records[1].Error != "boom" || records[1].Hash != nil {
+		t.Errorf("Unexpected records of a JSON array %v, %v", records, err)
+	}
+
+	for _, input := range []string{
+		"{not json}\n",
+		`{"path":"a.jpg"}` + "\n",
+		`{"path":"a.jpg","hash":"z:00"}` + "\n",
+		`{"path":"a.jpg","hash":12}` + "\n",
+		`[{"path":"a.jpg","hash":"a:00"}`,
+	} {
+		if _, err := ReadJSON(strings.NewReader(input)); err == nil {
+			t.Errorf("Should got error for %q", input)
+		}
+	}
+}
@@ -6,11 +6,12 @@ package goimagehash
 
 import (
 	"encoding/binary"
-	"encoding/gob"
 	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
+	"strconv"
+	"strings"
 )
 
 var errNoOther = errors.New("other should not be nil")
@@ -26,9 +27,11 @@ type ImageHash struct {
 
 // ExtImageHash is a struct of big hash computation.
 type ExtImageHash struct {
-	hash []uint64
-	kind Kind
-	bits int
+	hash   []uint64
+	kind   Kind
+	bits   int
+	width  int
+	height int
 }
 
 const (
@@ -86,76 +89,51 @@ func (h *ImageHash) leftShiftSet(idx int) {
 	h.hash |= 1 << uint(idx)
 }
 
-const strFmt = "%1s:%016x"
-
 // Dump method writes a binary serialization into w io.Writer.
+// The hash is written as a single hash stream of the wire format.
 func (h *ImageHash) Dump(w io.Writer) error {
-	type D struct {
-		Hash uint64
-		Kind Kind
-	}
-	enc := gob.NewEncoder(w)
-	err := enc.Encode(D{Hash: h.hash, Kind: h.kind})
-	if err != nil {
-		return err
-	}
-	return nil
+	return NewHashWriter(w).WriteImageHash(h)
 }
 
 // LoadImageHash method loads a ImageHash from io.Reader.
+// Both the wire format and the gob serialization of older versions of Dump
+// are accepted.
 func LoadImageHash(b io.Reader) (*ImageHash, error) {
-	type E struct {
-		Hash uint64
-		Kind Kind
-	}
-	var e E
-	dec := gob.NewDecoder(b)
-	err := dec.Decode(&e)
-	if err != nil {
-		return nil, err
-	}
-	return &ImageHash{hash: e.Hash, kind: e.Kind}, nil
+	return NewHashReader(b).ReadImageHash()
 }
 
-// ImageHashFromString returns an image hash from a hex representation
+// ImageHashFromString returns an image hash from a hex representation.
+// Besides the canonical encoding, it accepts the strings of former versions
+// of ToString, which wrote " :" for kinds without a code; those hashes are
+// of the Unknown kind.
 //
-// Deprecated: Use goimagehash.LoadImageHash instead.
+// Deprecated: Use goimagehash.ParseImageHash instead.
 func ImageHashFromString(s string) (*ImageHash, error) {
-	var kindStr string
-	var hash uint64
-	_, err := fmt.Sscanf(s, strFmt, &kindStr, &hash)
-	if err != nil {
-		return nil, errors.New("Couldn't parse string " + s)
+	h, err := ParseImageHash(s)
+	if err == nil {
+		return h, nil
 	}
-
-	kind := Unknown
-	switch kindStr {
-	case "a":
-		kind = AHash
-	case "p":
-		kind = PHash
-	case "d":
-		kind = DHash
-	case "w":
-		kind = WHash
+	hexStr, ok := legacyCodeless(s)
+	if !ok || len(hexStr) != 16 {
+		return nil, err
 	}
-	return NewImageHash(hash, kind), nil
+	hash, perr := strconv.ParseUint(hexStr, 16, 64)
+	if perr != nil {
+		return nil, err
+	}
+	return NewImageHash(hash, Unknown), nil
+}
+
+// legacyCodeless returns the hex digits of a string written by former
+// versions of ToString for a kind without a code, such as
+// " :000000519cc8cfb1".
+func legacyCodeless(s string) (string, bool) {
+	return strings.CutPrefix(strings.TrimPrefix(s, " "), ":")
 }
 
 // ToString returns a hex representation of the hash
 func (h *ImageHash) ToString() string {
-	kindStr := ""
-	switch h.kind {
-	case AHash:
-		kindStr = "a"
-	case PHash:
-		kindStr = "p"
-	case DHash:
-		kindStr = "d"
-	case WHash:
-		kindStr = "w"
-	}
-	return fmt.Sprintf(strFmt, kindStr, h.hash)
+	return h.String()
 }
 
 // NewExtImageHash function creates a new big hash
@@ -163,6 +141,18 @@ func NewExtImageHash(hash []uint64, kind Kind, bits int) *ExtImageHash {
 	return &ExtImageHash{hash: hash, kind: kind, bits: bits}
 }
 
+// NewExtImageHashWithSize function creates a new big hash computed with the
+// given width and height parameters.
+func NewExtImageHashWithSize(hash []uint64, kind Kind, bits, width, height int) *ExtImageHash {
+	return &ExtImageHash{hash: hash, kind: kind, bits: bits, width: width, height: height}
+}
+
+// Size method returns the width and height parameters the hash was computed
+// with, or zeros when they are unknown.
+func (h *ExtImageHash) Size() (width, height int) {
+	return h.width, h.height
+}
+
 // Bits method returns an actual hash bit size
 func (h *ExtImageHash) Bits() int {
 	return h.bits
@@ -205,97 +195,66 @@ func (h *ExtImageHash) GetKind() Kind {
 }
 
 // Dump method writes a binary serialization into w io.Writer.
+// The hash is written as a single hash stream of the wire format.
 func (h *ExtImageHash) Dump(w io.Writer) error {
-	type D struct {
-		Hash []uint64
-		Kind Kind
-		Bits int
-	}
-	enc := gob.NewEncoder(w)
-	err := enc.Encode(D{Hash: h.hash, Kind: h.kind, Bits: h.bits})
-	if err != nil {
-		return err
-	}
-	return nil
+	return NewHashWriter(w).WriteExtImageHash(h)
 }
 
 // LoadExtImageHash method loads a ExtImageHash from io.Reader.
+// Both the wire format and the gob serialization of older versions of Dump
+// are accepted, and the bit size is validated against the hash words.
 func LoadExtImageHash(b io.Reader) (*ExtImageHash, error) {
-	type E struct {
-		Hash []uint64
-		Kind Kind
-		Bits int
-	}
-	var e E
-	dec := gob.NewDecoder(b)
-	err := dec.Decode(&e)
-	if err != nil {
-		return nil, err
-	}
-	return &ExtImageHash{hash: e.Hash, kind: e.Kind, bits: e.Bits}, nil
+	return NewHashReader(b).Read()
 }
 
-const extStrFmt = "%1s:%s"
-
-// ExtImageHashFromString returns a big hash from a hex representation
+// ExtImageHashFromString returns a big hash from a hex representation.
+// The strings of former versions of ToString for DoubleGradient hashes,
+// which had no code, do not hold their bit size and are rejected: they are
+// read by ParseLegacyExtImageHash.
 //
-// Deprecated: Use goimagehash.LoadExtImageHash instead.
+// Deprecated: Use goimagehash.ParseExtImageHash instead.
 func ExtImageHashFromString(s string) (*ExtImageHash, error) {
-	var kindStr string
-	var hashStr string
-	_, err := fmt.Sscanf(s, extStrFmt, &kindStr, &hashStr)
-	if err != nil {
-		return nil, errors.New("Couldn't parse string " + s)
+	h, err := ParseExtImageHash(s)
+	if err == nil {
+		return h, nil
+	}
+	if _, ok := legacyCodeless(s); ok {
+		return nil, fmt.Errorf("legacy double gradient hash %q has no bit size, use ParseLegacyExtImageHash", s)
 	}
+	return nil, err
+}
 
-	hexBytes, err := hex.DecodeString(hashStr)
+// ParseLegacyExtImageHash function parses the string of a DoubleGradient
+// hash of bits bits written by former versions of ToString, such as
+// " :000000519cc8cfb1" for 40 bits: no code, and whole 64 bits words in big
+// endian hex whose bits were packed LSB first.
+func ParseLegacyExtImageHash(s string, bits int) (*ExtImageHash, error) {
+	hexStr, ok := legacyCodeless(s)
+	if !ok {
+		return nil, fmt.Errorf("couldn't parse legacy double gradient hash %q", s)
+	}
+	b, err := hex.DecodeString(hexStr)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("couldn't parse legacy double gradient hash %q: %v", s, err)
 	}
-
-	var hash []uint64
-	lenOfByte := 8
-	for i := 0; i < len(hexBytes)/lenOfByte; i++ {
-		startIndex := i * lenOfByte
-		endIndex := startIndex + lenOfByte
-		hashUint64 := binary.BigEndian.Uint64(hexBytes[startIndex:endIndex])
-		hash = append(hash, hashUint64)
+	words := wordsFor(bits)
+	if bits <= 0 || len(b) != 8*words {
+		return nil, fmt.Errorf("legacy %d bits hash should have %d words", bits, words)
 	}
-
-	kind := Unknown
-	switch kindStr {
-	case "a":
-		kind = AHash
-	case "p":
-		kind = PHash
-	case "d":
-		kind = DHash
-	case "w":
-		kind = WHash
+	h := NewExtImageHash(make([]uint64, words), DGHash, bits)
+	for i := 0; i < 64*words; i++ {
+		if binary.BigEndian.Uint64(b[8*(i/64):])>>uint(i%64)&1 == 0 {
+			continue
+		}
+		if i >= bits {
+			return nil, errors.New("unused trailing bits of hash should be zero")
+		}
+		h.SetBit(i, true)
 	}
-	return NewExtImageHash(hash, kind, len(hash)*64), nil
+	return h, nil
 }
 
 // ToString returns a hex representation of big hash
 func (h *ExtImageHash) ToString() string {
-	var hexBytes []byte
-	for _, hash := range h.hash {
-		hashBytes := make([]byte, 8)
-		binary.BigEndian.PutUint64(hashBytes, hash)
-		hexBytes = append(hexBytes, hashBytes...)
-	}
-	hexStr := hex.EncodeToString(hexBytes)
-
-	kindStr := ""
-	switch h.kind {
-	case AHash:
-		kindStr = "a"
-	case PHash:
-		kindStr = "p"
-	case DHash:
-		kindStr = "d"
-	case WHash:
-		kindStr = "w"
-	}
-	return fmt.Sprintf(extStrFmt, kindStr, hexStr)
+	return h.String()
 }
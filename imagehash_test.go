@@ -163,6 +163,70 @@ func TestSerialization(t *testing.T) {
 	extImageHash, err = ExtImageHashFromString("k:g")
 }
 
+func TestLegacyStrings(t *testing.T) {
+	file, err := os.Open("_examples/sample1.jpg")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer file.Close()
+	img, _, err := image.Decode(file)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	// The ToString output of former versions for sample1.jpg.
+	avg, err := ImageHashFromString("a:ffff3f030703c1f0")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	want, _ := AverageHash(img)
+	if d, err := avg.Distance(want); err != nil || d != 0 {
+		t.Errorf("Expected %v but got %v", want, avg)
+	}
+	ext, err := ExtImageHashFromString("p:aff295bcd20e2037443c6b401fa182fe70fd4f7a7c00f80ba3b743ec0e60783f")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	wantExt, _ := ExtPerceptionHash(img, 16, 16)
+	if d, err := ext.Distance(wantExt); err != nil || d != 0 {
+		t.Errorf("Expected %v but got %v", wantExt, ext)
+	}
+	unknown, err := ImageHashFromString(" :0000000000001234")
+	if err != nil || unknown.GetKind() != Unknown || unknown.GetHash() != 0x1234 {
+		t.Errorf("Unexpected hash %v, %v", unknown, err)
+	}
+
+	// Double gradient hashes had no code and were packed LSB first; their
+	// bit size is not in the string.
+	if _, err := ExtImageHashFromString(" :000000519cc8cfb1"); err == nil {
+		t.Errorf("Should got error for a legacy double gradient hash without bit size")
+	}
+	dg, err := ParseLegacyExtImageHash(" :000000519cc8cfb1", 40)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	wantDG, _ := DoubleGradientHash(img, 8, 8)
+	if d, err := dg.Distance(wantDG); err != nil || d != 0 {
+		t.Errorf("Expected %v but got %v, %v", wantDG, dg, err)
+	}
+
+	for _, tt := range []struct {
+		s    string
+		bits int
+	}{
+		{" :", 40},
+		{" :000000519cc8cfb1", 32},
+		{" :000000519cc8cfb1", 0},
+		{" :000000519cc8cfb", 40},
+		{" :0000000519cc8cfb1", 40},
+		{"g:000000519cc8cfb1", 40},
+	} {
+		if _, err := ParseLegacyExtImageHash(tt.s, tt.bits); err == nil {
+			t.Errorf("Should got error for %q of %d bits", tt.s, tt.bits)
+		}
+	}
+}
+
 func TestDifferentBitSizeHash(t *testing.T) {
 	checkErr := func(err error) {
 		if err != nil {
@@ -0,0 +1,8 @@
+// Copyright 2017 The goimagehash Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package index stores image hashes under string identifiers and answers
+// range and nearest neighbour queries under the Hamming distance without
+// comparing the query with every stored hash.
+package index
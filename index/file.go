@@ -0,0 +1,125 @@
+// Copyright 2017 The goimagehash Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package index
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/lollipopkit/goimagehash"
+)
+
+// fileEntry is the JSON representation of an entry in an index file.
+type fileEntry struct {
+	ID   string                    `json:"id"`
+	Hash *goimagehash.ExtImageHash `json:"hash"`
+}
+
+// Write method writes the entries of the index to w as JSON Lines, one
+// {"id": ..., "hash": ...} object per entry, sorted by identifier.
+func (x *Index) Write(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	for _, e := range x.Entries() {
+		if err := enc.Encode(fileEntry{e.ID, e.Hash}); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// Read function returns an index holding the entries written by Write.
+// Blank lines are ignored and a later entry replaces an earlier one with the
+// same identifier.
+func Read(r io.Reader) (*Index, error) {
+	x := New()
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; sc.Scan(); line++ {
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+		var e fileEntry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if e.Hash == nil {
+			return nil, fmt.Errorf("line %d: missing hash", line)
+		}
+		if err := x.Add(e.ID, e.Hash); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// Save method writes the index to the file at path. The file is replaced
+// atomically, so that readers never see a partial index. It keeps the mode
+// of the file it replaces, and a new file gets mode 0644 like with Append.
+func (x *Index) Save(path string) error {
+	mode := os.FileMode(0o644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := tmp.Chmod(mode); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := x.Write(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Append function appends the entry of hash under id to the index file at
+// path, created if missing, without rewriting it. Loading the file then
+// replaces any earlier entry under id, so that appending is cheaper than
+// Save for adding to a large index.
+func Append(path, id string, hash *goimagehash.ExtImageHash) error {
+	line, err := json.Marshal(fileEntry{id, hash})
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	// A single write, so that the line is never interleaved with others.
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Load function reads the index saved at path.
+func Load(path string) (*Index, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	x, err := Read(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return x, nil
+}
@@ -0,0 +1,126 @@
+// Copyright 2017 The goimagehash Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package index
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lollipopkit/goimagehash"
+)
+
+func TestIndexSaveLoad(t *testing.T) {
+	r := rand.New(rand.NewSource(2))
+	x := New()
+	for i := 0; i < 50; i++ {
+		x.Add(fmt.Sprintf("img%02d.jpg", i), randomHash(r, goimagehash.PHash))
+	}
+	x.Add("large", goimagehash.NewExtImageHash([]uint64{r.Uint64(), r.Uint64(), r.Uint64(), r.Uint64()}, goimagehash.DHash, 256))
+	x.Add("odd \"name\"\n", goimagehash.NewExtImageHash([]uint64{0xff << 24}, goimagehash.DGHash, 40))
+
+	path := filepath.Join(t.TempDir(), "index.jsonl")
+	if err := x.Save(path); err != nil {
+		t.Fatalf("%v", err)
+	}
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if loaded.Len() != x.Len() {
+		t.Fatalf("Expected %d entries but got %d", x.Len(), loaded.Len())
+	}
+	for _, e := range x.Entries() {
+		h, ok := loaded.Get(e.ID)
+		if !ok {
+			t.Errorf("Missing entry %q", e.ID)
+			continue
+		}
+		if h.String() != e.Hash.String() {
+			t.Errorf("Entry %q: expected %s but got %s", e.ID, e.Hash, h)
+		}
+	}
+
+	if info, err := os.Stat(path); err != nil {
+		t.Fatalf("%v", err)
+	} else if info.Mode().Perm() != 0o644 {
+		t.Errorf("Expected a new index file of mode 0644 but got %v", info.Mode())
+	}
+	if err := os.Chmod(path, 0o640); err != nil {
+		t.Fatalf("%v", err)
+	}
+	if err := x.Save(path); err != nil {
+		t.Fatalf("%v", err)
+	}
+	if info, err := os.Stat(path); err != nil {
+		t.Fatalf("%v", err)
+	} else if info.Mode().Perm() != 0o640 {
+		t.Errorf("Expected the mode 0640 of the replaced file but got %v", info.Mode())
+	}
+}
+
+func TestIndexAppend(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "index.jsonl")
+	x := New()
+	x.Add("a", goimagehash.NewExtImageHash([]uint64{1}, goimagehash.PHash, 64))
+	if err := x.Save(path); err != nil {
+		t.Fatalf("%v", err)
+	}
+	for _, e := range []Entry{
+		{"b", goimagehash.NewExtImageHash([]uint64{2}, goimagehash.PHash, 64)},
+		{"a", goimagehash.NewExtImageHash([]uint64{3}, goimagehash.PHash, 64)},
+	} {
+		if err := Append(path, e.ID, e.Hash); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if loaded.Len() != 2 {
+		t.Errorf("Expected 2 entries but got %d", loaded.Len())
+	}
+	if h, ok := loaded.Get("a"); !ok || h.GetHash()[0] != 3 {
+		t.Errorf("Expected the appended hash of a but got %v", h)
+	}
+
+	// Appending creates a missing file.
+	path = filepath.Join(t.TempDir(), "new.jsonl")
+	if err := Append(path, "c", goimagehash.NewExtImageHash([]uint64{4}, goimagehash.PHash, 64)); err != nil {
+		t.Fatalf("%v", err)
+	}
+	if loaded, err := Load(path); err != nil || loaded.Len() != 1 {
+		t.Errorf("Expected 1 entry but got %v", err)
+	}
+}
+
+func TestIndexReadErrors(t *testing.T) {
+	for _, input := range []string{
+		"not json\n",
+		`{"id":"a"}` + "\n",
+		`{"id":"a","hash":"z:00"}` + "\n",
+	} {
+		if _, err := Read(strings.NewReader(input)); err == nil {
+			t.Errorf("Should got error for %q", input)
+		}
+	}
+	x, err := Read(strings.NewReader("\n" + `{"id":"a","hash":"p:0000000000000001"}` + "\n" + `{"id":"a","hash":"p:0000000000000003"}` + "\n"))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if h, _ := x.Get("a"); x.Len() != 1 || h.String() != "p:0000000000000003" {
+		t.Errorf("Expected the last entry to win but got %d entries", x.Len())
+	}
+
+	var buf bytes.Buffer
+	if err := New().Write(&buf); err != nil || buf.Len() != 0 {
+		t.Errorf("Expected an empty file but got %q, %v", buf.String(), err)
+	}
+}
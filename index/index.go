@@ -0,0 +1,219 @@
+// Copyright 2017 The goimagehash Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package index
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/lollipopkit/goimagehash"
+)
+
+// Entry is a hash stored in an index under an identifier, usually the path
+// of the hashed image.
+type Entry struct {
+	ID   string
+	Hash *goimagehash.ExtImageHash
+}
+
+// Match is an entry returned by a query along with its distance to the
+// queried hash.
+type Match struct {
+	Entry
+	Distance int
+}
+
+// space identifies the hashes that can be compared with each other.
+type space struct {
+	kind goimagehash.Kind
+	bits int
+}
+
+// node is a node of a BK-tree: every child at key d holds hashes at distance
+// d of the node's hash. Removed nodes stay in the tree to keep it valid.
+type node struct {
+	entry    Entry
+	removed  bool
+	children map[int]*node
+}
+
+// Index is a set of hashes organized as one BK-tree per kind and bit size.
+// Hashes of different kinds or sizes never match each other.
+// An Index is not safe for concurrent use.
+type Index struct {
+	trees   map[space]*node
+	nodes   map[string]*node
+	removed int
+}
+
+// New function returns an empty index.
+func New() *Index {
+	return &Index{
+		trees: make(map[space]*node),
+		nodes: make(map[string]*node),
+	}
+}
+
+func spaceOf(h *goimagehash.ExtImageHash) space {
+	return space{h.GetKind(), h.Bits()}
+}
+
+// Len method returns the number of entries in the index.
+func (x *Index) Len() int {
+	return len(x.nodes)
+}
+
+// Add method stores hash under id, replacing any hash already stored
+// under id.
+func (x *Index) Add(id string, hash *goimagehash.ExtImageHash) error {
+	if hash == nil {
+		return errors.New("hash can not be nil")
+	}
+	x.Remove(id)
+	n := &node{entry: Entry{ID: id, Hash: hash}}
+	x.nodes[id] = n
+
+	s := spaceOf(hash)
+	cur, ok := x.trees[s]
+	if !ok {
+		x.trees[s] = n
+		return nil
+	}
+	for {
+		d, err := cur.entry.Hash.Distance(hash)
+		if err != nil {
+			return err
+		}
+		next, ok := cur.children[d]
+		if !ok {
+			if cur.children == nil {
+				cur.children = make(map[int]*node)
+			}
+			cur.children[d] = n
+			return nil
+		}
+		cur = next
+	}
+}
+
+// AddImageHash method stores a 64 bits hash under id.
+func (x *Index) AddImageHash(id string, hash *goimagehash.ImageHash) error {
+	if hash == nil {
+		return errors.New("hash can not be nil")
+	}
+	return x.Add(id, hash.ToExtImageHash())
+}
+
+// Remove method removes the hash stored under id and reports whether there
+// was one. The tree is rebuilt once removed nodes outnumber live ones.
+func (x *Index) Remove(id string) bool {
+	n, ok := x.nodes[id]
+	if !ok {
+		return false
+	}
+	n.removed = true
+	delete(x.nodes, id)
+	x.removed++
+	if x.removed > len(x.nodes) {
+		x.rebuild()
+	}
+	return true
+}
+
+func (x *Index) rebuild() {
+	entries := x.Entries()
+	x.trees = make(map[space]*node)
+	x.nodes = make(map[string]*node)
+	x.removed = 0
+	for _, e := range entries {
+		x.Add(e.ID, e.Hash)
+	}
+}
+
+// Get method returns the hash stored under id.
+func (x *Index) Get(id string) (*goimagehash.ExtImageHash, bool) {
+	n, ok := x.nodes[id]
+	if !ok {
+		return nil, false
+	}
+	return n.entry.Hash, true
+}
+
+// Entries method returns every entry of the index sorted by identifier.
+func (x *Index) Entries() []Entry {
+	entries := make([]Entry, 0, len(x.nodes))
+	for _, n := range x.nodes {
+		entries = append(entries, n.entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].ID < entries[j].ID })
+	return entries
+}
+
+// Within method returns the entries at distance maxDistance or less of hash,
+// sorted by distance then by identifier. Only entries of the same kind and
+// bit size as hash are considered.
+func (x *Index) Within(hash *goimagehash.ExtImageHash, maxDistance int) []Match {
+	if hash == nil || maxDistance < 0 {
+		return nil
+	}
+	var matches []Match
+	stack := []*node{x.trees[spaceOf(hash)]}
+	for len(stack) > 0 {
+		n := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if n == nil {
+			continue
+		}
+		d, err := n.entry.Hash.Distance(hash)
+		if err != nil {
+			continue
+		}
+		if d <= maxDistance && !n.removed {
+			matches = append(matches, Match{Entry: n.entry, Distance: d})
+		}
+		for cd, child := range n.children {
+			if cd >= d-maxDistance && cd <= d+maxDistance {
+				stack = append(stack, child)
+			}
+		}
+	}
+	sortMatches(matches)
+	return matches
+}
+
+// Nearest method returns the k entries closest to hash at distance
+// maxDistance or less, sorted by distance then by identifier. A negative
+// maxDistance means no limit.
+func (x *Index) Nearest(hash *goimagehash.ExtImageHash, k, maxDistance int) []Match {
+	if hash == nil || k <= 0 {
+		return nil
+	}
+	if maxDistance < 0 {
+		maxDistance = hash.Bits()
+	}
+	// Grow the radius until k entries are found, so that close matches in
+	// a large index do not require visiting the whole tree.
+	for radius := 0; ; radius = radius*2 + 1 {
+		if radius > maxDistance {
+			radius = maxDistance
+		}
+		matches := x.Within(hash, radius)
+		if len(matches) >= k || radius == maxDistance {
+			if len(matches) > k {
+				matches = matches[:k]
+			}
+			return matches
+		}
+	}
+}
+
+func sortMatches(matches []Match) {
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Distance != matches[j].Distance {
+			return matches[i].Distance < matches[j].Distance
+		}
+		return matches[i].ID < matches[j].ID
+	})
+}
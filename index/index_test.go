@@ -0,0 +1,97 @@
+// Copyright 2017 The goimagehash Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package index
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/lollipopkit/goimagehash"
+)
+
+func randomHash(r *rand.Rand, kind goimagehash.Kind) *goimagehash.ExtImageHash {
+	return goimagehash.NewExtImageHash([]uint64{r.Uint64()}, kind, 64)
+}
+
+func TestIndexWithin(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	x := New()
+	var entries []Entry
+	for i := 0; i < 500; i++ {
+		e := Entry{fmt.Sprintf("img%03d", i), randomHash(r, goimagehash.PHash)}
+		entries = append(entries, e)
+		if err := x.Add(e.ID, e.Hash); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}
+	x.Add("other", goimagehash.NewExtImageHash([]uint64{0}, goimagehash.AHash, 64))
+	if x.Len() != 501 {
+		t.Errorf("Expected 501 entries but got %d", x.Len())
+	}
+
+	for _, maxDistance := range []int{0, 20, 28, 64} {
+		query := entries[7].Hash
+		var expected []string
+		for _, e := range entries {
+			if d, _ := query.Distance(e.Hash); d <= maxDistance {
+				expected = append(expected, e.ID)
+			}
+		}
+		matches := x.Within(query, maxDistance)
+		var got []string
+		for i, m := range matches {
+			got = append(got, m.ID)
+			if i > 0 && m.Distance < matches[i-1].Distance {
+				t.Errorf("Matches should be sorted by distance")
+			}
+		}
+		sort.Strings(got)
+		if fmt.Sprint(got) != fmt.Sprint(expected) {
+			t.Errorf("Within(%d): expected %v but got %v", maxDistance, expected, got)
+		}
+	}
+
+	nearest := x.Nearest(entries[3].Hash, 5, -1)
+	if len(nearest) != 5 || nearest[0].ID != "img003" || nearest[0].Distance != 0 {
+		t.Errorf("Unexpected nearest matches %v", nearest)
+	}
+	if n := x.Nearest(entries[3].Hash, 5, 0); len(n) != 1 {
+		t.Errorf("Expected only the exact match but got %v", n)
+	}
+}
+
+func TestIndexRemove(t *testing.T) {
+	r := rand.New(rand.NewSource(2))
+	x := New()
+	for i := 0; i < 50; i++ {
+		x.Add(fmt.Sprint(i), randomHash(r, goimagehash.DHash))
+	}
+	kept, _ := x.Get("49")
+	for i := 0; i < 40; i++ {
+		if !x.Remove(fmt.Sprint(i)) {
+			t.Errorf("Remove(%d) should report an existing entry", i)
+		}
+	}
+	if x.Remove("0") {
+		t.Errorf("Remove should report a missing entry")
+	}
+	if x.Len() != 10 || len(x.Within(kept, 64)) != 10 {
+		t.Errorf("Expected 10 remaining entries but got %d", x.Len())
+	}
+
+	// Adding an existing identifier replaces its hash.
+	x.Add("49", goimagehash.NewExtImageHash([]uint64{0}, goimagehash.DHash, 64))
+	if m := x.Within(kept, 0); len(m) != 0 {
+		t.Errorf("Replaced hash should not match anymore, got %v", m)
+	}
+	if x.Len() != 10 {
+		t.Errorf("Expected 10 entries but got %d", x.Len())
+	}
+	if err := x.Add("nil", nil); err == nil {
+		t.Errorf("Should got error for nil hash")
+	}
+}
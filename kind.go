@@ -0,0 +1,66 @@
+// Copyright 2017 The goimagehash Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package goimagehash
+
+import "fmt"
+
+type kindInfo struct {
+	code string
+	name string
+}
+
+// kindInfos holds the string representation of every Kind.
+// New kinds must be registered here with a unique one letter code.
+var kindInfos = [...]kindInfo{
+	Unknown: {"u", "unknown"},
+	AHash:   {"a", "average"},
+	PHash:   {"p", "perception"},
+	DHash:   {"d", "difference"},
+	WHash:   {"w", "wavelet"},
+	DGHash:  {"g", "double-gradient"},
+}
+
+func (k Kind) valid() bool {
+	return k >= 0 && int(k) < len(kindInfos)
+}
+
+// Code method returns the one letter code of the kind used by the string
+// encoding of hashes.
+func (k Kind) Code() string {
+	if !k.valid() {
+		return ""
+	}
+	return kindInfos[k].code
+}
+
+// String method returns the name of the kind.
+func (k Kind) String() string {
+	if !k.valid() {
+		return fmt.Sprintf("Kind(%d)", int(k))
+	}
+	return kindInfos[k].name
+}
+
+// ParseKind function returns the kind of the given code or name.
+func ParseKind(s string) (Kind, error) {
+	for k, info := range kindInfos {
+		if s == info.code || s == info.name {
+			return Kind(k), nil
+		}
+	}
+	return Unknown, fmt.Errorf("unknown hash kind %q", s)
+}
+
+// BitOrder describes how the logical bits of a hash are packed into bytes.
+type BitOrder int
+
+const (
+	// MSBFirst packs bit i at position 7-i%8 of byte i/8.
+	// It is the canonical order used by Bytes and String.
+	MSBFirst BitOrder = iota
+	// LSBFirst packs bit i at position i%8 of byte i/8 like the Rust
+	// img_hash library. ToBase64 uses this order.
+	LSBFirst
+)
@@ -0,0 +1,10 @@
+// Copyright 2017 The goimagehash Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package server provides an http.Handler that hashes uploaded images,
+// compares them, and stores their hashes in an index answering nearest
+// neighbour queries. Responses are JSON, request bodies and the number of
+// images decoded at once are limited, and health and metrics endpoints
+// are included so that the handler can be embedded in existing services.
+package server
@@ -0,0 +1,700 @@
+// Copyright 2017 The goimagehash Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lollipopkit/goimagehash"
+	"github.com/lollipopkit/goimagehash/index"
+)
+
+// DefaultMaxBodyBytes is the default limit of the size of request bodies.
+const DefaultMaxBodyBytes = 32 << 20
+
+// DefaultMaxPixels is the default limit of the number of pixels of uploaded
+// images, about 64 megapixels.
+const DefaultMaxPixels = 64 << 20
+
+// Options configures a Handler. The zero value is usable.
+type Options struct {
+	// Algorithm hashes the images of requests that do not name an
+	// algorithm. Its zero value means perception:8x8.
+	Algorithm goimagehash.Algorithm
+	// MaxBodyBytes limits the size of request bodies; larger requests are
+	// rejected with 413. Zero means DefaultMaxBodyBytes.
+	MaxBodyBytes int64
+	// MaxPixels limits the width times the height of uploaded images,
+	// checked before decoding them, as a small compressed image can
+	// decode to gigabytes; larger images are rejected with 413. Zero means
+	// DefaultMaxPixels.
+	MaxPixels int64
+	// MaxConcurrent limits the number of requests decoding or searching at
+	// once; further requests are rejected with 503. Zero means the number
+	// of CPUs.
+	MaxConcurrent int
+	// Index holds the indexed hashes. Nil means a new index, loaded from
+	// IndexPath when that file exists.
+	Index *index.Index
+	// IndexPath, when set, is the file the index is saved to after every
+	// change. Added hashes are appended to it; it is rewritten on removals
+	// and once the appended hashes are as many as the indexed ones.
+	IndexPath string
+	// Decode decodes uploaded images. Nil means image.Decode, for which
+	// the decoders of the supported formats must be registered by the
+	// caller.
+	Decode func(r io.Reader) (image.Image, string, error)
+	// DecodeConfig decodes the dimensions of uploaded images, for the
+	// formats of Decode. Nil means image.DecodeConfig.
+	DecodeConfig func(r io.Reader) (image.Config, string, error)
+}
+
+// Handler serves the following endpoints:
+//
+//	GET    /healthz   health check
+//	GET    /metrics   request counters in the Prometheus text format
+//	POST   /hash      hashes of an image
+//	POST   /compare   distance between two images or hashes
+//	GET    /index     number of indexed hashes
+//	POST   /index     adds the hash of an image, or a hash, under an id
+//	DELETE /index     removes the hash stored under an id
+//	GET    /search    nearest indexed hashes of a hash
+//	POST   /search    nearest indexed hashes of an image or a hash
+//
+// Images are sent as the request body or as multipart form files, and
+// hashes in their canonical form. Parameters are read from the query string
+// and from multipart form fields. A Handler is safe for concurrent use.
+type Handler struct {
+	opts    Options
+	mux     *http.ServeMux
+	slots   chan struct{}
+	start   time.Time
+	metrics metrics
+
+	mu    sync.RWMutex
+	index *index.Index
+	// appended is the number of entries appended to IndexPath since it
+	// was last written, or -1 when it does not hold the index yet.
+	appended int
+}
+
+// New function returns a handler configured by opts.
+func New(opts Options) (*Handler, error) {
+	if opts.Algorithm == (goimagehash.Algorithm{}) {
+		opts.Algorithm = goimagehash.Algorithm{Kind: goimagehash.PHash, Width: 8, Height: 8}
+	}
+	if err := opts.Algorithm.Validate(); err != nil {
+		return nil, err
+	}
+	if opts.MaxBodyBytes <= 0 {
+		opts.MaxBodyBytes = DefaultMaxBodyBytes
+	}
+	if opts.MaxConcurrent <= 0 {
+		opts.MaxConcurrent = runtime.NumCPU()
+	}
+	if opts.MaxPixels <= 0 {
+		opts.MaxPixels = DefaultMaxPixels
+	}
+	if opts.Decode == nil {
+		opts.Decode = image.Decode
+	}
+	if opts.DecodeConfig == nil {
+		opts.DecodeConfig = image.DecodeConfig
+	}
+	appended := 0
+	if opts.Index != nil {
+		appended = -1
+	}
+	x := opts.Index
+	if x == nil && opts.IndexPath != "" {
+		var err error
+		x, err = index.Load(opts.IndexPath)
+		if errors.Is(err, os.ErrNotExist) {
+			x, err = nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if x == nil {
+		x = index.New()
+	}
+
+	h := &Handler{
+		opts:     opts,
+		mux:      http.NewServeMux(),
+		slots:    make(chan struct{}, opts.MaxConcurrent),
+		start:    time.Now(),
+		metrics:  metrics{requests: make(map[requestKey]uint64)},
+		index:    x,
+		appended: appended,
+	}
+	h.handle("GET /healthz", "healthz", false, h.serveHealth)
+	h.handle("GET /metrics", "metrics", false, h.serveMetrics)
+	h.handle("POST /hash", "hash", true, h.serveHash)
+	h.handle("POST /compare", "compare", true, h.serveCompare)
+	h.handle("GET /index", "index", false, h.serveIndexStats)
+	h.handle("POST /index", "index", true, h.serveIndexAdd)
+	h.handle("DELETE /index", "index", false, h.serveIndexRemove)
+	h.handle("GET /search", "search", true, h.serveSearch)
+	h.handle("POST /search", "search", true, h.serveSearch)
+	return h, nil
+}
+
+// ServeHTTP method implements http.Handler.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+// Len method returns the number of indexed hashes.
+func (h *Handler) Len() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.index.Len()
+}
+
+// httpError is an error with the status code of its response.
+type httpError struct {
+	status int
+	err    error
+}
+
+func (e *httpError) Error() string {
+	return e.err.Error()
+}
+
+func badRequest(format string, args ...interface{}) error {
+	return &httpError{http.StatusBadRequest, fmt.Errorf(format, args...)}
+}
+
+// statusOf returns the status code of the response to err.
+func statusOf(err error) int {
+	var he *httpError
+	if errors.As(err, &he) {
+		return he.status
+	}
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusInternalServerError
+}
+
+// statusWriter records the status code of a response.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// handle registers fn under pattern. Limited handlers only run while fewer
+// than MaxConcurrent limited requests are being served.
+func (h *Handler) handle(pattern, endpoint string, limited bool, fn func(r *http.Request) (interface{}, error)) {
+	h.mux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		defer func() { h.metrics.count(endpoint, sw.status) }()
+
+		if limited {
+			select {
+			case h.slots <- struct{}{}:
+				defer func() { <-h.slots }()
+			default:
+				h.metrics.reject()
+				sw.Header().Set("Retry-After", "1")
+				writeJSON(sw, http.StatusServiceUnavailable, errorResponse{"too many concurrent requests"})
+				return
+			}
+		}
+		r.Body = http.MaxBytesReader(sw, r.Body, h.opts.MaxBodyBytes)
+		defer func() {
+			if r.MultipartForm != nil {
+				r.MultipartForm.RemoveAll()
+			}
+		}()
+
+		resp, err := fn(r)
+		if err != nil {
+			writeJSON(sw, statusOf(err), errorResponse{err.Error()})
+			return
+		}
+		if text, ok := resp.(metricsResponse); ok {
+			sw.Header().Set("Content-Type", "text/plain; version=0.0.4")
+			io.WriteString(sw, string(text))
+			return
+		}
+		writeJSON(sw, http.StatusOK, resp)
+	})
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// isMultipart reports whether the request body is a multipart form.
+func isMultipart(r *http.Request) bool {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return mediaType == "multipart/form-data"
+}
+
+// parseForm parses the query and, for multipart requests, the form fields
+// and files of r. The body of other requests is left for decodeImage, even
+// when it claims to be URL encoded as curl --data-binary does.
+func (h *Handler) parseForm(r *http.Request) error {
+	if !isMultipart(r) {
+		r.Form, r.PostForm = r.URL.Query(), url.Values{}
+		return nil
+	}
+	memory := h.opts.MaxBodyBytes
+	if memory > 8<<20 {
+		memory = 8 << 20
+	}
+	if err := r.ParseMultipartForm(memory); err != nil {
+		if statusOf(err) == http.StatusRequestEntityTooLarge {
+			return err
+		}
+		return badRequest("invalid form: %v", err)
+	}
+	return nil
+}
+
+// decodeImage decodes the image of the multipart file field or, for the
+// "image" field of a request that is not a form, the request body. It
+// reports false when the request holds no such image. Images larger than
+// MaxPixels are rejected before being decoded.
+func (h *Handler) decodeImage(r *http.Request, field string) (image.Image, string, bool, error) {
+	var src io.Reader
+	if isMultipart(r) {
+		f, _, err := r.FormFile(field)
+		if errors.Is(err, http.ErrMissingFile) {
+			return nil, "", false, nil
+		}
+		if err != nil {
+			return nil, "", false, err
+		}
+		defer f.Close()
+		src = f
+	} else {
+		if field != "image" || r.Method == http.MethodGet || r.ContentLength == 0 {
+			return nil, "", false, nil
+		}
+		src = r.Body
+	}
+	// The header read by DecodeConfig is decoded again by Decode.
+	var header bytes.Buffer
+	config, _, err := h.opts.DecodeConfig(io.TeeReader(src, &header))
+	if err != nil {
+		return nil, "", false, decodeError(field, err)
+	}
+	if pixels := int64(config.Width) * int64(config.Height); pixels > h.opts.MaxPixels {
+		return nil, "", false, &httpError{http.StatusRequestEntityTooLarge,
+			fmt.Errorf("%s of %dx%d pixels is larger than %d pixels", field, config.Width, config.Height, h.opts.MaxPixels)}
+	}
+	img, format, err := h.opts.Decode(io.MultiReader(&header, src))
+	if err != nil {
+		return nil, "", false, decodeError(field, err)
+	}
+	return img, format, true, nil
+}
+
+// decodeError returns the error of a failure to decode the image of field.
+func decodeError(field string, err error) error {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return err
+	}
+	return badRequest("failed to decode %s: %v", field, err)
+}
+
+// algorithms returns the algorithms named by the algorithm parameters of
+// r, repeated or comma separated, or the default algorithm.
+func (h *Handler) algorithms(r *http.Request) ([]goimagehash.Algorithm, error) {
+	var algorithms []goimagehash.Algorithm
+	for _, value := range r.Form["algorithm"] {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name == "" {
+				continue
+			}
+			a, err := goimagehash.ParseAlgorithm(name)
+			if err != nil {
+				return nil, badRequest("%v", err)
+			}
+			algorithms = append(algorithms, a)
+		}
+	}
+	if len(algorithms) == 0 {
+		algorithms = append(algorithms, h.opts.Algorithm)
+	}
+	return algorithms, nil
+}
+
+// algorithm returns the single algorithm named by r.
+func (h *Handler) algorithm(r *http.Request) (goimagehash.Algorithm, error) {
+	algorithms, err := h.algorithms(r)
+	if err != nil {
+		return goimagehash.Algorithm{}, err
+	}
+	if len(algorithms) > 1 {
+		return goimagehash.Algorithm{}, badRequest("only one algorithm can be used")
+	}
+	return algorithms[0], nil
+}
+
+// imageOrHash returns the hash given by the hashField parameter of r, or
+// the hash of the image in imageField.
+func (h *Handler) imageOrHash(r *http.Request, imageField, hashField string) (*goimagehash.ExtImageHash, error) {
+	if s := r.FormValue(hashField); s != "" {
+		hash, err := goimagehash.ParseExtImageHash(s)
+		if err != nil {
+			return nil, badRequest("invalid %s: %v", hashField, err)
+		}
+		return hash, nil
+	}
+	a, err := h.algorithm(r)
+	if err != nil {
+		return nil, err
+	}
+	img, _, ok, err := h.decodeImage(r, imageField)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, badRequest("missing %s or %s", imageField, hashField)
+	}
+	return a.Hash(img)
+}
+
+// intParam returns the integer parameter name of r, or def when it is not
+// set.
+func intParam(r *http.Request, name string, def int) (int, error) {
+	s := r.FormValue(name)
+	if s == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, badRequest("invalid %s %q", name, s)
+	}
+	return n, nil
+}
+
+// HashResult is a hash computed by the server.
+type HashResult struct {
+	Algorithm string `json:"algorithm"`
+	Bits      int    `json:"bits"`
+	Hash      string `json:"hash"`
+}
+
+func newHashResult(a goimagehash.Algorithm, hash *goimagehash.ExtImageHash) HashResult {
+	return HashResult{Algorithm: a.String(), Bits: hash.Bits(), Hash: hash.String()}
+}
+
+// HashResponse is the response of /hash.
+type HashResponse struct {
+	Format string       `json:"format"`
+	Width  int          `json:"width"`
+	Height int          `json:"height"`
+	Hashes []HashResult `json:"hashes"`
+}
+
+// CompareResponse is the response of /compare.
+type CompareResponse struct {
+	Algorithm  string  `json:"algorithm,omitempty"`
+	Bits       int     `json:"bits"`
+	Hash1      string  `json:"hash1"`
+	Hash2      string  `json:"hash2"`
+	Distance   int     `json:"distance"`
+	Similarity float64 `json:"similarity"`
+	Threshold  int     `json:"threshold"`
+	Similar    bool    `json:"similar"`
+}
+
+// IndexResponse is the response of /index.
+type IndexResponse struct {
+	ID      string `json:"id,omitempty"`
+	Hash    string `json:"hash,omitempty"`
+	Removed bool   `json:"removed,omitempty"`
+	Size    int    `json:"size"`
+}
+
+// Match is an indexed hash found by /search.
+type Match struct {
+	ID       string `json:"id"`
+	Hash     string `json:"hash"`
+	Distance int    `json:"distance"`
+}
+
+// SearchResponse is the response of /search.
+type SearchResponse struct {
+	Hash    string  `json:"hash"`
+	Matches []Match `json:"matches"`
+}
+
+func (h *Handler) serveHealth(r *http.Request) (interface{}, error) {
+	return map[string]string{"status": "ok"}, nil
+}
+
+func (h *Handler) serveHash(r *http.Request) (interface{}, error) {
+	if err := h.parseForm(r); err != nil {
+		return nil, err
+	}
+	algorithms, err := h.algorithms(r)
+	if err != nil {
+		return nil, err
+	}
+	img, format, ok, err := h.decodeImage(r, "image")
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, badRequest("missing image")
+	}
+	bounds := img.Bounds()
+	resp := HashResponse{Format: format, Width: bounds.Dx(), Height: bounds.Dy()}
+	for _, a := range algorithms {
+		hash, err := a.Hash(img)
+		if err != nil {
+			return nil, badRequest("%s: %v", a, err)
+		}
+		resp.Hashes = append(resp.Hashes, newHashResult(a, hash))
+	}
+	return resp, nil
+}
+
+func (h *Handler) serveCompare(r *http.Request) (interface{}, error) {
+	if err := h.parseForm(r); err != nil {
+		return nil, err
+	}
+	hash1, err := h.imageOrHash(r, "image1", "hash1")
+	if err != nil {
+		return nil, err
+	}
+	hash2, err := h.imageOrHash(r, "image2", "hash2")
+	if err != nil {
+		return nil, err
+	}
+	distance, err := hash1.Distance(hash2)
+	if err != nil {
+		return nil, badRequest("%v", err)
+	}
+	similarity, err := hash1.Similarity(hash2)
+	if err != nil {
+		return nil, badRequest("%v", err)
+	}
+	threshold, err := intParam(r, "threshold", goimagehash.RecommendedThreshold(hash1.GetKind(), hash1.Bits()))
+	if err != nil {
+		return nil, err
+	}
+	resp := CompareResponse{
+		Bits:       hash1.Bits(),
+		Hash1:      hash1.String(),
+		Hash2:      hash2.String(),
+		Distance:   distance,
+		Similarity: similarity,
+		Threshold:  threshold,
+		Similar:    distance <= threshold,
+	}
+	if r.FormValue("hash1") == "" || r.FormValue("hash2") == "" {
+		a, _ := h.algorithm(r)
+		resp.Algorithm = a.String()
+	}
+	return resp, nil
+}
+
+func (h *Handler) serveIndexStats(r *http.Request) (interface{}, error) {
+	return IndexResponse{Size: h.Len()}, nil
+}
+
+func (h *Handler) serveIndexAdd(r *http.Request) (interface{}, error) {
+	if err := h.parseForm(r); err != nil {
+		return nil, err
+	}
+	id := r.FormValue("id")
+	if id == "" {
+		return nil, badRequest("missing id")
+	}
+	hash, err := h.imageOrHash(r, "image", "hash")
+	if err != nil {
+		return nil, err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	old, replaced := h.index.Get(id)
+	if err := h.index.Add(id, hash); err != nil {
+		return nil, err
+	}
+	if err := h.saveAdded(id, hash); err != nil {
+		// Keep the index as saved in IndexPath.
+		if replaced {
+			h.index.Add(id, old)
+		} else {
+			h.index.Remove(id)
+		}
+		return nil, err
+	}
+	return IndexResponse{ID: id, Hash: hash.String(), Size: h.index.Len()}, nil
+}
+
+func (h *Handler) serveIndexRemove(r *http.Request) (interface{}, error) {
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		return nil, badRequest("missing id")
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	old, _ := h.index.Get(id)
+	removed := h.index.Remove(id)
+	if removed {
+		if err := h.save(); err != nil {
+			// Keep the index as saved in IndexPath.
+			h.index.Add(id, old)
+			return nil, err
+		}
+	}
+	return IndexResponse{ID: id, Removed: removed, Size: h.index.Len()}, nil
+}
+
+// save writes the index to IndexPath, if set. The caller must hold mu.
+func (h *Handler) save() error {
+	if h.opts.IndexPath == "" {
+		return nil
+	}
+	if err := h.index.Save(h.opts.IndexPath); err != nil {
+		return fmt.Errorf("failed to save index: %w", err)
+	}
+	h.appended = 0
+	return nil
+}
+
+// saveAdded appends the entry added under id to IndexPath, if set, rather
+// than rewriting the whole file. The file is rewritten instead when it does
+// not hold the index yet, or once the entries appended to it are as many as
+// those of the index, so that replaced entries never fill most of it. The
+// caller must hold mu.
+func (h *Handler) saveAdded(id string, hash *goimagehash.ExtImageHash) error {
+	if h.opts.IndexPath == "" {
+		return nil
+	}
+	if h.appended < 0 || h.appended >= h.index.Len() {
+		return h.save()
+	}
+	if err := index.Append(h.opts.IndexPath, id, hash); err != nil {
+		return fmt.Errorf("failed to save index: %w", err)
+	}
+	h.appended++
+	return nil
+}
+
+func (h *Handler) serveSearch(r *http.Request) (interface{}, error) {
+	if err := h.parseForm(r); err != nil {
+		return nil, err
+	}
+	k, err := intParam(r, "k", 10)
+	if err != nil {
+		return nil, err
+	}
+	maxDistance, err := intParam(r, "max_distance", -1)
+	if err != nil {
+		return nil, err
+	}
+	hash, err := h.imageOrHash(r, "image", "hash")
+	if err != nil {
+		return nil, err
+	}
+
+	h.mu.RLock()
+	matches := h.index.Nearest(hash, k, maxDistance)
+	h.mu.RUnlock()
+	resp := SearchResponse{Hash: hash.String(), Matches: []Match{}}
+	for _, m := range matches {
+		resp.Matches = append(resp.Matches, Match{ID: m.ID, Hash: m.Hash.String(), Distance: m.Distance})
+	}
+	return resp, nil
+}
+
+// requestKey identifies a request counter.
+type requestKey struct {
+	endpoint string
+	status   int
+}
+
+// metrics counts the requests served by a Handler.
+type metrics struct {
+	mu       sync.Mutex
+	requests map[requestKey]uint64
+	rejected uint64
+}
+
+func (m *metrics) count(endpoint string, status int) {
+	m.mu.Lock()
+	m.requests[requestKey{endpoint, status}]++
+	m.mu.Unlock()
+}
+
+func (m *metrics) reject() {
+	m.mu.Lock()
+	m.rejected++
+	m.mu.Unlock()
+}
+
+// metricsResponse is a response in the Prometheus text format rather than
+// JSON.
+type metricsResponse string
+
+func (h *Handler) serveMetrics(r *http.Request) (interface{}, error) {
+	var sb strings.Builder
+	h.metrics.mu.Lock()
+	keys := make([]requestKey, 0, len(h.metrics.requests))
+	for k := range h.metrics.requests {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].endpoint != keys[j].endpoint {
+			return keys[i].endpoint < keys[j].endpoint
+		}
+		return keys[i].status < keys[j].status
+	})
+	sb.WriteString("# TYPE goimagehash_requests_total counter\n")
+	for _, k := range keys {
+		fmt.Fprintf(&sb, "goimagehash_requests_total{endpoint=%q,code=\"%d\"} %d\n", k.endpoint, k.status, h.metrics.requests[k])
+	}
+	sb.WriteString("# TYPE goimagehash_requests_rejected_total counter\n")
+	fmt.Fprintf(&sb, "goimagehash_requests_rejected_total %d\n", h.metrics.rejected)
+	h.metrics.mu.Unlock()
+
+	sb.WriteString("# TYPE goimagehash_requests_in_flight gauge\n")
+	fmt.Fprintf(&sb, "goimagehash_requests_in_flight %d\n", len(h.slots))
+	sb.WriteString("# TYPE goimagehash_index_entries gauge\n")
+	fmt.Fprintf(&sb, "goimagehash_index_entries %d\n", h.Len())
+	sb.WriteString("# TYPE goimagehash_uptime_seconds gauge\n")
+	fmt.Fprintf(&sb, "goimagehash_uptime_seconds %.0f\n", time.Since(h.start).Seconds())
+	return metricsResponse(sb.String()), nil
+}
@@ -0,0 +1,357 @@
+// Copyright 2017 The goimagehash Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/color"
+	_ "image/jpeg"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/lollipopkit/goimagehash"
+)
+
+// testImage returns a PNG encoded gradient, shifted by offset.
+func testImage(t *testing.T, offset int) []byte {
+	img := image.NewGray(image.Rect(0, 0, 64, 64))
+	for y := 0; y < 64; y++ {
+		for x := 0; x < 64; x++ {
+			img.SetGray(x, y, color.Gray{uint8((x*x + y*3 + offset) % 256)})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("%v", err)
+	}
+	return buf.Bytes()
+}
+
+func loadSample(t *testing.T, name string) []byte {
+	data, err := os.ReadFile(filepath.Join("..", "_examples", name))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	return data
+}
+
+// multipartBody returns a multipart form holding files and fields.
+func multipartBody(t *testing.T, files map[string][]byte, fields map[string]string) (io.Reader, string) {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	for name, data := range files {
+		fw, err := mw.CreateFormFile(name, name+".png")
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		fw.Write(data)
+	}
+	for name, value := range fields {
+		mw.WriteField(name, value)
+	}
+	mw.Close()
+	return &buf, mw.FormDataContentType()
+}
+
+func do(t *testing.T, h http.Handler, method, target string, body io.Reader, contentType string, v interface{}) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, body)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if v != nil && rec.Code == http.StatusOK {
+		if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+			t.Fatalf("%s %s: %v in %q", method, target, err, rec.Body.String())
+		}
+	}
+	return rec
+}
+
+func newHandler(t *testing.T, opts Options) *Handler {
+	h, err := New(opts)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	return h
+}
+
+func TestHash(t *testing.T) {
+	h := newHandler(t, Options{})
+	data := testImage(t, 0)
+	img, _ := png.Decode(bytes.NewReader(data))
+
+	var resp HashResponse
+	rec := do(t, h, "POST", "/hash", bytes.NewReader(data), "image/png", &resp)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200 but got %d: %s", rec.Code, rec.Body)
+	}
+	expected, _ := goimagehash.Algorithm{Kind: goimagehash.PHash}.Hash(img)
+	if resp.Format != "png" || resp.Width != 64 || resp.Height != 64 || len(resp.Hashes) != 1 || resp.Hashes[0].Hash != expected.String() {
+		t.Errorf("Unexpected response %+v, expected hash %s", resp, expected)
+	}
+
+	body, ct := multipartBody(t, map[string][]byte{"image": data}, map[string]string{"algorithm": "ahash,dgrad:16x16"})
+	rec = do(t, h, "POST", "/hash?algorithm=dhash", body, ct, &resp)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200 but got %d: %s", rec.Code, rec.Body)
+	}
+	var algorithms []string
+	for _, r := range resp.Hashes {
+		algorithms = append(algorithms, r.Algorithm)
+	}
+	if got := strings.Join(algorithms, ","); got != "difference:8x8,average:8x8,double-gradient:16x16" {
+		t.Errorf("Unexpected algorithms %s", got)
+	}
+	if resp.Hashes[2].Bits != 144 {
+		t.Errorf("Expected 144 bits but got %d", resp.Hashes[2].Bits)
+	}
+
+	for _, tt := range []struct {
+		target string
+		body   []byte
+		status int
+	}{
+		{"/hash", nil, http.StatusBadRequest},
+		{"/hash", []byte("not an image"), http.StatusBadRequest},
+		{"/hash?algorithm=nope", data, http.StatusBadRequest},
+		{"/hash?algorithm=phash:3x3", data, http.StatusBadRequest},
+	} {
+		var e errorResponse
+		rec := do(t, h, "POST", tt.target, bytes.NewReader(tt.body), "image/png", nil)
+		json.Unmarshal(rec.Body.Bytes(), &e)
+		if rec.Code != tt.status || e.Error == "" {
+			t.Errorf("%s: expected %d with an error but got %d: %s", tt.target, tt.status, rec.Code, rec.Body)
+		}
+	}
+	if rec := do(t, h, "GET", "/hash", nil, "", nil); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405 but got %d", rec.Code)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	h := newHandler(t, Options{})
+	sample1, sample2 := loadSample(t, "sample1.jpg"), loadSample(t, "sample2.jpg")
+
+	var resp CompareResponse
+	body, ct := multipartBody(t, map[string][]byte{"image1": sample1, "image2": sample1}, nil)
+	if rec := do(t, h, "POST", "/compare", body, ct, &resp); rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200 but got %d: %s", rec.Code, rec.Body)
+	}
+	if resp.Distance != 0 || !resp.Similar || resp.Similarity != 1 || resp.Algorithm != "perception:8x8" {
+		t.Errorf("Unexpected response %+v", resp)
+	}
+
+	body, ct = multipartBody(t, map[string][]byte{"image1": sample1, "image2": sample2}, map[string]string{"threshold": "5"})
+	if rec := do(t, h, "POST", "/compare", body, ct, &resp); rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200 but got %d: %s", rec.Code, rec.Body)
+	}
+	if resp.Distance <= 5 || resp.Similar || resp.Threshold != 5 {
+		t.Errorf("Unexpected response %+v", resp)
+	}
+
+	resp = CompareResponse{}
+	if rec := do(t, h, "POST", "/compare?hash1=p:00000000000000ff&hash2=p:000000000000000f", nil, "", &resp); rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200 but got %d: %s", rec.Code, rec.Body)
+	}
+	if resp.Distance != 4 || resp.Algorithm != "" {
+		t.Errorf("Unexpected response %+v", resp)
+	}
+
+	body, ct = multipartBody(t, nil, map[string]string{"hash1": "p:00000000000000ff", "hash2": "a:000000000000000f"})
+	if rec := do(t, h, "POST", "/compare", body, ct, nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for hashes of different kinds but got %d", rec.Code)
+	}
+	if rec := do(t, h, "POST", "/compare", bytes.NewReader(sample1), "image/jpeg", nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 without a second image but got %d", rec.Code)
+	}
+}
+
+func TestIndexAndSearch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "index.jsonl")
+	h := newHandler(t, Options{IndexPath: path, Algorithm: goimagehash.Algorithm{Kind: goimagehash.AHash}})
+
+	var added IndexResponse
+	for i, name := range []string{"sample1.jpg", "sample2.jpg", "sample3.jpg", "sample4.jpg"} {
+		rec := do(t, h, "POST", "/index?id="+name, bytes.NewReader(loadSample(t, name)), "image/jpeg", &added)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected 200 but got %d: %s", rec.Code, rec.Body)
+		}
+		if added.ID != name || added.Size != i+1 || !strings.HasPrefix(added.Hash, "a:") {
+			t.Errorf("Unexpected response %+v", added)
+		}
+	}
+	if rec := do(t, h, "POST", "/index?id=zero&hash=a:0000000000000000", nil, "", &added); rec.Code != http.StatusOK || added.Size != 5 {
+		t.Fatalf("Expected 5 entries but got %d: %s", rec.Code, rec.Body)
+	}
+	if rec := do(t, h, "POST", "/index", bytes.NewReader(loadSample(t, "sample1.jpg")), "image/jpeg", nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 without id but got %d", rec.Code)
+	}
+
+	// Added entries are appended to the file rather than rewriting it.
+	if data, err := os.ReadFile(path); err != nil || bytes.Count(data, []byte("\n")) != 5 {
+		t.Errorf("Expected 5 saved entries but got %q, %v", data, err)
+	}
+	if reloaded := newHandler(t, Options{IndexPath: path}); reloaded.Len() != 5 {
+		t.Errorf("Expected 5 entries after reload but got %d", reloaded.Len())
+	}
+
+	var found SearchResponse
+	// curl --data-binary sends images as URL encoded forms.
+	rec := do(t, h, "POST", "/search?k=2", bytes.NewReader(loadSample(t, "sample1.jpg")), "application/x-www-form-urlencoded", &found)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200 but got %d: %s", rec.Code, rec.Body)
+	}
+	if len(found.Matches) != 2 || found.Matches[0].ID != "sample1.jpg" || found.Matches[0].Distance != 0 || found.Matches[1].ID != "sample3.jpg" {
+		t.Errorf("Unexpected matches %+v", found.Matches)
+	}
+	do(t, h, "GET", "/search?hash=a:0000000000000001&max_distance=3", nil, "", &found)
+	if len(found.Matches) != 1 || found.Matches[0].ID != "zero" || found.Matches[0].Distance != 1 {
+		t.Errorf("Unexpected matches %+v", found.Matches)
+	}
+	do(t, h, "GET", "/search?hash=p:0000000000000001", nil, "", &found)
+	if found.Matches == nil || len(found.Matches) != 0 {
+		t.Errorf("Expected an empty list of matches but got %+v", found.Matches)
+	}
+	if rec := do(t, h, "GET", "/search?hash=a:00&k=x", nil, "", nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for invalid k but got %d", rec.Code)
+	}
+
+	var removed IndexResponse
+	do(t, h, "DELETE", "/index?id=zero", nil, "", &removed)
+	if !removed.Removed || removed.Size != 4 {
+		t.Errorf("Unexpected response %+v", removed)
+	}
+	removed = IndexResponse{}
+	do(t, h, "DELETE", "/index?id=zero", nil, "", &removed)
+	if removed.Removed || removed.Size != 4 {
+		t.Errorf("Should not remove a missing entry twice")
+	}
+
+	// The index is saved after every change and loaded by a new handler.
+	reloaded := newHandler(t, Options{IndexPath: path})
+	var stats IndexResponse
+	do(t, reloaded, "GET", "/index", nil, "", &stats)
+	if stats.Size != 4 {
+		t.Errorf("Expected 4 entries after reload but got %d", stats.Size)
+	}
+
+	// A change that can not be saved is undone.
+	os.Remove(path)
+	if err := os.MkdirAll(filepath.Join(path, "busy"), 0755); err != nil {
+		t.Fatalf("%v", err)
+	}
+	if rec := do(t, h, "POST", "/index?id=zero&hash=a:0000000000000000", nil, "", nil); rec.Code == http.StatusOK {
+		t.Errorf("Should got error when the index can not be saved")
+	}
+	if rec := do(t, h, "POST", "/index?id=sample1.jpg&hash=a:0000000000000000", nil, "", nil); rec.Code == http.StatusOK {
+		t.Errorf("Should got error when the index can not be saved")
+	}
+	if rec := do(t, h, "DELETE", "/index?id=sample2.jpg", nil, "", nil); rec.Code == http.StatusOK {
+		t.Errorf("Should got error when the index can not be saved")
+	}
+	if _, ok := h.index.Get("zero"); ok || h.Len() != 4 {
+		t.Errorf("Expected the 4 saved entries but got %d", h.Len())
+	}
+	if hash, ok := h.index.Get("sample1.jpg"); !ok || hash.String() == "a:0000000000000000" {
+		t.Errorf("Expected the saved hash of sample1.jpg but got %v", hash)
+	}
+	if _, ok := h.index.Get("sample2.jpg"); !ok {
+		t.Errorf("Expected sample2.jpg to stay indexed")
+	}
+}
+
+func TestLimits(t *testing.T) {
+	data := testImage(t, 0)
+	h := newHandler(t, Options{MaxBodyBytes: int64(len(data) - 1)})
+	rec := do(t, h, "POST", "/hash", bytes.NewReader(data), "image/png", nil)
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected 413 but got %d: %s", rec.Code, rec.Body)
+	}
+	body, ct := multipartBody(t, map[string][]byte{"image": data}, nil)
+	rec = do(t, h, "POST", "/hash", body, ct, nil)
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected 413 for a multipart request but got %d: %s", rec.Code, rec.Body)
+	}
+
+	// Images of too many pixels are rejected before being decoded.
+	h = newHandler(t, Options{MaxPixels: 64*64 - 1, Decode: func(r io.Reader) (image.Image, string, error) {
+		t.Errorf("Should not decode an image of too many pixels")
+		return image.Decode(r)
+	}})
+	rec = do(t, h, "POST", "/hash", bytes.NewReader(data), "image/png", nil)
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected 413 for too many pixels but got %d: %s", rec.Code, rec.Body)
+	}
+	h = newHandler(t, Options{MaxPixels: 64 * 64})
+	if rec := do(t, h, "POST", "/hash", bytes.NewReader(data), "image/png", nil); rec.Code != http.StatusOK {
+		t.Errorf("Expected 200 but got %d: %s", rec.Code, rec.Body)
+	}
+
+	// Block the only slot in the decoder and check that other requests are
+	// rejected rather than queued.
+	started, release := make(chan struct{}), make(chan struct{})
+	h = newHandler(t, Options{MaxConcurrent: 1, Decode: func(r io.Reader) (image.Image, string, error) {
+		close(started)
+		<-release
+		return image.Decode(r)
+	}})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if rec := do(t, h, "POST", "/hash", bytes.NewReader(data), "image/png", nil); rec.Code != http.StatusOK {
+			t.Errorf("Expected 200 but got %d: %s", rec.Code, rec.Body)
+		}
+	}()
+	<-started
+	rec = do(t, h, "POST", "/hash", bytes.NewReader(data), "image/png", nil)
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") == "" {
+		t.Errorf("Expected 503 with Retry-After but got %d", rec.Code)
+	}
+	if rec := do(t, h, "GET", "/healthz", nil, "", nil); rec.Code != http.StatusOK {
+		t.Errorf("Health checks should not be limited but got %d", rec.Code)
+	}
+	close(release)
+	wg.Wait()
+
+	rec = do(t, h, "GET", "/metrics", nil, "", nil)
+	metrics := rec.Body.String()
+	for _, line := range []string{
+		`goimagehash_requests_total{endpoint="hash",code="200"} 1`,
+		`goimagehash_requests_total{endpoint="hash",code="503"} 1`,
+		`goimagehash_requests_total{endpoint="healthz",code="200"} 1`,
+		`goimagehash_requests_rejected_total 1`,
+		`goimagehash_index_entries 0`,
+	} {
+		if !strings.Contains(metrics, line+"\n") {
+			t.Errorf("Metrics should contain %q:\n%s", line, metrics)
+		}
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("Unexpected content type %s", ct)
+	}
+}
+
+func TestNewErrors(t *testing.T) {
+	if _, err := New(Options{Algorithm: goimagehash.Algorithm{Kind: goimagehash.PHash, Width: 3, Height: 3}}); err == nil {
+		t.Errorf("Should got error for an invalid algorithm")
+	}
+	path := filepath.Join(t.TempDir(), "index.jsonl")
+	os.WriteFile(path, []byte("garbage\n"), 0644)
+	if _, err := New(Options{IndexPath: path}); err == nil {
+		t.Errorf("Should got error for an invalid index file")
+	}
+}
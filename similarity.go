@@ -0,0 +1,137 @@
+// Copyright 2017 The goimagehash Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package goimagehash
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// recommendedDistances holds, per kind, the Hamming distance out of 64 bits
+// below which two images are usually considered similar.
+var recommendedDistances = map[Kind]float64{
+	AHash:  6,
+	PHash:  10,
+	DHash:  10,
+	WHash:  10,
+	DGHash: 10,
+}
+
+// RecommendedSimilarity function returns the similarity above which two
+// images hashed with the given kind are usually considered similar.
+func RecommendedSimilarity(kind Kind) float64 {
+	d, ok := recommendedDistances[kind]
+	if !ok {
+		d = 10
+	}
+	return 1 - d/64
+}
+
+// RecommendedThreshold function returns the Hamming distance below which two
+// bits sized hashes of the given kind are usually considered similar.
+func RecommendedThreshold(kind Kind, bits int) int {
+	return int(math.Floor((1-RecommendedSimilarity(kind))*float64(bits) + 1e-9))
+}
+
+func similarity(distance, bits int) float64 {
+	if bits <= 0 {
+		return 0
+	}
+	return 1 - float64(distance)/float64(bits)
+}
+
+// Similarity method returns the normalized similarity 1 - distance/bits
+// between two hashes, from 0 for complementary hashes to 1 for identical
+// ones.
+func (h *ImageHash) Similarity(other *ImageHash) (float64, error) {
+	distance, err := h.Distance(other)
+	if err != nil {
+		return 0, err
+	}
+	return similarity(distance, h.Bits()), nil
+}
+
+// Similarity method returns the normalized similarity 1 - distance/bits
+// between two hashes of the same size, from 0 for complementary hashes to 1
+// for identical ones.
+func (h *ExtImageHash) Similarity(other *ExtImageHash) (float64, error) {
+	if other == nil {
+		return 0, errNoOther
+	}
+	distance, err := h.Distance(other)
+	if err != nil {
+		return 0, err
+	}
+	return similarity(distance, h.Bits()), nil
+}
+
+// squareSize returns the width and height of the hash, inferring a square
+// size from the bit count when they are unknown.
+func (h *ExtImageHash) squareSize() (int, bool) {
+	w, ht := h.Size()
+	if w == 0 && ht == 0 {
+		side := int(math.Sqrt(float64(h.bits)))
+		if side*side != h.bits {
+			return 0, false
+		}
+		return side, true
+	}
+	return w, w == ht && w*ht == h.bits
+}
+
+// Truncate method returns the size x size low frequency block of a square
+// PerceptionHash, which approximates the PerceptionHash of the same image
+// computed with that smaller size. Truncating a 16x16 hash to 8x8 usually
+// differs from the native 8x8 hash by a few bits only, since both keep the
+// same lowest DCT frequencies.
+func (h *ExtImageHash) Truncate(size int) (*ExtImageHash, error) {
+	if h.kind != PHash {
+		return nil, fmt.Errorf("only perception hashes can be truncated, got %v", h.kind)
+	}
+	side, ok := h.squareSize()
+	if !ok {
+		return nil, errors.New("only square perception hashes can be truncated")
+	}
+	if size <= 0 || size > side {
+		return nil, fmt.Errorf("can't truncate %dx%d hash to %dx%d", side, side, size, size)
+	}
+	t := NewExtImageHashWithSize(make([]uint64, wordsFor(size*size)), h.kind, size*size, size, size)
+	for row := 0; row < size; row++ {
+		for col := 0; col < size; col++ {
+			t.SetBit(row*size+col, h.Bit(row*side+col))
+		}
+	}
+	return t, nil
+}
+
+// CrossSimilarity method returns the similarity between two hashes of the
+// same kind which may have different sizes. Hashes of the same size are
+// compared directly, square PerceptionHashes of different sizes are compared
+// after truncating the larger one and other combinations are an error.
+func (h *ExtImageHash) CrossSimilarity(other *ExtImageHash) (float64, error) {
+	if other == nil {
+		return 0, errNoOther
+	}
+	if h.kind != other.kind {
+		return 0, errKindMismatch
+	}
+	if h.bits == other.bits {
+		return h.Similarity(other)
+	}
+	l, r := h, other
+	if l.bits < r.bits {
+		l, r = r, l
+	}
+	side, ok := r.squareSize()
+	if !ok {
+		return 0, fmt.Errorf("can't compare %d and %d bits hashes", h.bits, other.bits)
+	}
+	truncated, err := l.Truncate(side)
+	if err != nil {
+		return 0, err
+	}
+	return truncated.Similarity(r)
+}
@@ -0,0 +1,113 @@
+// Copyright 2017 The goimagehash Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package goimagehash
+
+import (
+	"fmt"
+	"image"
+	"os"
+	"testing"
+)
+
+func TestSimilarity(t *testing.T) {
+	h1 := NewImageHash(0xffff, PHash)
+	h2 := NewImageHash(0xff00, PHash)
+	s, err := h1.Similarity(h2)
+	if err != nil || s != 1-8.0/64 {
+		t.Errorf("Expected similarity %v but got %v, %v", 1-8.0/64, s, err)
+	}
+	if s, _ := h1.Similarity(h1); s != 1 {
+		t.Errorf("Identical hashes should have similarity 1 but got %v", s)
+	}
+	if s, _ := h1.Similarity(h1.Not()); s != 0 {
+		t.Errorf("Complementary hashes should have similarity 0 but got %v", s)
+	}
+	if _, err := h1.Similarity(nil); err != errNoOther {
+		t.Errorf("Expected err %v but got %v", errNoOther, err)
+	}
+
+	ext := NewExtImageHash(make([]uint64, 3), DGHash, 162)
+	other := NewExtImageHash(make([]uint64, 3), DGHash, 162)
+	for i := 0; i < 81; i++ {
+		other.SetBit(i, true)
+	}
+	if s, err := ext.Similarity(other); err != nil || s != 0.5 {
+		t.Errorf("Expected similarity 0.5 but got %v, %v", s, err)
+	}
+	if _, err := ext.Similarity(nil); err != errNoOther {
+		t.Errorf("Expected err %v but got %v", errNoOther, err)
+	}
+}
+
+func TestRecommendedThreshold(t *testing.T) {
+	for _, tt := range []struct {
+		kind      Kind
+		bits      int
+		threshold int
+	}{
+		{AHash, 64, 6},
+		{PHash, 64, 10},
+		{DHash, 64, 10},
+		{PHash, 256, 40},
+		{DGHash, 40, 6},
+		{Unknown, 64, 10},
+	} {
+		if th := RecommendedThreshold(tt.kind, tt.bits); th != tt.threshold {
+			t.Errorf("RecommendedThreshold(%v, %d) is expected %d but got %d", tt.kind, tt.bits, tt.threshold, th)
+		}
+	}
+}
+
+func TestCrossSimilarity(t *testing.T) {
+	for i := 1; i <= 4; i++ {
+		ex := fmt.Sprintf("_examples/sample%d.jpg", i)
+		file, err := os.Open(ex)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		img, _, err := image.Decode(file)
+		file.Close()
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+
+		p8, _ := ExtPerceptionHash(img, 8, 8)
+		p16, _ := ExtPerceptionHash(img, 16, 16)
+		truncated, err := p16.Truncate(8)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		if d, _ := truncated.Distance(p8); d > 4 {
+			t.Errorf("Truncated 16x16 phash of %s should be close to the 8x8 one, got distance %d", ex, d)
+		}
+
+		s, err := p16.CrossSimilarity(p8)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		if s < RecommendedSimilarity(PHash) {
+			t.Errorf("%s should be similar to itself across sizes, got %v", ex, s)
+		}
+		if s2, _ := p8.CrossSimilarity(p16); s2 != s {
+			t.Errorf("CrossSimilarity should be symmetric, got %v vs %v", s, s2)
+		}
+
+		a8, _ := ExtAverageHash(img, 8, 8)
+		a16, _ := ExtAverageHash(img, 16, 16)
+		if _, err := a8.CrossSimilarity(a16); err == nil {
+			t.Errorf("Should got error comparing average hashes of different sizes")
+		}
+		if _, err := p8.CrossSimilarity(a8); err == nil {
+			t.Errorf("Should got error comparing different kinds of hashes")
+		}
+	}
+
+	if _, err := NewExtImageHash(make([]uint64, 1), PHash, 32).Truncate(4); err == nil {
+		t.Errorf("Should got error truncating a non square hash")
+	}
+	if _, err := NewExtImageHash(make([]uint64, 1), PHash, 64).Truncate(9); err == nil {
+		t.Errorf("Should got error truncating to a larger size")
+	}
+}
@@ -0,0 +1,139 @@
+// Copyright 2017 The goimagehash Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package goimagehash
+
+import (
+	"database/sql/driver"
+	"fmt"
+)
+
+// SQLStorage selects how a hash is stored in a SQL column.
+type SQLStorage int
+
+const (
+	// SQLInt64 stores the 64 bits of a hash as a signed BIGINT, so that
+	// databases can compute distances with XOR and bit_count.
+	// Extended hashes must have at most 64 bits.
+	SQLInt64 SQLStorage = iota
+	// SQLBytes stores the bytes returned by Bytes in a BYTEA or BLOB column.
+	SQLBytes
+	// SQLText stores the canonical string encoding in a TEXT column.
+	SQLText
+)
+
+type sqlValuer func() (driver.Value, error)
+
+func (f sqlValuer) Value() (driver.Value, error) {
+	return f()
+}
+
+// Value method implements driver.Valuer storing the hash as SQLInt64.
+func (h *ImageHash) Value() (driver.Value, error) {
+	return h.SQLValue(SQLInt64).Value()
+}
+
+// SQLValue method returns a driver.Valuer storing the hash with the given
+// storage.
+func (h *ImageHash) SQLValue(storage SQLStorage) driver.Valuer {
+	return sqlValuer(func() (driver.Value, error) {
+		switch storage {
+		case SQLInt64:
+			return int64(h.hash), nil
+		case SQLBytes:
+			return h.Bytes(), nil
+		case SQLText:
+			return h.String(), nil
+		}
+		return nil, fmt.Errorf("unknown SQL storage %d", storage)
+	})
+}
+
+// Scan method implements sql.Scanner. Integer and byte columns carry no
+// kind, so the kind of h is kept; text columns hold the canonical string
+// encoding. NULL resets h to the zero ImageHash, of the Unknown kind.
+func (h *ImageHash) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*h = ImageHash{}
+		return nil
+	case int64:
+		h.hash = uint64(v)
+		return nil
+	case []byte:
+		parsed, err := ImageHashFromBytes(v, h.kind)
+		if err != nil {
+			return err
+		}
+		*h = *parsed
+		return nil
+	case string:
+		return h.UnmarshalText([]byte(v))
+	}
+	return fmt.Errorf("cannot scan %T into ImageHash", src)
+}
+
+// Value method implements driver.Valuer storing the hash as SQLBytes.
+func (h *ExtImageHash) Value() (driver.Value, error) {
+	return h.SQLValue(SQLBytes).Value()
+}
+
+// SQLValue method returns a driver.Valuer storing the hash with the given
+// storage.
+func (h *ExtImageHash) SQLValue(storage SQLStorage) driver.Valuer {
+	return sqlValuer(func() (driver.Value, error) {
+		switch storage {
+		case SQLInt64:
+			if h.bits > 64 || len(h.hash) != 1 {
+				return nil, fmt.Errorf("%d bits hash doesn't fit into int64", h.bits)
+			}
+			return int64(h.hash[0]), nil
+		case SQLBytes:
+			return h.Bytes(), nil
+		case SQLText:
+			return h.String(), nil
+		}
+		return nil, fmt.Errorf("unknown SQL storage %d", storage)
+	})
+}
+
+// Scan method implements sql.Scanner. Integer and byte columns carry no
+// kind, so the kind of h is kept. Its bit size is kept too when set,
+// otherwise it is 64 for integers and 8 bits per byte. Text columns hold the
+// canonical string encoding. NULL resets h to the zero ExtImageHash, whose
+// Bits is 0.
+func (h *ExtImageHash) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*h = ExtImageHash{}
+		return nil
+	case int64:
+		bits := h.bits
+		if bits == 0 {
+			bits = 64
+		}
+		if bits > 64 {
+			return fmt.Errorf("cannot scan int64 into %d bits hash", bits)
+		}
+		if bits < 64 && uint64(v)<<uint(bits) != 0 {
+			return fmt.Errorf("int64 %d has more than %d bits", v, bits)
+		}
+		h.hash, h.bits = []uint64{uint64(v)}, bits
+		return nil
+	case []byte:
+		bits := h.bits
+		if bits == 0 {
+			bits = len(v) * 8
+		}
+		parsed, err := ExtImageHashFromBytes(v, h.kind, bits)
+		if err != nil {
+			return err
+		}
+		h.hash, h.bits = parsed.hash, parsed.bits
+		return nil
+	case string:
+		return h.UnmarshalText([]byte(v))
+	}
+	return fmt.Errorf("cannot scan %T into ExtImageHash", src)
+}
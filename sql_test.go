@@ -0,0 +1,210 @@
+// Copyright 2017 The goimagehash Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package goimagehash
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeDriver is a database/sql driver keeping a single table in memory.
+// "INSERT" statements append their arguments as a row and any other
+// statement returns every row.
+type fakeDriver struct {
+	mu   sync.Mutex
+	rows [][]driver.Value
+}
+
+type fakeConn struct{ d *fakeDriver }
+
+type fakeStmt struct {
+	d     *fakeDriver
+	query string
+}
+
+type fakeRows struct {
+	rows [][]driver.Value
+	pos  int
+}
+
+func (d *fakeDriver) Open(name string) (driver.Conn, error) { return &fakeConn{d}, nil }
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) { return &fakeStmt{c.d, query}, nil }
+func (c *fakeConn) Close() error                              { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error)                 { return nil, errors.New("not supported") }
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return -1 }
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	if !strings.HasPrefix(s.query, "INSERT") {
+		return nil, errors.New("unsupported statement")
+	}
+	for _, arg := range args {
+		switch arg.(type) {
+		case int64, []byte, string:
+		default:
+			return nil, errors.New("unexpected argument type")
+		}
+	}
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+	s.d.rows = append(s.d.rows, args)
+	return driver.RowsAffected(1), nil
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+	return &fakeRows{rows: s.d.rows}, nil
+}
+
+func (r *fakeRows) Columns() []string {
+	if len(r.rows) == 0 {
+		return nil
+	}
+	cols := make([]string, len(r.rows[0]))
+	for i := range cols {
+		cols[i] = "c"
+	}
+	return cols
+}
+
+func (r *fakeRows) Close() error { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.pos >= len(r.rows) {
+		return io.EOF
+	}
+	copy(dest, r.rows[r.pos])
+	r.pos++
+	return nil
+}
+
+func openFakeDB(t *testing.T) (*sql.DB, *fakeDriver) {
+	d := &fakeDriver{}
+	name := "goimagehash-fake-" + t.Name()
+	sql.Register(name, d)
+	db, err := sql.Open(name, "")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	return db, d
+}
+
+func TestImageHashSQL(t *testing.T) {
+	db, d := openFakeDB(t)
+	defer db.Close()
+
+	hash := NewImageHash(0xe48ae53c05e502f7, PHash)
+	for _, v := range []interface{}{hash, hash.SQLValue(SQLBytes), hash.SQLValue(SQLText)} {
+		if _, err := db.Exec("INSERT", v); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}
+	if v, ok := d.rows[0][0].(int64); !ok || v >= 0 {
+		t.Errorf("Hash should be stored as a signed int64 but got %#v", d.rows[0][0])
+	}
+	if _, ok := d.rows[1][0].([]byte); !ok {
+		t.Errorf("Hash should be stored as bytes but got %#v", d.rows[1][0])
+	}
+
+	rows, err := db.Query("SELECT")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer rows.Close()
+	n := 0
+	for rows.Next() {
+		got := NewImageHash(0, PHash)
+		if err := rows.Scan(got); err != nil {
+			t.Fatalf("%v", err)
+		}
+		if *got != *hash {
+			t.Errorf("Row %d: expected %v but got %v", n, hash, got)
+		}
+		n++
+	}
+	if n != 3 {
+		t.Errorf("Expected 3 rows but got %d", n)
+	}
+
+	var bad ImageHash
+	if err := bad.Scan(3.14); err == nil {
+		t.Errorf("Should got error when scanning float64")
+	}
+
+	null := NewImageHash(0xe48ae53c05e502f7, PHash)
+	if err := null.Scan(nil); err != nil {
+		t.Errorf("Scanning NULL failed: %v", err)
+	} else if *null != (ImageHash{}) {
+		t.Errorf("NULL should reset the hash but got %v", null)
+	}
+}
+
+func TestExtImageHashSQL(t *testing.T) {
+	db, d := openFakeDB(t)
+	defer db.Close()
+
+	ext := NewExtImageHash(make([]uint64, 3), DGHash, 162)
+	ext.SetBit(3, true)
+	ext.SetBit(161, true)
+	small := NewExtImageHash([]uint64{0}, AHash, 40)
+	small.SetBit(0, true)
+
+	for _, args := range [][]interface{}{
+		{ext, small.SQLValue(SQLInt64)},
+		{ext.SQLValue(SQLText), small},
+	} {
+		if _, err := db.Exec("INSERT", args...); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}
+	if _, ok := d.rows[0][0].([]byte); !ok {
+		t.Errorf("Extended hash should be stored as bytes but got %#v", d.rows[0][0])
+	}
+	if v, ok := d.rows[0][1].(int64); !ok || v >= 0 {
+		t.Errorf("Small hash should be stored as a signed int64 but got %#v", d.rows[0][1])
+	}
+	if _, err := db.Exec("INSERT", ext.SQLValue(SQLInt64)); err == nil {
+		t.Errorf("Should got error when storing 162 bits as int64")
+	}
+
+	rows, err := db.Query("SELECT")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		gotExt := NewExtImageHash(nil, DGHash, 162)
+		gotSmall := NewExtImageHash(nil, AHash, 40)
+		if err := rows.Scan(gotExt, gotSmall); err != nil {
+			t.Fatalf("%v", err)
+		}
+		if gotExt.String() != ext.String() {
+			t.Errorf("Expected %v but got %v", ext, gotExt)
+		}
+		if gotSmall.String() != small.String() {
+			t.Errorf("Expected %v but got %v", small, gotSmall)
+		}
+	}
+
+	tooSmall := NewExtImageHash(nil, AHash, 8)
+	if err := tooSmall.Scan(int64(-1)); err == nil {
+		t.Errorf("Should got error when scanning 64 set bits into 8 bits hash")
+	}
+
+	null := NewExtImageHash([]uint64{1, 2, 3}, DGHash, 162)
+	if err := null.Scan(nil); err != nil {
+		t.Errorf("Scanning NULL failed: %v", err)
+	} else if null.Bits() != 0 || null.GetKind() != Unknown || len(null.GetHash()) != 0 {
+		t.Errorf("NULL should reset the hash but got %v", null)
+	}
+}
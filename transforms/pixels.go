@@ -81,7 +81,7 @@ func FlattenPixels(pixels [][]float64, x int, y int) []float64 {
 	flattens := make([]float64, x*y)
 	for i := 0; i < y; i++ {
 		for j := 0; j < x; j++ {
-			flattens[y*i+j] = pixels[i][j]
+			flattens[x*i+j] = pixels[i][j]
 		}
 	}
 	return flattens
@@ -92,7 +92,7 @@ func FlattenPixelsFast64(pixels []float64, x int, y int) []float64 {
 	flattens := [64]float64{}
 	for i := 0; i < y; i++ {
 		for j := 0; j < x; j++ {
-			flattens[y*i+j] = pixels[(i*64)+j]
+			flattens[x*i+j] = pixels[(i*64)+j]
 		}
 	}
 	return flattens[:]
@@ -0,0 +1,23 @@
+// Copyright 2017 The goimagehash Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package transforms
+
+import (
+	"testing"
+)
+
+func TestFlattenPixels(t *testing.T) {
+	pixels := [][]float64{
+		{0, 1, 2, 3, 9},
+		{4, 5, 6, 7, 9},
+		{9, 9, 9, 9, 9},
+	}
+	flattens := FlattenPixels(pixels, 4, 2)
+	for i, v := range flattens {
+		if v != float64(i) {
+			t.Errorf("FlattenPixels(4x2) is expected %v at %d but got %v.", float64(i), i, v)
+		}
+	}
+}
@@ -0,0 +1,9 @@
+// Copyright 2017 The goimagehash Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package watch detects created, modified, renamed and deleted files in a
+// directory by polling it, without any platform specific notification
+// mechanism. Files still being written are reported once their size and
+// modification time stop changing.
+package watch
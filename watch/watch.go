@@ -0,0 +1,218 @@
+// Copyright 2017 The goimagehash Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package watch
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Op is the kind of change of a file.
+type Op int
+
+const (
+	// Create is a new file.
+	Create Op = iota
+	// Modify is a file whose size or modification time changed.
+	Modify
+	// Rename is a file moved to another path without being modified.
+	Rename
+	// Delete is a file that no longer exists.
+	Delete
+)
+
+var opNames = []string{"create", "modify", "rename", "delete"}
+
+// String method returns the name of the operation.
+func (op Op) String() string {
+	if op < 0 || int(op) >= len(opNames) {
+		return fmt.Sprintf("Op(%d)", int(op))
+	}
+	return opNames[op]
+}
+
+// File is the state of a file as seen by a poll.
+type File struct {
+	Size    int64
+	ModTime time.Time
+}
+
+// Event is a change of a file.
+type Event struct {
+	Op   Op
+	Path string
+	// OldPath is the previous path of a renamed file.
+	OldPath string
+	File    File
+}
+
+// Options configures a Watcher.
+type Options struct {
+	// Recursive also watches the subdirectories.
+	Recursive bool
+	// Match selects the watched files. Nil means every regular file.
+	Match func(path string) bool
+	// Debounce is how long the size and modification time of a created or
+	// modified file must stay the same before it is reported.
+	Debounce time.Duration
+}
+
+// pending is a changed file waiting for the debounce delay.
+type pending struct {
+	file  File
+	since time.Time
+}
+
+// Watcher polls a directory and reports the changes between polls.
+// A Watcher is not safe for concurrent use.
+type Watcher struct {
+	dir     string
+	opts    Options
+	known   map[string]File
+	pending map[string]pending
+	scanned bool
+}
+
+// New function returns a watcher of dir that has not polled it yet.
+func New(dir string, opts Options) *Watcher {
+	return &Watcher{
+		dir:     dir,
+		opts:    opts,
+		known:   make(map[string]File),
+		pending: make(map[string]pending),
+	}
+}
+
+// Files method returns the files reported so far and not deleted since.
+func (w *Watcher) Files() map[string]File {
+	files := make(map[string]File, len(w.known))
+	for path, f := range w.known {
+		files[path] = f
+	}
+	return files
+}
+
+// list returns the watched files of the directory.
+func (w *Watcher) list() (map[string]File, error) {
+	files := make(map[string]File)
+	err := filepath.Walk(w.dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			// Files may disappear while walking.
+			if os.IsNotExist(err) && path != w.dir {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() {
+			if path != w.dir && !w.opts.Recursive {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.Mode().IsRegular() || (w.opts.Match != nil && !w.opts.Match(path)) {
+			return nil
+		}
+		files[path] = File{Size: info.Size(), ModTime: info.ModTime()}
+		return nil
+	})
+	return files, err
+}
+
+// Poll method lists the directory and returns the changes since the
+// previous poll, as of now: deletions, then renames, then creations and
+// modifications, each sorted by path.
+//
+// The first poll reports every existing file as created without waiting
+// for the debounce delay. Afterwards, a created or modified file is
+// reported once it kept the same size and modification time for the
+// debounce delay, and a new file with the size and modification time of a
+// file deleted by the same poll is reported as renamed.
+func (w *Watcher) Poll(now time.Time) ([]Event, error) {
+	current, err := w.list()
+	if err != nil {
+		return nil, err
+	}
+	debounce := w.opts.Debounce
+	if !w.scanned {
+		w.scanned = true
+		debounce = 0
+	}
+
+	deleted := make(map[File][]string)
+	var deletions []string
+	for path, f := range w.known {
+		if _, ok := current[path]; !ok {
+			deleted[f] = append(deleted[f], path)
+			deletions = append(deletions, path)
+		}
+	}
+	for _, paths := range deleted {
+		sort.Strings(paths)
+	}
+	for path := range w.pending {
+		if _, ok := current[path]; !ok {
+			delete(w.pending, path)
+		}
+	}
+
+	paths := make([]string, 0, len(current))
+	for path := range current {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var renames, changes []Event
+	renamed := make(map[string]bool)
+	for _, path := range paths {
+		f := current[path]
+		old, known := w.known[path]
+		if known && old == f {
+			delete(w.pending, path)
+			continue
+		}
+		if !known {
+			if candidates := deleted[f]; len(candidates) > 0 {
+				oldPath := candidates[0]
+				deleted[f] = candidates[1:]
+				renamed[oldPath] = true
+				delete(w.known, oldPath)
+				delete(w.pending, path)
+				w.known[path] = f
+				renames = append(renames, Event{Op: Rename, Path: path, OldPath: oldPath, File: f})
+				continue
+			}
+		}
+		p, ok := w.pending[path]
+		if !ok || p.file != f {
+			p = pending{file: f, since: now}
+			w.pending[path] = p
+		}
+		if now.Sub(p.since) < debounce {
+			continue
+		}
+		delete(w.pending, path)
+		op := Create
+		if known {
+			op = Modify
+		}
+		w.known[path] = f
+		changes = append(changes, Event{Op: op, Path: path, File: f})
+	}
+
+	var events []Event
+	sort.Strings(deletions)
+	for _, path := range deletions {
+		if renamed[path] {
+			continue
+		}
+		events = append(events, Event{Op: Delete, Path: path, File: w.known[path]})
+		delete(w.known, path)
+	}
+	events = append(events, renames...)
+	return append(events, changes...), nil
+}
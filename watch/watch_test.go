@@ -0,0 +1,128 @@
+// Copyright 2017 The goimagehash Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package watch
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func write(t *testing.T, path, content string, modTime time.Time) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("%v", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("%v", err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatalf("%v", err)
+	}
+}
+
+// describe returns the events as "op path" strings relative to dir.
+func describe(dir string, events []Event) string {
+	var s []string
+	for _, e := range events {
+		rel, _ := filepath.Rel(dir, e.Path)
+		if e.Op == Rename {
+			old, _ := filepath.Rel(dir, e.OldPath)
+			rel = old + "->" + rel
+		}
+		s = append(s, fmt.Sprintf("%s %s", e.Op, filepath.ToSlash(rel)))
+	}
+	return strings.Join(s, ", ")
+}
+
+func poll(t *testing.T, w *Watcher, dir string, now time.Time) string {
+	events, err := w.Poll(now)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	return describe(dir, events)
+}
+
+func TestWatcher(t *testing.T) {
+	dir := t.TempDir()
+	t0 := time.Date(2021, 5, 1, 0, 0, 0, 0, time.UTC)
+	write(t, filepath.Join(dir, "a.jpg"), "a", t0)
+	write(t, filepath.Join(dir, "b.jpg"), "bb", t0)
+	write(t, filepath.Join(dir, "notes.txt"), "x", t0)
+	write(t, filepath.Join(dir, "sub", "c.jpg"), "c", t0)
+
+	w := New(dir, Options{
+		Match:    func(path string) bool { return strings.HasSuffix(path, ".jpg") },
+		Debounce: 2 * time.Second,
+	})
+	now := t0.Add(time.Hour)
+	if got := poll(t, w, dir, now); got != "create a.jpg, create b.jpg" {
+		t.Errorf("Unexpected initial scan: %s", got)
+	}
+	if got := poll(t, w, dir, now.Add(time.Second)); got != "" {
+		t.Errorf("Expected no change but got %s", got)
+	}
+
+	// A new file is only reported once it stopped changing for 2s.
+	write(t, filepath.Join(dir, "d.jpg"), "d", t0.Add(time.Minute))
+	now = now.Add(10 * time.Second)
+	if got := poll(t, w, dir, now); got != "" {
+		t.Errorf("Expected the new file to be debounced but got %s", got)
+	}
+	write(t, filepath.Join(dir, "d.jpg"), "dd", t0.Add(2*time.Minute))
+	if got := poll(t, w, dir, now.Add(time.Second)); got != "" {
+		t.Errorf("Expected the growing file to be debounced but got %s", got)
+	}
+	if got := poll(t, w, dir, now.Add(2*time.Second)); got != "" {
+		t.Errorf("Expected the debounce to restart but got %s", got)
+	}
+	if got := poll(t, w, dir, now.Add(3*time.Second)); got != "create d.jpg" {
+		t.Errorf("Expected d.jpg to be created but got %s", got)
+	}
+
+	// Modification, rename and deletion.
+	now = now.Add(time.Minute)
+	write(t, filepath.Join(dir, "a.jpg"), "aaa", t0.Add(time.Hour))
+	if err := os.Rename(filepath.Join(dir, "b.jpg"), filepath.Join(dir, "e.jpg")); err != nil {
+		t.Fatalf("%v", err)
+	}
+	os.Remove(filepath.Join(dir, "d.jpg"))
+	if got := poll(t, w, dir, now); got != "delete d.jpg, rename b.jpg->e.jpg" {
+		t.Errorf("Unexpected events %s", got)
+	}
+	if got := poll(t, w, dir, now.Add(2*time.Second)); got != "modify a.jpg" {
+		t.Errorf("Unexpected events %s", got)
+	}
+
+	files := w.Files()
+	if len(files) != 2 || files[filepath.Join(dir, "e.jpg")].Size != 2 {
+		t.Errorf("Unexpected files %v", files)
+	}
+}
+
+func TestWatcherRecursive(t *testing.T) {
+	dir := t.TempDir()
+	t0 := time.Date(2021, 5, 1, 0, 0, 0, 0, time.UTC)
+	write(t, filepath.Join(dir, "a.jpg"), "a", t0)
+	write(t, filepath.Join(dir, "sub", "deep", "c.jpg"), "c", t0)
+
+	w := New(dir, Options{Recursive: true})
+	if got := poll(t, w, dir, t0); got != "create a.jpg, create sub/deep/c.jpg" {
+		t.Errorf("Unexpected initial scan: %s", got)
+	}
+	os.RemoveAll(filepath.Join(dir, "sub"))
+	if got := poll(t, w, dir, t0); got != "delete sub/deep/c.jpg" {
+		t.Errorf("Unexpected events %s", got)
+	}
+
+	if _, err := New(filepath.Join(dir, "missing"), Options{}).Poll(t0); err == nil {
+		t.Errorf("Should got error for a missing directory")
+	}
+	if Delete.String() != "delete" || Op(9).String() != "Op(9)" {
+		t.Errorf("Unexpected names %s, %s", Delete, Op(9))
+	}
+}
@@ -0,0 +1,246 @@
+// Copyright 2017 The goimagehash Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package goimagehash
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Wire format
+//
+// A stream starts with the 4 bytes magic "\x89GIH" followed by a format
+// version byte and holds any number of hashes in the binary encoding of
+// MarshalBinary. The first magic byte can never start a gob stream, which
+// lets readers tell the format apart from the gob serialization written by
+// older versions of Dump. Streams may be concatenated: a header found where
+// a hash is expected is skipped.
+
+var wireMagic = []byte("\x89GIH")
+
+const wireVersion = 1
+
+// Limits enforced on decoded hashes, far above any real hash size.
+const (
+	maxWireBits = 1 << 20
+	maxWireSize = 1 << 16
+)
+
+var errWireFormat = errors.New("invalid image hash stream")
+
+// HashWriter writes a stream of hashes in the wire format.
+type HashWriter struct {
+	w           io.Writer
+	wroteHeader bool
+}
+
+// NewHashWriter function returns a HashWriter writing to w.
+// The stream header is written along with the first hash.
+func NewHashWriter(w io.Writer) *HashWriter {
+	return &HashWriter{w: w}
+}
+
+func (hw *HashWriter) write(kind Kind, bits, width, height int, hash []byte) error {
+	var buf []byte
+	if !hw.wroteHeader {
+		buf = append(append(buf, wireMagic...), wireVersion)
+	}
+	buf = appendBinary(buf, kind, bits, width, height, hash)
+	if _, err := hw.w.Write(buf); err != nil {
+		return err
+	}
+	hw.wroteHeader = true
+	return nil
+}
+
+// WriteImageHash method writes a hash to the stream.
+func (hw *HashWriter) WriteImageHash(h *ImageHash) error {
+	return hw.write(h.kind, 64, 0, 0, h.Bytes())
+}
+
+// WriteExtImageHash method writes an extended hash to the stream.
+func (hw *HashWriter) WriteExtImageHash(h *ExtImageHash) error {
+	if h.bits <= 0 || wordsFor(h.bits) != len(h.hash) {
+		return fmt.Errorf("invalid %d bits hash of %d words", h.bits, len(h.hash))
+	}
+	return hw.write(h.kind, h.bits, h.width, h.height, h.Bytes())
+}
+
+// HashReader reads hashes written by HashWriter. It also reads the gob
+// streams written by older versions of Dump, one gob value per hash.
+type HashReader struct {
+	r       *bufio.Reader
+	started bool
+	legacy  bool
+}
+
+// NewHashReader function returns a HashReader reading from r.
+// r is used directly when it is a *bufio.Reader, so that nothing past the
+// last read hash is consumed.
+func NewHashReader(r io.Reader) *HashReader {
+	br, ok := r.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+	return &HashReader{r: br}
+}
+
+// readHeader skips stream headers and reports whether a hash follows.
+func (hr *HashReader) readHeader() error {
+	for {
+		magic, err := hr.r.Peek(len(wireMagic))
+		if len(magic) == 0 && err != nil {
+			return err
+		}
+		if !bytes.HasPrefix(wireMagic, magic) {
+			if !hr.started {
+				hr.legacy = true
+			}
+			hr.started = true
+			return nil
+		}
+		if err != nil {
+			return io.ErrUnexpectedEOF
+		}
+		hr.r.Discard(len(wireMagic))
+		version, err := hr.r.ReadByte()
+		if err != nil {
+			return io.ErrUnexpectedEOF
+		}
+		if version != wireVersion {
+			return fmt.Errorf("unsupported image hash stream version %d", version)
+		}
+		hr.started = true
+	}
+}
+
+// Read method returns the next hash of the stream, or io.EOF at the end of
+// the stream. Legacy streams must hold extended hashes.
+func (hr *HashReader) Read() (*ExtImageHash, error) {
+	if err := hr.readHeader(); err != nil {
+		return nil, err
+	}
+	if hr.legacy {
+		return hr.readLegacyExt()
+	}
+	h, err := hr.readRecord()
+	if err == io.EOF {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return h, err
+}
+
+// ReadImageHash method returns the next hash of the stream as an ImageHash,
+// or io.EOF at the end of the stream. The hash must have 64 bits. Legacy
+// streams must hold hashes written by ImageHash.Dump.
+func (hr *HashReader) ReadImageHash() (*ImageHash, error) {
+	if err := hr.readHeader(); err != nil {
+		return nil, err
+	}
+	if hr.legacy {
+		return hr.readLegacy()
+	}
+	h, err := hr.readRecord()
+	if err == io.EOF {
+		return nil, io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return nil, err
+	}
+	if h.bits != 64 {
+		return nil, fmt.Errorf("image hash should have 64 bits but got %d", h.bits)
+	}
+	return &ImageHash{hash: h.hash[0], kind: h.kind}, nil
+}
+
+func (hr *HashReader) readRecord() (*ExtImageHash, error) {
+	version, err := hr.r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	if version != binaryVersion {
+		return nil, fmt.Errorf("unsupported binary image hash version %d", version)
+	}
+	k, err := hr.r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	kind := Kind(k)
+	if !kind.valid() {
+		return nil, fmt.Errorf("invalid binary image hash kind %d", k)
+	}
+	var params [3]uint64
+	for i := range params {
+		if params[i], err = binary.ReadUvarint(hr.r); err != nil {
+			return nil, err
+		}
+	}
+	bits, width, height := params[0], params[1], params[2]
+	if bits == 0 || bits > maxWireBits || width > maxWireSize || height > maxWireSize {
+		return nil, errWireFormat
+	}
+	b := make([]byte, (bits+7)/8)
+	if _, err := io.ReadFull(hr.r, b); err != nil {
+		return nil, err
+	}
+	h, err := DecodeExtImageHash(b, MSBFirst, kind, int(bits))
+	if err != nil {
+		return nil, err
+	}
+	h.width, h.height = int(width), int(height)
+	return h, nil
+}
+
+func (hr *HashReader) readLegacy() (*ImageHash, error) {
+	var e struct {
+		Hash uint64
+		Kind Kind
+	}
+	if err := gob.NewDecoder(hr.r).Decode(&e); err != nil {
+		return nil, err
+	}
+	if !e.Kind.valid() {
+		return nil, fmt.Errorf("invalid image hash kind %d", e.Kind)
+	}
+	return &ImageHash{hash: e.Hash, kind: e.Kind}, nil
+}
+
+func (hr *HashReader) readLegacyExt() (*ExtImageHash, error) {
+	var e struct {
+		Hash []uint64
+		Kind Kind
+		Bits int
+	}
+	if err := gob.NewDecoder(hr.r).Decode(&e); err != nil {
+		return nil, err
+	}
+	if !e.Kind.valid() {
+		return nil, fmt.Errorf("invalid image hash kind %d", e.Kind)
+	}
+	if e.Bits <= 0 || e.Bits > maxWireBits || wordsFor(e.Bits) != len(e.Hash) {
+		return nil, fmt.Errorf("invalid %d bits hash of %d words", e.Bits, len(e.Hash))
+	}
+	h := NewExtImageHash(make([]uint64, len(e.Hash)), e.Kind, e.Bits)
+	for i := 0; i < len(e.Hash)*64; i++ {
+		word, pos := i/64, uint(63-i%64)
+		if e.Kind == DGHash {
+			// DoubleGradient hashes used to be packed LSB first.
+			pos = uint(i % 64)
+		}
+		if e.Hash[word]>>pos&1 == 0 {
+			continue
+		}
+		if i >= e.Bits {
+			return nil, errors.New("unused trailing bits of hash should be zero")
+		}
+		h.SetBit(i, true)
+	}
+	return h, nil
+}
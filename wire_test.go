@@ -0,0 +1,166 @@
+// Copyright 2017 The goimagehash Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package goimagehash
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/gob"
+	"io"
+	"testing"
+)
+
+func TestHashStream(t *testing.T) {
+	ext := NewExtImageHashWithSize(make([]uint64, 5), AHash, 289, 17, 17)
+	ext.SetBit(0, true)
+	ext.SetBit(288, true)
+	dg := NewExtImageHashWithSize(make([]uint64, 1), DGHash, 40, 8, 8)
+	dg.SetBit(39, true)
+	hash := NewImageHash(0xe48ae53c05e502f7, PHash)
+
+	var b bytes.Buffer
+	w := NewHashWriter(&b)
+	for _, h := range []*ExtImageHash{ext, dg, hash.ToExtImageHash()} {
+		if err := w.WriteExtImageHash(h); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}
+	if err := w.WriteImageHash(hash); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	r := NewHashReader(&b)
+	for _, expected := range []*ExtImageHash{ext, dg, hash.ToExtImageHash()} {
+		h, err := r.Read()
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		if h.String() != expected.String() {
+			t.Errorf("Expected %v but got %v", expected, h)
+		}
+		ew, eh := expected.Size()
+		if w, hh := h.Size(); w != ew || hh != eh {
+			t.Errorf("Expected size %dx%d but got %dx%d", ew, eh, w, hh)
+		}
+	}
+	h, err := r.ReadImageHash()
+	if err != nil || *h != *hash {
+		t.Errorf("Expected %v but got %v, %v", hash, h, err)
+	}
+	if _, err := r.Read(); err != io.EOF {
+		t.Errorf("Expected io.EOF but got %v", err)
+	}
+}
+
+func TestDumpIsCompact(t *testing.T) {
+	var b bytes.Buffer
+	if err := NewImageHash(0xe48ae53c05e502f7, PHash).Dump(&b); err != nil {
+		t.Fatalf("%v", err)
+	}
+	if b.Len() > 20 {
+		t.Errorf("Dump of a 64 bits hash should be at most 20 bytes but got %d", b.Len())
+	}
+}
+
+func TestConcatenatedDumps(t *testing.T) {
+	var b bytes.Buffer
+	hashes := []*ImageHash{NewImageHash(1, AHash), NewImageHash(2, DHash), NewImageHash(3, PHash)}
+	for _, h := range hashes {
+		if err := h.Dump(&b); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}
+	r := bufio.NewReader(&b)
+	for _, expected := range hashes {
+		h, err := LoadImageHash(r)
+		if err != nil || *h != *expected {
+			t.Errorf("Expected %v but got %v, %v", expected, h, err)
+		}
+	}
+}
+
+func TestLegacyGobStream(t *testing.T) {
+	type D struct {
+		Hash uint64
+		Kind Kind
+	}
+	type ExtD struct {
+		Hash []uint64
+		Kind Kind
+		Bits int
+	}
+
+	var b bytes.Buffer
+	for _, d := range []D{{0xe48ae53c05e502f7, PHash}, {42, AHash}} {
+		if err := gob.NewEncoder(&b).Encode(d); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}
+	r := NewHashReader(&b)
+	for _, expected := range []*ImageHash{NewImageHash(0xe48ae53c05e502f7, PHash), NewImageHash(42, AHash)} {
+		h, err := r.ReadImageHash()
+		if err != nil || *h != *expected {
+			t.Errorf("Expected %v but got %v, %v", expected, h, err)
+		}
+	}
+	if _, err := r.ReadImageHash(); err != io.EOF {
+		t.Errorf("Expected io.EOF but got %v", err)
+	}
+
+	// DoubleGradient hashes used to be packed LSB first.
+	b.Reset()
+	if err := gob.NewEncoder(&b).Encode(ExtD{Hash: []uint64{1 | 1<<39}, Kind: DGHash, Bits: 40}); err != nil {
+		t.Fatalf("%v", err)
+	}
+	ext, err := LoadExtImageHash(&b)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if !ext.Bit(0) || !ext.Bit(39) || ext.GetHash()[0] != 1<<63|1<<24 {
+		t.Errorf("Legacy DoubleGradient hash should be repacked MSB first, got %v", ext)
+	}
+
+	for _, bad := range []ExtD{
+		{Hash: []uint64{1, 2}, Kind: AHash, Bits: 64},
+		{Hash: []uint64{1}, Kind: AHash, Bits: 0},
+		{Hash: []uint64{1}, Kind: AHash, Bits: 8},
+		{Hash: []uint64{1}, Kind: Kind(99), Bits: 64},
+	} {
+		b.Reset()
+		if err := gob.NewEncoder(&b).Encode(bad); err != nil {
+			t.Fatalf("%v", err)
+		}
+		if _, err := LoadExtImageHash(&b); err == nil {
+			t.Errorf("Should got error for %+v", bad)
+		}
+	}
+}
+
+func TestHashStreamValidation(t *testing.T) {
+	var valid bytes.Buffer
+	if err := NewExtImageHash(make([]uint64, 2), AHash, 100).Dump(&valid); err != nil {
+		t.Fatalf("%v", err)
+	}
+	data := valid.Bytes()
+
+	for name, bad := range map[string][]byte{
+		"truncated header":  data[:3],
+		"missing version":   data[:4],
+		"bad version":       append(append([]byte{}, wireMagic...), 9, 1, 1, 64, 0, 0),
+		"truncated hash":    data[:len(data)-1],
+		"bad kind":          append(append([]byte{}, wireMagic...), wireVersion, binaryVersion, 99, 64, 0, 0),
+		"zero bits":         append(append([]byte{}, wireMagic...), wireVersion, binaryVersion, 1, 0, 0, 0),
+		"huge bits":         append(append([]byte{}, wireMagic...), wireVersion, binaryVersion, 1, 0xff, 0xff, 0xff, 0x7f, 0, 0),
+		"non zero trailing": append(append([]byte{}, data[:len(data)-1]...), 0xff),
+	} {
+		if _, err := LoadExtImageHash(bytes.NewReader(bad)); err == nil {
+			t.Errorf("%s: should got error", name)
+		}
+	}
+
+	if err := NewHashWriter(io.Discard).WriteExtImageHash(NewExtImageHash(make([]uint64, 1), AHash, 100)); err == nil {
+		t.Errorf("Should got error when writing a hash with too few words")
+	}
+}